@@ -1,9 +1,12 @@
 
-// Package av defines basic interfaces and data structures of container demux/mux and audio encode/decode.
+// Package av defines basic interfaces and data structures of container demux/mux and audio/video encode/decode.
 package av
 
 import (
+	"context"
 	"fmt"
+	"github.com/nareix/joy4/utils/bits/pio"
+	"image"
 	"time"
 )
 
@@ -124,15 +127,35 @@ var (
 	PCM_ALAW  = MakeAudioCodecType(avCodecTypeMagic + 3)
 	SPEEX = MakeAudioCodecType(avCodecTypeMagic + 4)
 	NELLYMOSER = MakeAudioCodecType(avCodecTypeMagic + 5)
+	H265 = MakeVideoCodecType(avCodecTypeMagic + 2)
+	OPUS = MakeAudioCodecType(avCodecTypeMagic + 6)
+	MP3 = MakeAudioCodecType(avCodecTypeMagic + 7)
+	AC3 = MakeAudioCodecType(avCodecTypeMagic + 8)
+	EAC3 = MakeAudioCodecType(avCodecTypeMagic + 9)
+	AV1 = MakeVideoCodecType(avCodecTypeMagic + 3)
+	VP8 = MakeVideoCodecType(avCodecTypeMagic + 4)
+	VP9 = MakeVideoCodecType(avCodecTypeMagic + 5)
+	ID3 = MakeDataCodecType(avCodecTypeMagic + 1) // ID3 timed metadata
+	AMF0 = MakeDataCodecType(avCodecTypeMagic + 2) // flv script data, e.g: onCuePoint/onTextData
+	TX3G = MakeDataCodecType(avCodecTypeMagic + 3) // 3GPP timed text
 )
 
 const codecTypeAudioBit = 0x1
+const codecTypeDataBit = 0x80000000
 const codecTypeOtherBits = 1
 
 func (self CodecType) String() string {
 	switch self {
 	case H264:
 		return "H264"
+	case H265:
+		return "H265"
+	case AV1:
+		return "AV1"
+	case VP8:
+		return "VP8"
+	case VP9:
+		return "VP9"
 	case AAC:
 		return "AAC"
 	case PCM_MULAW:
@@ -143,6 +166,20 @@ func (self CodecType) String() string {
 		return "SPEEX"
 	case NELLYMOSER:
 		return "NELLYMOSER"
+	case OPUS:
+		return "OPUS"
+	case MP3:
+		return "MP3"
+	case AC3:
+		return "AC3"
+	case EAC3:
+		return "EAC3"
+	case ID3:
+		return "ID3"
+	case AMF0:
+		return "AMF0"
+	case TX3G:
+		return "TX3G"
 	}
 	return ""
 }
@@ -152,7 +189,12 @@ func (self CodecType) IsAudio() bool {
 }
 
 func (self CodecType) IsVideo() bool {
-	return self&codecTypeAudioBit == 0
+	return self&codecTypeAudioBit == 0 && self&codecTypeDataBit == 0
+}
+
+// Timed metadata or subtitle stream, neither audio nor video.
+func (self CodecType) IsData() bool {
+	return self&codecTypeDataBit != 0
 }
 
 // Make a new audio codec type.
@@ -167,14 +209,22 @@ func MakeVideoCodecType(base uint32) (c CodecType) {
 	return
 }
 
+// Make a new data codec type.
+func MakeDataCodecType(base uint32) (c CodecType) {
+	c = CodecType(base)<<codecTypeOtherBits | CodecType(codecTypeDataBit)
+	return
+}
+
 const avCodecTypeMagic = 233333
 
 // CodecData is some important bytes for initializing audio/video decoder,
-// can be converted to VideoCodecData or AudioCodecData using:
+// can be converted to VideoCodecData, AudioCodecData or DataCodecData using:
 //
-//     codecdata.(AudioCodecData) or codecdata.(VideoCodecData)
+//     codecdata.(AudioCodecData) or codecdata.(VideoCodecData) or codecdata.(DataCodecData)
 // 
 // for H264, CodecData is AVCDecoderConfigure bytes, includes SPS/PPS.
+// for H265, CodecData is HEVCDecoderConfigure bytes, includes VPS/SPS/PPS.
+// for AV1, CodecData is AV1CodecConfigurationRecord bytes, includes sequence header OBU.
 type CodecData interface {
 	Type() CodecType // Video/Audio codec type
 }
@@ -193,6 +243,13 @@ type AudioCodecData interface {
 	PacketDuration([]byte) (time.Duration, error) // get audio compressed packet duration
 }
 
+// DataCodecData describes timed metadata, cue points or subtitles.
+// Packets of data streams are not decoded, muxers pass them through as is.
+type DataCodecData interface {
+	CodecData
+	Extradata() []byte // codec specific config, e.g: tx3g sample description, can be nil
+}
+
 type PacketWriter interface {
 	WritePacket(Packet) error
 }
@@ -201,6 +258,12 @@ type PacketReader interface {
 	ReadPacket() (Packet,error)
 }
 
+// PacketReader whose blocking read can be cancelled or given a deadline by ctx.
+// After ctx error the reader is in undefined state and should be closed.
+type ContextPacketReader interface {
+	ReadPacketContext(ctx context.Context) (Packet, error)
+}
+
 // Muxer describes the steps of writing compressed audio/video packets into container formats like MP4/FLV/MPEG-TS.
 // 
 // Container formats, rtmp.Conn, and transcode.Muxer implements Muxer interface.
@@ -217,11 +280,23 @@ type MuxCloser interface {
 }
 
 // Demuxer can read compressed audio/video packets from container formats like MP4/FLV/MPEG-TS.
+//
+// When codec data of a stream changes mid-stream, e.g: new SPS/PPS after resolution change,
+// the first packet using it carries the new one in Packet.CodecData and
+// Streams() returns the updated list from then on.
 type Demuxer interface {
 	PacketReader // read compressed audio/video packets
 	Streams() ([]CodecData, error) // reads the file header, contains video/audio meta infomations
 }
 
+// Demuxer whose blocking calls can be cancelled or given a deadline by ctx,
+// implemented by network demuxers like rtsp.Client and rtmp.Conn.
+type ContextDemuxer interface {
+	Demuxer
+	ContextPacketReader
+	StreamsContext(ctx context.Context) ([]CodecData, error)
+}
+
 // Demuxer with Close() method
 type DemuxCloser interface {
 	Demuxer
@@ -235,6 +310,146 @@ type Packet struct {
 	CompositionTime time.Duration // packet presentation time minus decode time for H264 B-Frame
 	Time time.Duration // packet decode time（解码时间）
 	Data            []byte // packet data
+	SideData        []SideData // per packet metadata from demuxer, e.g: SEI, wallclock time
+	CodecData       CodecData // not nil if codec data of stream changed from this packet on
+	Buffer          *Buffer // not nil if Data is from BufferPool, see Release
+}
+
+// Take another reference of pooled data, for keeping packet after Release of original one.
+func (self Packet) Ref() {
+	if self.Buffer != nil {
+		self.Buffer.Ref()
+	}
+}
+
+// Return pooled data to BufferPool after last reference released, Data must not be used then.
+func (self *Packet) Release() {
+	if self.Buffer != nil {
+		self.Buffer.Release()
+		self.Buffer = nil
+	}
+}
+
+// Replace codec data of pkt.Idx in streams if pkt carries a new one.
+// A new slice is returned so that streams already handed out are not modified.
+func ApplyCodecDataChange(streams []CodecData, pkt Packet) []CodecData {
+	if pkt.CodecData == nil || int(pkt.Idx) >= len(streams) {
+		return streams
+	}
+	_streams := make([]CodecData, len(streams))
+	copy(_streams, streams)
+	_streams[pkt.Idx] = pkt.CodecData
+	return _streams
+}
+
+// Packet side data type.
+type SideDataType uint8
+
+const (
+	SIDE_DATA_SEI           = SideDataType(iota + 1) // H264/H265 SEI nal unit not included in Packet.Data
+	SIDE_DATA_ENCRYPTION                             // packet is encrypted, data is container specific
+	SIDE_DATA_DISCONTINUITY                          // timestamp or continuity break before this packet, no data
+	SIDE_DATA_WALLCLOCK                              // capture time, see Packet.Wallclock
+	SIDE_DATA_SEQUENCE                               // sequence number in source protocol e.g: rtp, see Packet.Sequence
+)
+
+func (self SideDataType) String() string {
+	switch self {
+	case SIDE_DATA_SEI:
+		return "SEI"
+	case SIDE_DATA_ENCRYPTION:
+		return "ENCRYPTION"
+	case SIDE_DATA_DISCONTINUITY:
+		return "DISCONTINUITY"
+	case SIDE_DATA_WALLCLOCK:
+		return "WALLCLOCK"
+	case SIDE_DATA_SEQUENCE:
+		return "SEQUENCE"
+	}
+	return ""
+}
+
+type SideData struct {
+	Type SideDataType
+	Data []byte
+}
+
+// Append side data, multiple side data of same type is allowed, e.g: SEI.
+func (self *Packet) AddSideData(typ SideDataType, data []byte) {
+	self.SideData = append(self.SideData, SideData{Type: typ, Data: data})
+}
+
+// Get first side data of type.
+func (self Packet) GetSideData(typ SideDataType) (data []byte, ok bool) {
+	for _, sd := range self.SideData {
+		if sd.Type == typ {
+			return sd.Data, true
+		}
+	}
+	return
+}
+
+// Get all side data of type.
+func (self Packet) SideDataList(typ SideDataType) (list [][]byte) {
+	for _, sd := range self.SideData {
+		if sd.Type == typ {
+			list = append(list, sd.Data)
+		}
+	}
+	return
+}
+
+func (self *Packet) setSideData(typ SideDataType, data []byte) {
+	for i := range self.SideData {
+		if self.SideData[i].Type == typ {
+			self.SideData[i].Data = data
+			return
+		}
+	}
+	self.AddSideData(typ, data)
+}
+
+func (self Packet) IsDiscontinuity() bool {
+	_, ok := self.GetSideData(SIDE_DATA_DISCONTINUITY)
+	return ok
+}
+
+func (self *Packet) SetDiscontinuity() {
+	self.setSideData(SIDE_DATA_DISCONTINUITY, nil)
+}
+
+// Wallclock is stored as nanoseconds since unix epoch in big endian.
+func (self *Packet) SetWallclock(tm time.Time) {
+	b := make([]byte, 8)
+	pio.PutU64BE(b, uint64(tm.UnixNano()))
+	self.setSideData(SIDE_DATA_WALLCLOCK, b)
+}
+
+func (self Packet) Wallclock() (tm time.Time, ok bool) {
+	var b []byte
+	if b, ok = self.GetSideData(SIDE_DATA_WALLCLOCK); !ok || len(b) < 8 {
+		ok = false
+		return
+	}
+	tm = time.Unix(0, int64(pio.U64BE(b)))
+	return
+}
+
+// Sequence is stored as uint64 in big endian.
+func (self *Packet) SetSequence(seq uint64) {
+	b := make([]byte, 8)
+	pio.PutU64BE(b, seq)
+	self.setSideData(SIDE_DATA_SEQUENCE, b)
+}
+
+func (self Packet) Sequence() (seq uint64, ok bool) {
+	var b []byte
+	if b, ok = self.GetSideData(SIDE_DATA_SEQUENCE); !ok || len(b) < 8 {
+		ok = false
+		return
+	}
+	seq = pio.U64BE(b)
+	return
 }
 
 // Raw audio frame.
@@ -314,8 +529,45 @@ type AudioDecoder interface {
 	Close() // close decode, free cgo contexts
 }
 
+// Raw video frame.
+type VideoFrame struct {
+	Image      image.Image   // decoded picture, e.g: *image.YCbCr
+	Time       time.Duration // presentation time
+	IsKeyFrame bool          // decoded from key frame, or to be encoded as key frame
+}
+
+// VideoEncoder can encode raw video frames into compressed video packets.
+// cgo/ffmpeg implements VideoEncoder, using ffmpeg.NewVideoEncoder to create it.
+type VideoEncoder interface {
+	CodecData() (VideoCodecData, error) // encoder's codec data can put into container
+	// encode raw video frame, packets have Time, CompositionTime and IsKeyFrame set,
+	// they may be delayed by encoder until later frames
+	EncodeFrame(VideoFrame) ([]Packet, error)
+	Flush() ([]Packet, error)            // packets delayed in encoder, at end of stream
+	Close()                              // close encoder, free cgo contexts
+	SetBitrate(int) error                // set encoder bitrate
+	SetOption(string, interface{}) error // encoder setopt, in ffmpeg is av_opt_set_dict()
+	GetOption(string, interface{}) error // encoder getopt
+}
+
+// VideoDecoder can decode compressed video packets into raw video frames.
+// use ffmpeg.NewVideoDecoder to create it.
+type VideoDecoder interface {
+	// decode one compressed video packet, frames are in presentation order,
+	// with B-frames they come out some packets later
+	DecodePacket(Packet) ([]VideoFrame, error)
+	Flush() ([]VideoFrame, error) // frames delayed in decoder, at end of stream
+	Close()                       // close decoder, free cgo contexts
+}
+
 // AudioResampler can convert raw audio frames in different sample rate/format/channel layout.
 type AudioResampler interface {
 	Resample(AudioFrame) (AudioFrame, error) // convert raw audio frames
 }
 
+// VideoScaler can resize raw video images and convert their pixel format.
+// use ffmpeg.VideoScaler.
+type VideoScaler interface {
+	Scale(image.Image) (image.Image, error) // convert raw video image
+}
+
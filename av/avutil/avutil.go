@@ -1,6 +1,7 @@
 package avutil
 
 import (
+	"context"
 	"io"
 	"strings"
 	"fmt"
@@ -20,6 +21,31 @@ func (self *HandlerDemuxer) Close() error {
 	return self.r.Close()
 }
 
+// Blocking reads are interrupted if underlying reader supports deadline like pipes.
+func (self *HandlerDemuxer) StreamsContext(ctx context.Context) (streams []av.CodecData, err error) {
+	if d, ok := self.Demuxer.(av.ContextDemuxer); ok {
+		return d.StreamsContext(ctx)
+	}
+	interrupt, resume := readDeadlineFuncs(self.r)
+	err = DoContext(ctx, interrupt, resume, func() (err error) {
+		streams, err = self.Demuxer.Streams()
+		return
+	})
+	return
+}
+
+func (self *HandlerDemuxer) ReadPacketContext(ctx context.Context) (pkt av.Packet, err error) {
+	if r, ok := self.Demuxer.(av.ContextPacketReader); ok {
+		return r.ReadPacketContext(ctx)
+	}
+	interrupt, resume := readDeadlineFuncs(self.r)
+	err = DoContext(ctx, interrupt, resume, func() (err error) {
+		pkt, err = self.Demuxer.ReadPacket()
+		return
+	})
+	return
+}
+
 type HandlerMuxer struct {
 	av.Muxer
 	w io.WriteCloser
@@ -59,8 +85,11 @@ type RegisterHandler struct {
 	WriterMuxer func(io.Writer)av.Muxer
 	UrlMuxer func(string)(bool,av.MuxCloser,error)
 	UrlDemuxer func(string)(bool,av.DemuxCloser,error)
+	UrlDemuxerContext func(context.Context,string)(bool,av.DemuxCloser,error) // used instead of UrlDemuxer if set
 	UrlReader func(string)(bool,io.ReadCloser,error)
 	Probe func([]byte)bool
+	ProbeScore func([]byte)(int,error) // used instead of Probe if set, see ProbeBytes
+	NeedSeek bool // ReaderDemuxer requires io.ReadSeeker
 	AudioEncoder func(av.CodecType)(av.AudioEncoder,error)
 	AudioDecoder func(av.AudioCodecData)(av.AudioDecoder,error)
 	ServerDemuxer func(string)(bool,av.DemuxCloser,error)
@@ -108,7 +137,7 @@ func (self *Handlers) NewAudioEncoder(typ av.CodecType) (enc av.AudioEncoder, er
 			}
 		}
 	}
-	err = fmt.Errorf("avutil: encoder", typ, "not found")
+	err = fmt.Errorf("avutil: encoder %v not found", typ)
 	return
 }
 
@@ -120,11 +149,17 @@ func (self *Handlers) NewAudioDecoder(codec av.AudioCodecData) (dec av.AudioDeco
 			}
 		}
 	}
-	err = fmt.Errorf("avutil: decoder", codec.Type(), "not found")
+	err = fmt.Errorf("avutil: decoder %v not found", codec.Type())
 	return
 }
 
 func (self *Handlers) Open(uri string) (demuxer av.DemuxCloser, err error) {
+	return self.OpenContext(context.Background(), uri)
+}
+
+// Open with ctx used while connecting and probing, reading packets
+// should use ReadPacketContext of returned demuxer.
+func (self *Handlers) OpenContext(ctx context.Context, uri string) (demuxer av.DemuxCloser, err error) {
 	listen := false
 	if strings.HasPrefix(uri, "listen:") {
 		uri = uri[len("listen:"):]
@@ -140,7 +175,12 @@ func (self *Handlers) Open(uri string) (demuxer av.DemuxCloser, err error) {
 				}
 			}
 		} else {
-			if handler.UrlDemuxer != nil {
+			if handler.UrlDemuxerContext != nil {
+				var ok bool
+				if ok, demuxer, err = handler.UrlDemuxerContext(ctx, uri); ok {
+					return
+				}
+			} else if handler.UrlDemuxer != nil {
 				var ok bool
 				if ok, demuxer, err = handler.UrlDemuxer(uri); ok {
 					return
@@ -175,36 +215,39 @@ func (self *Handlers) Open(uri string) (demuxer av.DemuxCloser, err error) {
 		}
 	}
 
-	var probebuf [1024]byte
 	if r, err = self.openUrl(u, uri); err != nil {
 		return
 	}
-	if _, err = io.ReadFull(r, probebuf[:]); err != nil {
+	var b []byte
+	interrupt, resume := readDeadlineFuncs(r)
+	if err = DoContext(ctx, interrupt, resume, func() (err error) {
+		b, err = readProbeBytes(r)
+		return
+	}); err != nil {
+		r.Close()
 		return
 	}
 
-	for _, handler := range self.handlers {
-		// Probe -- 探测
-		if handler.Probe != nil && handler.Probe(probebuf[:]) && handler.ReaderDemuxer != nil {
-			var _r io.Reader
-			if rs, ok := r.(io.ReadSeeker); ok {
-				if _, err = rs.Seek(0, 0); err != nil {
-					return
-				}
-				_r = rs
-			} else {
-				_r = io.MultiReader(bytes.NewReader(probebuf[:]), r)
-			}
-			demuxer = &HandlerDemuxer{
-				Demuxer: handler.ReaderDemuxer(_r),
-				r: r,
-			}
+	rs, seekable := r.(io.ReadSeeker)
+	var handler RegisterHandler
+	if handler, _, err = self.ProbeBytes(b, seekable); err != nil {
+		r.Close()
+		return
+	}
+	var _r io.Reader
+	if seekable {
+		if _, err = rs.Seek(0, 0); err != nil {
+			r.Close()
 			return
 		}
+		_r = rs
+	} else {
+		_r = io.MultiReader(bytes.NewReader(b), r)
+	}
+	demuxer = &HandlerDemuxer{
+		Demuxer: handler.ReaderDemuxer(_r),
+		r: r,
 	}
-
-	r.Close()
-	err = fmt.Errorf("avutil: open %s failed", uri)
 	return
 }
 
@@ -272,14 +315,24 @@ func Open(url string) (demuxer av.DemuxCloser, err error) {
 	return DefaultHandlers.Open(url)
 }
 
+func OpenContext(ctx context.Context, url string) (demuxer av.DemuxCloser, err error) {
+	return DefaultHandlers.OpenContext(ctx, url)
+}
+
 func Create(url string) (muxer av.MuxCloser, err error) {
 	return DefaultHandlers.Create(url)
 }
 
+// Packets are written as is, so codec data changes carried by them reach dst.
 func CopyPackets(dst av.PacketWriter, src av.PacketReader) (err error) {
+	return CopyPacketsContext(context.Background(), dst, src)
+}
+
+// Copy until io.EOF or ctx done, see ReadPacketContext.
+func CopyPacketsContext(ctx context.Context, dst av.PacketWriter, src av.PacketReader) (err error) {
 	for {
 		var pkt av.Packet
-		if pkt, err = src.ReadPacket(); err != nil {
+		if pkt, err = ReadPacketContext(ctx, src); err != nil {
 			if err == io.EOF {
 				break
 			}
@@ -293,14 +346,19 @@ func CopyPackets(dst av.PacketWriter, src av.PacketReader) (err error) {
 }
 
 func CopyFile(dst av.Muxer, src av.Demuxer) (err error) {
+	return CopyFileContext(context.Background(), dst, src)
+}
+
+// Trailer is not written if ctx is done before src ends.
+func CopyFileContext(ctx context.Context, dst av.Muxer, src av.Demuxer) (err error) {
 	var streams []av.CodecData
-	if streams, err = src.Streams(); err != nil {
+	if streams, err = StreamsContext(ctx, src); err != nil {
 		return
 	}
 	if err = dst.WriteHeader(streams); err != nil {
 		return
 	}
-	if err = CopyPackets(dst, src); err != nil {
+	if err = CopyPacketsContext(ctx, dst, src); err != nil {
 		if err != io.EOF {
 			return
 		}
@@ -0,0 +1,87 @@
+package avutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+// Run fn and call interrupt if ctx is done before fn returns, so that blocking
+// I/O in fn fails, e.g: by setting a past deadline on net.Conn. ctx.Err() is
+// returned then instead of the I/O error. resume is called after interrupt
+// to undo it, e.g: clear the deadline.
+func DoContext(ctx context.Context, interrupt, resume func(), fn func() error) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan bool)
+	go func() {
+		select {
+		case <-ctx.Done():
+			interrupt()
+			stopped <- true
+		case <-stop:
+			stopped <- false
+		}
+	}()
+
+	err = fn()
+	close(stop)
+	if <-stopped {
+		resume()
+		if err != nil {
+			err = ctx.Err()
+		}
+	}
+	return
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// Interrupt and resume funcs for DoContext on readers with deadline support like
+// net.Conn and pipes, blocking reads on other readers are not interrupted.
+func readDeadlineFuncs(r interface{}) (interrupt, resume func()) {
+	if d, ok := r.(readDeadliner); ok {
+		interrupt = func() {
+			d.SetReadDeadline(time.Now())
+		}
+		resume = func() {
+			d.SetReadDeadline(time.Time{})
+		}
+	} else {
+		interrupt = func() {}
+		resume = func() {}
+	}
+	return
+}
+
+// Streams of demuxer, honors ctx if demuxer implements av.ContextDemuxer.
+func StreamsContext(ctx context.Context, demuxer av.Demuxer) (streams []av.CodecData, err error) {
+	if d, ok := demuxer.(av.ContextDemuxer); ok {
+		return d.StreamsContext(ctx)
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return demuxer.Streams()
+}
+
+// ReadPacket of r, honors ctx if r implements av.ContextPacketReader,
+// otherwise ctx is only checked before reading.
+func ReadPacketContext(ctx context.Context, r av.PacketReader) (pkt av.Packet, err error) {
+	if cr, ok := r.(av.ContextPacketReader); ok {
+		return cr.ReadPacketContext(ctx)
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return r.ReadPacket()
+}
@@ -0,0 +1,61 @@
+package avutil
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Wait until goroutines started by DoContext exited.
+func checkGoroutines(t *testing.T, n int) {
+	for i := 0; runtime.NumGoroutine() > n; i++ {
+		if i == 1000 {
+			t.Fatalf("%d goroutines leaked", runtime.NumGoroutine()-n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDoContextCancel(t *testing.T) {
+	r, w := net.Pipe()
+	defer w.Close()
+	defer r.Close()
+	interrupt, resume := readDeadlineFuncs(r)
+
+	n := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*10, cancel)
+	err := DoContext(ctx, interrupt, resume, func() error {
+		_, err := r.Read(make([]byte, 1))
+		return err
+	})
+	if err != context.Canceled {
+		t.Fatalf("err=%v", err)
+	}
+	checkGoroutines(t, n)
+
+	// deadline cleared by resume, reads work again
+	go w.Write([]byte{1})
+	if _, err = r.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// done before call
+	if err = DoContext(ctx, interrupt, resume, func() error { panic("called") }); err != context.Canceled {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestDoContextNoLeak(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := runtime.NumGoroutine()
+	for i := 0; i < 1000; i++ {
+		if err := DoContext(ctx, func() {}, func() {}, func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkGoroutines(t, n)
+}
@@ -0,0 +1,142 @@
+package avutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nareix/joy4/av"
+)
+
+// Confidence returned by RegisterHandler.ProbeScore, highest one wins.
+const (
+	ProbeScoreMax     = 100 // magic number and structure checked, e.g: "DKIF" header
+	ProbeScoreDefault = 50  // handler with only Probe func matched
+	ProbeScoreMin     = 1   // weak sync like single audio frame header
+)
+
+// Bytes read from start of input for probing.
+var ProbeLength = 2048
+
+type ProbeResult struct {
+	Ext   string // extension of handler
+	Score int
+	Err   error // why handler rejected input if Score is 0
+}
+
+// Returned when no handler accepts input, reason of each handler is in Results.
+type ProbeError struct {
+	Results []ProbeResult
+}
+
+func (self *ProbeError) Error() string {
+	reasons := []string{}
+	for _, result := range self.Results {
+		reasons = append(reasons, result.Err.Error())
+	}
+	return "avutil: probe failed: " + strings.Join(reasons, ", ")
+}
+
+func (self RegisterHandler) probeScore(b []byte, seekable bool) (score int, err error) {
+	name := strings.TrimPrefix(self.Ext, ".")
+	if self.NeedSeek && !seekable {
+		err = fmt.Errorf("%s: io.ReadSeeker required", name)
+		return
+	}
+	if self.ProbeScore != nil {
+		return self.ProbeScore(b)
+	}
+	// Probe funcs may access fixed offsets without checking length
+	if len(b) < ProbeLength {
+		_b := make([]byte, ProbeLength)
+		copy(_b, b)
+		b = _b
+	}
+	if self.Probe(b) {
+		score = ProbeScoreDefault
+	} else {
+		err = fmt.Errorf("%s: probe failed", name)
+	}
+	return
+}
+
+// Score each handler able to demux readers against b read from start of input.
+func (self *Handlers) ProbeBytes(b []byte, seekable bool) (handler RegisterHandler, results []ProbeResult, err error) {
+	best := 0
+	for _, h := range self.handlers {
+		if h.ReaderDemuxer == nil || (h.Probe == nil && h.ProbeScore == nil) {
+			continue
+		}
+		result := ProbeResult{Ext: h.Ext}
+		if result.Score, result.Err = h.probeScore(b, seekable); result.Score <= 0 {
+			result.Score = 0
+			if result.Err == nil {
+				result.Err = fmt.Errorf("%s: rejected", strings.TrimPrefix(h.Ext, "."))
+			}
+		}
+		if result.Score > best {
+			best = result.Score
+			handler = h
+		}
+		results = append(results, result)
+	}
+	if best == 0 {
+		err = &ProbeError{Results: results}
+	}
+	return
+}
+
+func readProbeBytes(r io.Reader) (b []byte, err error) {
+	b = make([]byte, ProbeLength)
+	var n int
+	if n, err = io.ReadFull(r, b); err != nil {
+		// input shorter than probe length
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		} else {
+			return
+		}
+	}
+	b = b[:n]
+	return
+}
+
+// Open demuxer by sniffing content of r, which has no name or extension to rely on.
+func (self *Handlers) OpenReader(r io.Reader) (demuxer av.Demuxer, err error) {
+	var b []byte
+	if b, err = readProbeBytes(r); err != nil {
+		return
+	}
+	var handler RegisterHandler
+	if handler, _, err = self.ProbeBytes(b, false); err != nil {
+		return
+	}
+	demuxer = handler.ReaderDemuxer(io.MultiReader(bytes.NewReader(b), r))
+	return
+}
+
+// Like OpenReader, demuxers requiring seek like mp4 are also considered.
+func (self *Handlers) OpenReadSeeker(r io.ReadSeeker) (demuxer av.Demuxer, err error) {
+	var b []byte
+	if b, err = readProbeBytes(r); err != nil {
+		return
+	}
+	var handler RegisterHandler
+	if handler, _, err = self.ProbeBytes(b, true); err != nil {
+		return
+	}
+	if _, err = r.Seek(0, 0); err != nil {
+		return
+	}
+	demuxer = handler.ReaderDemuxer(r)
+	return
+}
+
+func OpenReader(r io.Reader) (demuxer av.Demuxer, err error) {
+	return DefaultHandlers.OpenReader(r)
+}
+
+func OpenReadSeeker(r io.ReadSeeker) (demuxer av.Demuxer, err error) {
+	return DefaultHandlers.OpenReadSeeker(r)
+}
@@ -0,0 +1,149 @@
+package avutil_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/format/flv"
+	"github.com/nareix/joy4/format/mp4"
+	"github.com/nareix/joy4/format/ts"
+)
+
+// 1s of 25fps h264 muxed by muxer.
+func testMux(t *testing.T, muxer av.Muxer) {
+	sps, _ := hex.DecodeString("67640028acd940780227e5c05a808080a0000003002000000781e3062cb0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	video, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = muxer.WriteHeader([]av.CodecData{video}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		pkt := av.Packet{Time: time.Duration(i) * time.Second / 25, Data: []byte{0, 0, 0, 2, 0x41, 0x9a}}
+		if i == 0 {
+			pkt.IsKeyFrame = true
+			pkt.Data = []byte{0, 0, 0, 2, 0x65, 0x88}
+		}
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testHandlers() *avutil.Handlers {
+	handlers := &avutil.Handlers{}
+	// accepts anything with default score, loses to better matches
+	handlers.Add(func(h *avutil.RegisterHandler) {
+		h.Ext = ".any"
+		h.Probe = func(b []byte) bool { return len(b) > 0 && b[0] != 0 }
+		h.ReaderDemuxer = func(r io.Reader) av.Demuxer { return nil }
+	})
+	handlers.Add(mp4.Handler)
+	handlers.Add(ts.Handler)
+	handlers.Add(flv.Handler)
+	return handlers
+}
+
+func checkOpened(t *testing.T, demuxer av.Demuxer) {
+	if _, err := demuxer.Streams(); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := demuxer.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame {
+		t.Fatal("first packet not key frame")
+	}
+}
+
+func TestOpenReader(t *testing.T) {
+	handlers := testHandlers()
+
+	flvbuf := &bytes.Buffer{}
+	testMux(t, flv.NewMuxer(flvbuf))
+	demuxer, err := handlers.OpenReader(flvbuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := demuxer.(*flv.Demuxer); !ok {
+		t.Fatalf("flv opened by %T", demuxer)
+	}
+	checkOpened(t, demuxer)
+
+	tsbuf := &bytes.Buffer{}
+	testMux(t, ts.NewMuxer(tsbuf))
+	if demuxer, err = handlers.OpenReader(tsbuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := demuxer.(*ts.Demuxer); !ok {
+		t.Fatalf("ts opened by %T", demuxer)
+	}
+	checkOpened(t, demuxer)
+}
+
+func TestOpenReadSeeker(t *testing.T) {
+	handlers := testHandlers()
+
+	f, err := ioutil.TempFile("", "probe_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	testMux(t, mp4.NewMuxer(f))
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer, err := handlers.OpenReadSeeker(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := demuxer.(*mp4.Demuxer); !ok {
+		t.Fatalf("mp4 opened by %T", demuxer)
+	}
+	checkOpened(t, demuxer)
+
+	// mp4 needs seek, rejected with reason from OpenReader
+	_, err = handlers.OpenReader(bytes.NewReader(b))
+	if _, ok := err.(*avutil.ProbeError); !ok || !strings.Contains(err.Error(), "mp4: io.ReadSeeker required") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestProbeRejected(t *testing.T) {
+	_, err := testHandlers().OpenReader(bytes.NewReader(make([]byte, 100)))
+	perr, ok := err.(*avutil.ProbeError)
+	if !ok {
+		t.Fatalf("err=%v", err)
+	}
+	if len(perr.Results) != 4 {
+		t.Fatalf("got %d results", len(perr.Results))
+	}
+	for _, result := range perr.Results {
+		if result.Score != 0 || result.Err == nil {
+			t.Fatalf("%s score=%d err=%v", result.Ext, result.Score, result.Err)
+		}
+	}
+	for _, reason := range []string{"mp4:", "ts:", "flv:", "any:"} {
+		if !strings.Contains(err.Error(), reason) {
+			t.Fatalf("no reason of %s in %q", reason, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package av
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Sizes of buffers kept by BufferPool, larger ones are allocated normally.
+const (
+	minBufferSizeBits = 9  // 512B
+	maxBufferSizeBits = 24 // 16MB, max rtmp message size
+)
+
+// Reference counted packet data from BufferPool.
+//
+// Data of a packet read from demuxer with pooling enabled is owned by the
+// caller through one reference. Call Packet.Release after it's written or
+// dropped so the buffer can be reused. Keeping a packet after that, e.g: in
+// a queue, needs another reference taken with Packet.Ref. Buffers never
+// released are just collected by GC, so consumers unaware of pooling are safe.
+type Buffer struct {
+	Data []byte
+	refs int32
+	pool *BufferPool
+}
+
+func (self *Buffer) Ref() {
+	atomic.AddInt32(&self.refs, 1)
+}
+
+func (self *Buffer) Release() {
+	refs := atomic.AddInt32(&self.refs, -1)
+	if refs < 0 {
+		panic("av: Buffer released more times than referenced")
+	}
+	if refs == 0 && self.pool != nil {
+		self.pool.put(self)
+	}
+}
+
+// Buffers grouped by power of two sizes.
+type BufferPool struct {
+	pools [maxBufferSizeBits - minBufferSizeBits + 1]sync.Pool
+}
+
+func NewBufferPool() *BufferPool {
+	return &BufferPool{}
+}
+
+// Shared pool for demuxers with pooling turned on.
+var DefaultBufferPool = NewBufferPool()
+
+func bufferSizeIndex(n int) int {
+	i := bits.Len(uint(n-1)) - minBufferSizeBits
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// Get buffer with len(Data) == n and one reference.
+func (self *BufferPool) Get(n int) *Buffer {
+	i := bufferSizeIndex(n)
+	if i >= len(self.pools) {
+		return &Buffer{Data: make([]byte, n), refs: 1}
+	}
+	buf, _ := self.pools[i].Get().(*Buffer)
+	if buf == nil {
+		buf = &Buffer{Data: make([]byte, 1<<uint(i+minBufferSizeBits)), pool: self}
+	}
+	buf.Data = buf.Data[:n]
+	buf.refs = 1
+	return buf
+}
+
+func (self *BufferPool) put(buf *Buffer) {
+	buf.Data = buf.Data[:cap(buf.Data)]
+	self.pools[bufferSizeIndex(cap(buf.Data))].Put(buf)
+}
@@ -0,0 +1,153 @@
+package pktque
+
+import (
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+// Periods after which container timestamps wrap around.
+const (
+	WrapTS   = time.Duration(1<<33) * time.Second / 90000 // 33 bits of 90kHz, about 26.5h
+	WrapRTMP = time.Duration(1<<32) * time.Millisecond    // int32 milliseconds
+)
+
+type DiscontinuityType int
+
+const (
+	DiscontinuityWrap     DiscontinuityType = iota + 1 // timestamp wrapped around
+	DiscontinuityBackward                              // more than MaxBackward, e.g: encoder restarted
+	DiscontinuityGap                                   // forward jump larger than MaxGap
+)
+
+func (self DiscontinuityType) String() string {
+	switch self {
+	case DiscontinuityWrap:
+		return "wrap"
+	case DiscontinuityBackward:
+		return "backward"
+	case DiscontinuityGap:
+		return "gap"
+	}
+	return ""
+}
+
+// Reported by FixDiscontinuity when a stream jumps away from current timeline.
+type Discontinuity struct {
+	Type     DiscontinuityType
+	Idx      int8          // stream which jumped first, others follow silently
+	LastTime time.Duration // input time of last packet before jump
+	Time     time.Duration // input time of packet after jump
+	Offset   time.Duration // added to input time from now on
+}
+
+type discontinuityStream struct {
+	lasttime  time.Duration // input
+	lastout   time.Duration
+	lastdelta time.Duration
+	epoch     int
+	started   bool
+}
+
+// Rewrite wrapped, backward or gapped timestamps into a continuous timeline.
+//
+// All streams share one offset, which changes when a stream jumps. Other
+// streams switch to the new offset when they jump too, so A/V sync is kept
+// across encoder restarts.
+//
+// Small backward steps, e.g: A/V interleaving jitter or DTS of B-frames, are
+// passed through unchanged.
+type FixDiscontinuity struct {
+	MaxGap          time.Duration   // 10s if 0
+	MaxBackward     time.Duration   // 1s if 0
+	Wraps           []time.Duration // WrapTS and WrapRTMP if nil
+	OnDiscontinuity func(Discontinuity)
+
+	streams []discontinuityStream
+	offsets []time.Duration // of each epoch
+}
+
+func (self *FixDiscontinuity) maxGap() time.Duration {
+	if self.MaxGap <= 0 {
+		return time.Second * 10
+	}
+	return self.MaxGap
+}
+
+func (self *FixDiscontinuity) maxBackward() time.Duration {
+	if self.MaxBackward <= 0 {
+		return time.Second
+	}
+	return self.MaxBackward
+}
+
+// Returns wrap period if time jumped back by one.
+func (self *FixDiscontinuity) isWrap(lasttime, tm time.Duration) (period time.Duration, ok bool) {
+	wraps := self.Wraps
+	if wraps == nil {
+		wraps = []time.Duration{WrapTS, WrapRTMP}
+	}
+	for _, period = range wraps {
+		if delta := tm + period - lasttime; delta >= 0 && delta <= self.maxGap() {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+func (self *FixDiscontinuity) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if self.offsets == nil {
+		self.offsets = []time.Duration{0}
+	}
+	for int(pkt.Idx) >= len(self.streams) {
+		self.streams = append(self.streams, discontinuityStream{})
+	}
+	stream := &self.streams[pkt.Idx]
+	tm := pkt.Time
+	cur := len(self.offsets) - 1
+
+	if stream.started {
+		delta := tm - stream.lasttime
+		if delta < -self.maxBackward() || delta > self.maxGap() {
+			if stream.epoch < cur {
+				// jump already handled by other stream
+				stream.epoch = cur
+			} else {
+				ev := Discontinuity{
+					Idx:      pkt.Idx,
+					LastTime: stream.lasttime,
+					Time:     tm,
+				}
+				if period, ok := self.isWrap(stream.lasttime, tm); ok {
+					ev.Type = DiscontinuityWrap
+					ev.Offset = self.offsets[cur] + period
+				} else {
+					if delta < 0 {
+						ev.Type = DiscontinuityBackward
+					} else {
+						ev.Type = DiscontinuityGap
+					}
+					// continue from last packet with same interval
+					ev.Offset = stream.lastout + stream.lastdelta - tm
+				}
+				self.offsets = append(self.offsets, ev.Offset)
+				cur++
+				stream.epoch = cur
+				if self.OnDiscontinuity != nil {
+					self.OnDiscontinuity(ev)
+				}
+			}
+		} else if delta > 0 {
+			stream.lastdelta = delta
+		}
+	} else {
+		stream.epoch = cur
+		stream.started = true
+	}
+
+	stream.lasttime = tm
+	pkt.Time = tm + self.offsets[stream.epoch]
+	stream.lastout = pkt.Time
+	return
+}
@@ -0,0 +1,96 @@
+package pktque
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+type testDiscontinuity struct {
+	filter FixDiscontinuity
+	events []Discontinuity
+}
+
+func newTestDiscontinuity() *testDiscontinuity {
+	self := &testDiscontinuity{}
+	self.filter.OnDiscontinuity = func(ev Discontinuity) {
+		self.events = append(self.events, ev)
+	}
+	return self
+}
+
+func (self *testDiscontinuity) modify(t *testing.T, idx int8, tm time.Duration) time.Duration {
+	pkt := av.Packet{Idx: idx, Time: tm}
+	if _, err := self.filter.ModifyPacket(&pkt, testStreams, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	return pkt.Time
+}
+
+func TestDiscontinuityWrap(t *testing.T) {
+	d := newTestDiscontinuity()
+	start := WrapRTMP - time.Second
+	for i := 0; i < 50; i++ {
+		tm := start + time.Duration(i)*testFrame
+		want := tm
+		tm %= WrapRTMP
+		if out := d.modify(t, 0, tm); out != want {
+			t.Fatalf("video #%d time=%v want %v", i, out, want)
+		}
+		if out := d.modify(t, 1, tm); out != want {
+			t.Fatalf("audio #%d time=%v want %v", i, out, want)
+		}
+	}
+	if len(d.events) != 1 || d.events[0].Type != DiscontinuityWrap || d.events[0].Offset != WrapRTMP {
+		t.Fatalf("events %+v", d.events)
+	}
+}
+
+func TestDiscontinuityBackward(t *testing.T) {
+	d := newTestDiscontinuity()
+	for i := 0; i < 10; i++ {
+		tm := time.Second*100 + time.Duration(i)*testFrame
+		d.modify(t, 0, tm)
+		d.modify(t, 1, tm)
+	}
+	// encoder restarted from 0, video first
+	if out := d.modify(t, 0, 0); out != time.Second*100+10*testFrame {
+		t.Fatalf("video time=%v", out)
+	}
+	// audio follows with same offset
+	if out := d.modify(t, 1, testFrame); out != time.Second*100+11*testFrame {
+		t.Fatalf("audio time=%v", out)
+	}
+	if len(d.events) != 1 || d.events[0].Type != DiscontinuityBackward || d.events[0].Idx != 0 {
+		t.Fatalf("events %+v", d.events)
+	}
+}
+
+func TestDiscontinuityJitter(t *testing.T) {
+	d := newTestDiscontinuity()
+	// small backward steps of DTS are kept as is
+	for _, tm := range []time.Duration{0, testFrame * 2, testFrame*2 - time.Millisecond, testFrame * 3, testFrame * 2} {
+		if out := d.modify(t, 0, tm); out != tm {
+			t.Fatalf("time=%v want %v", out, tm)
+		}
+	}
+	if len(d.events) != 0 {
+		t.Fatalf("events %+v", d.events)
+	}
+}
+
+func TestDiscontinuityGap(t *testing.T) {
+	d := newTestDiscontinuity()
+	d.modify(t, 0, 0)
+	d.modify(t, 0, testFrame)
+	if out := d.modify(t, 0, time.Second*30); out != testFrame*2 {
+		t.Fatalf("time=%v", out)
+	}
+	if out := d.modify(t, 0, time.Second*30+testFrame); out != testFrame*3 {
+		t.Fatalf("time=%v", out)
+	}
+	if len(d.events) != 1 || d.events[0].Type != DiscontinuityGap {
+		t.Fatalf("events %+v", d.events)
+	}
+}
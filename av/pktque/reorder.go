@@ -0,0 +1,196 @@
+package pktque
+
+import (
+	"io"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+// Reorder depth used if ReorderDemuxer.Depth is 0, enough for B-pyramid of common encoders.
+const DefaultReorderDepth = 4
+
+type reorderStream struct {
+	pkts      []av.Packet     // decode order
+	pts       []time.Duration // of pkts, sorted
+	offset    time.Duration   // added to PTS, DTS = sorted PTS
+	gotoffset bool
+	lastdts   time.Duration
+	gotdts    bool
+}
+
+func ptsOf(pkt av.Packet) time.Duration {
+	return pkt.Time + pkt.CompositionTime
+}
+
+func (self *reorderStream) push(pkt av.Packet) {
+	pts := ptsOf(pkt)
+	i := len(self.pts)
+	for i > 0 && self.pts[i-1] > pts {
+		i--
+	}
+	self.pts = append(self.pts, 0)
+	copy(self.pts[i+1:], self.pts[i:])
+	self.pts[i] = pts
+	self.pkts = append(self.pkts, pkt)
+}
+
+// Decode order kept, DTS is the n-th smallest PTS starting from the first
+// PTS, and PTS is delayed by offset so that it's not smaller than DTS of same
+// frame. DTS is never negative, e.g: for mp4 or flv muxers.
+func (self *reorderStream) popMakeDTS(depth int) (pkt av.Packet) {
+	if !self.gotoffset {
+		i := depth
+		if i >= len(self.pts) {
+			i = len(self.pts) - 1
+		}
+		self.offset = self.pts[i] - self.pts[0]
+		self.gotoffset = true
+	}
+
+	pkt = self.pkts[0]
+	self.pkts = self.pkts[1:]
+	pts := ptsOf(pkt) + self.offset
+	dts := self.pts[0]
+	self.pts = self.pts[1:]
+
+	if self.gotdts && dts <= self.lastdts {
+		dts = self.lastdts + 1
+	}
+	self.lastdts = dts
+	self.gotdts = true
+
+	pkt.Time = dts
+	pkt.CompositionTime = pts - dts
+	if pkt.CompositionTime < 0 {
+		// depth too small for this stream
+		pkt.CompositionTime = 0
+	}
+	return
+}
+
+// Smallest PTS first, Time is set to PTS.
+func (self *reorderStream) popByPTS() (pkt av.Packet) {
+	pts := self.pts[0]
+	self.pts = self.pts[1:]
+	for i := range self.pkts {
+		if ptsOf(self.pkts[i]) == pts {
+			pkt = self.pkts[i]
+			self.pkts = append(self.pkts[:i], self.pkts[i+1:]...)
+			break
+		}
+	}
+	pkt.Time = pts
+	pkt.CompositionTime = 0
+	return
+}
+
+// Reorder frames of video streams with B-frames, other streams are passed through.
+// Video packets are delayed by Depth frames.
+type ReorderDemuxer struct {
+	av.Demuxer
+	Depth int // max frames between decoding and presenting a frame
+	// Rebuild DTS in Time and set CompositionTime instead of reordering, for
+	// sources giving PTS only, e.g: rtsp or annexb h264 with B-frames.
+	// DTS starts from the first PTS, video is presented later by up to Depth
+	// frames, as CompositionTime of the first frame.
+	MakeDTS bool
+
+	streams    []*reorderStream // nil for non-video stream
+	gotstreams bool
+	out        []av.Packet
+	eof        bool
+}
+
+func NewReorderDemuxer(demuxer av.Demuxer, makedts bool) *ReorderDemuxer {
+	return &ReorderDemuxer{
+		Demuxer: demuxer,
+		Depth:   DefaultReorderDepth,
+		MakeDTS: makedts,
+	}
+}
+
+func (self *ReorderDemuxer) pop(stream *reorderStream) {
+	var pkt av.Packet
+	if self.MakeDTS {
+		pkt = stream.popMakeDTS(self.depth())
+	} else {
+		pkt = stream.popByPTS()
+	}
+	self.out = append(self.out, pkt)
+}
+
+// Output all frames of stream, time base may change after discontinuity.
+func (self *ReorderDemuxer) flush(stream *reorderStream) {
+	for len(stream.pkts) > 0 {
+		self.pop(stream)
+	}
+	*stream = reorderStream{}
+}
+
+func (self *ReorderDemuxer) depth() int {
+	if self.Depth <= 0 {
+		return DefaultReorderDepth
+	}
+	return self.Depth
+}
+
+func (self *ReorderDemuxer) push(pkt av.Packet) {
+	var stream *reorderStream
+	if int(pkt.Idx) < len(self.streams) {
+		stream = self.streams[pkt.Idx]
+	}
+	if stream == nil {
+		self.out = append(self.out, pkt)
+		return
+	}
+	if pkt.IsDiscontinuity() || pkt.CodecData != nil {
+		self.flush(stream)
+	}
+	stream.push(pkt)
+	if len(stream.pkts) > self.depth() {
+		self.pop(stream)
+	}
+}
+
+func (self *ReorderDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if !self.gotstreams {
+		var streams []av.CodecData
+		if streams, err = self.Demuxer.Streams(); err != nil {
+			return
+		}
+		self.streams = make([]*reorderStream, len(streams))
+		for i, stream := range streams {
+			if stream.Type().IsVideo() {
+				self.streams[i] = &reorderStream{}
+			}
+		}
+		self.gotstreams = true
+	}
+
+	for len(self.out) == 0 {
+		if self.eof {
+			err = io.EOF
+			return
+		}
+		var _pkt av.Packet
+		if _pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			if err != io.EOF {
+				return
+			}
+			err = nil
+			self.eof = true
+			for _, stream := range self.streams {
+				if stream != nil {
+					self.flush(stream)
+				}
+			}
+			continue
+		}
+		self.push(_pkt)
+	}
+
+	pkt = self.out[0]
+	self.out = self.out[1:]
+	return
+}
@@ -0,0 +1,97 @@
+package pktque
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec/fake"
+)
+
+var testStreams = []av.CodecData{
+	fake.CodecData{CodecType_: av.H264},
+	fake.CodecData{CodecType_: av.AAC},
+}
+
+type testDemuxer struct {
+	streams []av.CodecData
+	pkts    []av.Packet
+}
+
+func (self *testDemuxer) Streams() ([]av.CodecData, error) {
+	return self.streams, nil
+}
+
+func (self *testDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if len(self.pkts) == 0 {
+		err = io.EOF
+		return
+	}
+	pkt = self.pkts[0]
+	self.pkts = self.pkts[1:]
+	return
+}
+
+func readAll(t *testing.T, demuxer av.Demuxer) (pkts []av.Packet) {
+	for {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+const testFrame = time.Second / 25
+
+// Decode order I0 P3 B1 B2 P6 B4 B5 ..., with PTS only.
+func testReorderPackets(start time.Duration) (pkts []av.Packet) {
+	order := []int{0, 3, 1, 2, 6, 4, 5, 9, 7, 8}
+	for _, n := range order {
+		pkts = append(pkts, av.Packet{
+			Time:       start + time.Duration(n)*testFrame,
+			IsKeyFrame: n == 0,
+		})
+	}
+	return
+}
+
+func TestReorderMakeDTS(t *testing.T) {
+	for _, start := range []time.Duration{0, time.Second * 5} {
+		in := testReorderPackets(start)
+		demuxer := NewReorderDemuxer(&testDemuxer{streams: testStreams[:1], pkts: in}, true)
+		out := readAll(t, demuxer)
+		if len(out) != len(in) {
+			t.Fatalf("got %d packets", len(out))
+		}
+		if out[0].Time != start {
+			t.Fatalf("first dts=%v", out[0].Time)
+		}
+		offset := out[0].Time + out[0].CompositionTime - in[0].Time
+		for i, pkt := range out {
+			if i > 0 && pkt.Time <= out[i-1].Time {
+				t.Fatalf("packet #%d dts=%v not increasing", i, pkt.Time)
+			}
+			if pkt.CompositionTime < 0 {
+				t.Fatalf("packet #%d cts=%v", i, pkt.CompositionTime)
+			}
+			// decode order kept, pts shifted by same offset
+			if pkt.Time+pkt.CompositionTime != in[i].Time+offset {
+				t.Fatalf("packet #%d pts=%v want %v", i, pkt.Time+pkt.CompositionTime, in[i].Time+offset)
+			}
+		}
+	}
+}
+
+func TestReorderByPTS(t *testing.T) {
+	demuxer := NewReorderDemuxer(&testDemuxer{streams: testStreams[:1], pkts: testReorderPackets(0)}, false)
+	for i, pkt := range readAll(t, demuxer) {
+		if pkt.Time != time.Duration(i)*testFrame || pkt.CompositionTime != 0 {
+			t.Fatalf("packet #%d time=%v", i, pkt.Time)
+		}
+	}
+}
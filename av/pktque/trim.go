@@ -0,0 +1,175 @@
+package pktque
+
+import (
+	"io"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+// Keep packets between Start and End, with time rebased to zero.
+//
+// With video, output starts at first video key frame at or after Start and
+// earlier audio is dropped. TrimDemuxer starts at the key frame at or before
+// Start instead.
+type Trim struct {
+	Start time.Duration
+	End   time.Duration // no end if 0
+
+	started bool
+	base    time.Duration
+	atkey   bool // input begins at key frame at or before Start
+}
+
+func hasVideo(streams []av.CodecData) bool {
+	for _, stream := range streams {
+		if stream.Type().IsVideo() {
+			return true
+		}
+	}
+	return false
+}
+
+func isVideoPacket(pkt *av.Packet, streams []av.CodecData) bool {
+	return int(pkt.Idx) < len(streams) && streams[pkt.Idx].Type().IsVideo()
+}
+
+// Packet is at or after End.
+func (self *Trim) isEnd(pkt *av.Packet) bool {
+	return self.End > 0 && pkt.Time >= self.End
+}
+
+func (self *Trim) ModifyPacket(pkt *av.Packet, streams []av.CodecData, videoidx int, audioidx int) (drop bool, err error) {
+	if !self.started {
+		if hasVideo(streams) {
+			self.started = isVideoPacket(pkt, streams) && pkt.IsKeyFrame && (self.atkey || pkt.Time >= self.Start)
+		} else {
+			self.started = pkt.Time >= self.Start
+		}
+		if !self.started {
+			drop = true
+			return
+		}
+		self.base = pkt.Time
+	}
+
+	if pkt.Time < self.base || self.isEnd(pkt) {
+		drop = true
+		return
+	}
+	pkt.Time -= self.base
+	return
+}
+
+type timeSeeker interface {
+	SeekToTime(time.Duration) error
+}
+
+// Cut Start to End out of demuxer, see Trim. Demuxers able to seek like mp4
+// are seeked to Start, otherwise packets are read from beginning and GOP
+// containing Start is buffered. ReadPacket returns io.EOF after all streams
+// passed End.
+type TrimDemuxer struct {
+	av.Demuxer
+	Trim Trim
+
+	streams []av.CodecData
+	seeked  bool
+	gop     []av.Packet // buffered from last key frame before Start
+	state   []int       // of each stream, streams never seen are not waited for
+}
+
+const (
+	trimSeen = iota + 1
+	trimEnded
+)
+
+func NewTrimDemuxer(demuxer av.Demuxer, start, end time.Duration) *TrimDemuxer {
+	return &TrimDemuxer{
+		Demuxer: demuxer,
+		Trim:    Trim{Start: start, End: end},
+	}
+}
+
+func (self *TrimDemuxer) prepare() (err error) {
+	if self.streams, err = self.Demuxer.Streams(); err != nil {
+		return
+	}
+	self.state = make([]int, len(self.streams))
+	self.Trim.atkey = true
+	if seeker, ok := self.Demuxer.(timeSeeker); ok {
+		if err = seeker.SeekToTime(self.Trim.Start); err != nil {
+			return
+		}
+		return
+	}
+	if !hasVideo(self.streams) {
+		return
+	}
+
+	// read until Start, keeping GOP of last key frame
+	for {
+		var pkt av.Packet
+		if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			return
+		}
+		isvideo := isVideoPacket(&pkt, self.streams)
+		if isvideo && pkt.IsKeyFrame && pkt.Time <= self.Trim.Start {
+			self.gop = self.gop[:0]
+		}
+		self.gop = append(self.gop, pkt)
+		if isvideo && pkt.Time > self.Trim.Start {
+			break
+		}
+	}
+	return
+}
+
+func (self *TrimDemuxer) allEnded() bool {
+	ended := false
+	for _, state := range self.state {
+		switch state {
+		case trimSeen:
+			return false
+		case trimEnded:
+			ended = true
+		}
+	}
+	return ended
+}
+
+func (self *TrimDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if !self.seeked {
+		if err = self.prepare(); err != nil {
+			return
+		}
+		self.seeked = true
+	}
+
+	for {
+		if self.allEnded() {
+			err = io.EOF
+			return
+		}
+		if len(self.gop) > 0 {
+			pkt = self.gop[0]
+			self.gop = self.gop[1:]
+		} else if pkt, err = self.Demuxer.ReadPacket(); err != nil {
+			return
+		}
+		if int(pkt.Idx) < len(self.state) {
+			if self.Trim.isEnd(&pkt) {
+				self.state[pkt.Idx] = trimEnded
+			} else if self.state[pkt.Idx] == 0 {
+				self.state[pkt.Idx] = trimSeen
+			}
+		}
+		var drop bool
+		if drop, err = self.Trim.ModifyPacket(&pkt, self.streams, -1, -1); err != nil {
+			return
+		}
+		if !drop {
+			return
+		}
+	}
+}
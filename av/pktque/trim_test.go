@@ -0,0 +1,96 @@
+package pktque
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+// 25fps video with 1s gop and audio, 10s long.
+func testTrimPackets() (pkts []av.Packet) {
+	for i := 0; i < 250; i++ {
+		tm := time.Duration(i) * testFrame
+		pkts = append(pkts,
+			av.Packet{Idx: 0, Time: tm, IsKeyFrame: i%25 == 0},
+			av.Packet{Idx: 1, Time: tm},
+		)
+	}
+	return
+}
+
+// Seeks to key frame at or before time like mp4.Demuxer.
+type testSeekDemuxer struct {
+	testDemuxer
+}
+
+func (self *testSeekDemuxer) SeekToTime(tm time.Duration) (err error) {
+	start := 0
+	for i, pkt := range self.pkts {
+		if pkt.Idx == 0 && pkt.IsKeyFrame && pkt.Time <= tm {
+			start = i
+		}
+	}
+	self.pkts = self.pkts[start:]
+	return
+}
+
+func checkTrimmed(t *testing.T, pkts []av.Packet, dur time.Duration) {
+	if len(pkts) == 0 {
+		t.Fatal("no packets")
+	}
+	if pkts[0].Idx != 0 || !pkts[0].IsKeyFrame || pkts[0].Time != 0 {
+		t.Fatalf("first packet %+v", pkts[0])
+	}
+	for _, pkt := range pkts {
+		if pkt.Time < 0 || pkt.Time >= dur {
+			t.Fatalf("packet time=%v", pkt.Time)
+		}
+	}
+	if last := pkts[len(pkts)-1]; last.Time != dur-testFrame {
+		t.Fatalf("last packet time=%v", last.Time)
+	}
+}
+
+func TestTrimFilter(t *testing.T) {
+	// from key frame at 3s to 5s
+	trim := &Trim{Start: time.Second*2 + time.Second/2, End: time.Second * 5}
+	demuxer := &FilterDemuxer{
+		Demuxer: &testDemuxer{streams: testStreams, pkts: testTrimPackets()},
+		Filter:  trim,
+	}
+	checkTrimmed(t, readAll(t, demuxer), time.Second*2)
+}
+
+func TestTrimAudioOnly(t *testing.T) {
+	var in []av.Packet
+	for _, pkt := range testTrimPackets() {
+		if pkt.Idx == 1 {
+			pkt.Idx = 0
+			in = append(in, pkt)
+		}
+	}
+	demuxer := &FilterDemuxer{
+		Demuxer: &testDemuxer{streams: testStreams[1:], pkts: in},
+		Filter:  &Trim{Start: time.Second, End: time.Second * 2},
+	}
+	out := readAll(t, demuxer)
+	if len(out) != 25 || out[0].Time != 0 {
+		t.Fatalf("got %d packets", len(out))
+	}
+}
+
+func TestTrimDemuxerBuffered(t *testing.T) {
+	// from key frame at 2s before Start to 4s
+	demuxer := NewTrimDemuxer(&testDemuxer{streams: testStreams, pkts: testTrimPackets()}, time.Second*2+time.Second/2, time.Second*4)
+	checkTrimmed(t, readAll(t, demuxer), time.Second*2)
+}
+
+func TestTrimDemuxerSeek(t *testing.T) {
+	seeker := &testSeekDemuxer{testDemuxer{streams: testStreams, pkts: testTrimPackets()}}
+	demuxer := NewTrimDemuxer(seeker, time.Second*2+time.Second/2, time.Second*4)
+	checkTrimmed(t, readAll(t, demuxer), time.Second*2)
+	if len(seeker.pkts) == 0 {
+		t.Fatal("read until end of input after End")
+	}
+}
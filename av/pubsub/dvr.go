@@ -0,0 +1,666 @@
+package pubsub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/format/ts"
+)
+
+var ErrDVRClosed = errors.New("pubsub: dvr closed")
+
+// Time-shift of a live stream, packets are written to rolling mpegts
+// segments in Dir, and DVRCursor reads them from any past wallclock time
+// on to the live edge.
+//
+// Segments start at video key frames. Oldest segments are removed after
+// MaxDuration or MaxDiskSize is exceeded, checked when a segment completes,
+// so a segment more may be kept on disk.
+type DVR struct {
+	Dir             string
+	SegmentDuration time.Duration // 10s if 0
+	MaxDuration     time.Duration // 1h if 0
+	MaxDiskSize     int64         // no limit if 0
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	segments []*dvrSegment // oldest first
+	seq      int
+	started  bool
+	finished bool // recording ended, cursors get io.EOF at end
+	closed   bool
+}
+
+type dvrSegment struct {
+	seq     int
+	path    string
+	streams []av.CodecData
+	base    time.Duration // time of first packet
+	wall    time.Time     // wallclock of first packet
+	dur     time.Duration // of last packet after base
+	size    int64         // flushed to file
+	done    bool
+
+	discontinuity bool // started by timestamp jump back or discontinuity
+}
+
+func (self *dvrSegment) end() time.Time {
+	return self.wall.Add(self.dur)
+}
+
+func NewDVR(dir string) *DVR {
+	dvr := &DVR{
+		Dir: dir,
+	}
+	dvr.cond = sync.NewCond(&dvr.lock)
+	return dvr
+}
+
+func (self *DVR) segmentDuration() time.Duration {
+	if self.SegmentDuration <= 0 {
+		return time.Second * 10
+	}
+	return self.SegmentDuration
+}
+
+func (self *DVR) maxDuration() time.Duration {
+	if self.MaxDuration <= 0 {
+		return time.Hour
+	}
+	return self.MaxDuration
+}
+
+// Wallclock range available for DVRCursor.
+func (self *DVR) Available() (start time.Time, end time.Time) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.segments) > 0 {
+		start = self.segments[0].wall
+		end = self.segments[len(self.segments)-1].end()
+	}
+	return
+}
+
+// Disk usage of segments.
+func (self *DVR) DiskSize() (size int64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, seg := range self.segments {
+		size += seg.size
+	}
+	return
+}
+
+// Counts bytes written to segment file.
+type dvrWriter struct {
+	f *os.File
+	n int64
+}
+
+func (self *dvrWriter) Write(b []byte) (n int, err error) {
+	n, err = self.f.Write(b)
+	self.n += int64(n)
+	return
+}
+
+type dvrRecorder struct {
+	dvr      *DVR
+	streams  []av.CodecData
+	hasvideo bool
+	seg      *dvrSegment
+	w        *dvrWriter
+	bw       *bufio.Writer
+	muxer    *ts.Muxer
+}
+
+// Write packets read from demuxer, e.g: a QueueCursor, until it returns
+// error or DVR closed. Returns nil at io.EOF, cursors then end with io.EOF
+// after reading all segments.
+func (self *DVR) Record(demuxer av.Demuxer) (err error) {
+	self.lock.Lock()
+	if self.started {
+		self.lock.Unlock()
+		err = fmt.Errorf("pubsub: dvr already recording")
+		return
+	}
+	self.started = true
+	self.lock.Unlock()
+
+	rec := &dvrRecorder{dvr: self}
+	defer func() {
+		rec.finish()
+		self.lock.Lock()
+		self.finished = true
+		self.cond.Broadcast()
+		self.lock.Unlock()
+	}()
+
+	if err = os.MkdirAll(self.Dir, 0755); err != nil {
+		return
+	}
+	if rec.streams, err = demuxer.Streams(); err != nil {
+		return
+	}
+	rec.hasvideo = hasVideo(rec.streams)
+
+	for {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		err = rec.writePacket(pkt)
+		pkt.Release()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func hasVideo(streams []av.CodecData) bool {
+	for _, stream := range streams {
+		if stream.Type().IsVideo() {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *dvrRecorder) isStart(pkt av.Packet) bool {
+	if !self.hasvideo {
+		return true
+	}
+	return int(pkt.Idx) < len(self.streams) && self.streams[pkt.Idx].Type().IsVideo() && pkt.IsKeyFrame
+}
+
+func (self *dvrRecorder) writePacket(pkt av.Packet) (err error) {
+	dvr := self.dvr
+	seg := self.seg
+	newstreams := av.ApplyCodecDataChange(self.streams, pkt)
+
+	if self.isStart(pkt) {
+		if seg == nil ||
+			pkt.Time-seg.base >= dvr.segmentDuration() ||
+			pkt.Time < seg.base+seg.dur || pkt.IsDiscontinuity() {
+			self.streams = newstreams
+			if err = self.newSegment(pkt); err != nil {
+				return
+			}
+			seg = self.seg
+			pkt.CodecData = nil
+		}
+	}
+	if seg == nil {
+		// wait for first key frame
+		self.streams = newstreams
+		return
+	}
+	self.streams = newstreams
+
+	mpkt := pkt
+	mpkt.Time -= seg.base
+	if err = self.muxer.WritePacket(mpkt); err != nil {
+		return
+	}
+	if err = self.bw.Flush(); err != nil {
+		return
+	}
+
+	dvr.lock.Lock()
+	if dur := pkt.Time - seg.base; dur > seg.dur {
+		seg.dur = dur
+	}
+	seg.size = self.w.n
+	closed := dvr.closed
+	dvr.cond.Broadcast()
+	dvr.lock.Unlock()
+
+	if closed {
+		err = ErrDVRClosed
+	}
+	return
+}
+
+// Complete current segment and start next one from pkt.
+func (self *dvrRecorder) newSegment(pkt av.Packet) (err error) {
+	dvr := self.dvr
+
+	dvr.lock.Lock()
+	dvr.seq++
+	seq := dvr.seq
+	dvr.lock.Unlock()
+
+	seg := &dvrSegment{
+		seq:     seq,
+		path:    filepath.Join(dvr.Dir, fmt.Sprintf("%d.ts", seq)),
+		streams: self.streams,
+		base:    pkt.Time,
+	}
+	if pkt.IsDiscontinuity() || self.seg != nil && pkt.Time < self.seg.base+self.seg.dur {
+		seg.discontinuity = true
+	}
+	if seg.wall, _ = pkt.Wallclock(); seg.wall.IsZero() {
+		seg.wall = time.Now()
+	}
+
+	var f *os.File
+	if f, err = os.Create(seg.path); err != nil {
+		return
+	}
+	w := &dvrWriter{f: f}
+	bw := bufio.NewWriter(w)
+	muxer := ts.NewMuxer(bw)
+	if err = muxer.WriteHeader(self.streams); err != nil {
+		f.Close()
+		os.Remove(seg.path)
+		return
+	}
+
+	self.finish()
+	self.seg = seg
+	self.w = w
+	self.bw = bw
+	self.muxer = muxer
+
+	dvr.lock.Lock()
+	if dvr.closed {
+		dvr.lock.Unlock()
+		self.finish()
+		os.Remove(seg.path)
+		err = ErrDVRClosed
+		return
+	}
+	dvr.segments = append(dvr.segments, seg)
+	removed := dvr.retain()
+	dvr.cond.Broadcast()
+	dvr.lock.Unlock()
+
+	for _, old := range removed {
+		os.Remove(old.path)
+	}
+	return
+}
+
+// Close file of current segment.
+func (self *dvrRecorder) finish() {
+	if self.seg == nil {
+		return
+	}
+	self.bw.Flush()
+	self.w.f.Close()
+	self.dvr.lock.Lock()
+	self.seg.size = self.w.n
+	self.seg.done = true
+	self.dvr.lock.Unlock()
+}
+
+// Called with lock held, drops oldest segments over limits.
+func (self *DVR) retain() (removed []*dvrSegment) {
+	var size int64
+	for _, seg := range self.segments {
+		size += seg.size
+	}
+	for len(self.segments) > 1 {
+		oldest := self.segments[0]
+		end := self.segments[len(self.segments)-1].end()
+		overdur := end.Sub(self.segments[1].wall) >= self.maxDuration()
+		oversize := self.MaxDiskSize > 0 && size > self.MaxDiskSize
+		if !overdur && !oversize {
+			break
+		}
+		size -= oldest.size
+		removed = append(removed, oldest)
+		self.segments = self.segments[1:]
+	}
+	return
+}
+
+// Stop recording and remove all segments, cursors get io.EOF.
+func (self *DVR) Close() (err error) {
+	self.lock.Lock()
+	self.closed = true
+	segments := self.segments
+	self.segments = nil
+	self.cond.Broadcast()
+	self.lock.Unlock()
+
+	for _, seg := range segments {
+		os.Remove(seg.path)
+	}
+	return
+}
+
+// Create cursor position at key frame before wallclock time now minus dur,
+// or at oldest segment if dur is larger than available.
+func (self *DVR) DelayedTime(dur time.Duration) *DVRCursor {
+	return self.At(time.Now().Add(-dur))
+}
+
+// Create cursor position at key frame before wallclock time tm.
+func (self *DVR) At(tm time.Time) *DVRCursor {
+	return &DVRCursor{
+		dvr:  self,
+		wall: tm,
+	}
+}
+
+// Reads segment file up to flushed size, waits at end until segment done.
+type dvrSegmentReader struct {
+	cursor *DVRCursor
+	seg    *dvrSegment
+	f      *os.File
+	pos    int64
+}
+
+func (self *dvrSegmentReader) Read(b []byte) (n int, err error) {
+	dvr := self.cursor.dvr
+	dvr.lock.Lock()
+	for self.pos >= self.seg.size && !self.seg.done && !dvr.closed && !self.cursor.closed {
+		dvr.cond.Wait()
+	}
+	avail := self.seg.size - self.pos
+	closed := dvr.closed || self.cursor.closed
+	dvr.lock.Unlock()
+
+	if closed || avail <= 0 {
+		err = io.EOF
+		return
+	}
+	if int64(len(b)) > avail {
+		b = b[:avail]
+	}
+	n, err = self.f.ReadAt(b, self.pos)
+	self.pos += int64(n)
+	if err != nil {
+		if n > 0 {
+			err = nil
+		} else if err != io.EOF && self.isClosed() {
+			// file closed by DVRCursor.Close
+			err = io.EOF
+		}
+	}
+	return
+}
+
+func (self *dvrSegmentReader) isClosed() bool {
+	dvr := self.cursor.dvr
+	dvr.lock.Lock()
+	defer dvr.lock.Unlock()
+	return self.cursor.closed
+}
+
+// Reads segments of DVR from given wallclock time on, following live edge
+// like QueueCursor. Jumps over removed segments if reading is slower than
+// retention, first packet after that is marked as discontinuity.
+type DVRCursor struct {
+	dvr     *DVR
+	wall    time.Time
+	opened  bool
+	closed  bool
+	streams []av.CodecData
+
+	seg     *dvrSegment
+	reader  *dvrSegmentReader
+	demuxer *ts.Demuxer
+	changed []bool // codec data changed by segment, set on next packet
+	gop     []av.Packet
+	pending []av.Packet   // demuxed until segment start packet
+	tsbase  time.Duration // demuxed time of segment start packet
+
+	discontinuity bool
+}
+
+// Called with lock held, waits for first segment if none.
+func (self *DVRCursor) firstSegment() (seg *dvrSegment, err error) {
+	dvr := self.dvr
+	for len(dvr.segments) == 0 {
+		if dvr.closed || self.closed || dvr.finished {
+			err = io.EOF
+			return
+		}
+		dvr.cond.Wait()
+	}
+	seg = dvr.segments[0]
+	for _, s := range dvr.segments {
+		if s.wall.After(self.wall) {
+			break
+		}
+		seg = s
+	}
+	return
+}
+
+// Called with lock held, segment after current one, waits if not started.
+func (self *DVRCursor) nextSegment() (seg *dvrSegment, err error) {
+	dvr := self.dvr
+	for {
+		if dvr.closed || self.closed {
+			err = io.EOF
+			return
+		}
+		for _, s := range dvr.segments {
+			if s.seq > self.seg.seq {
+				seg = s
+				if s.seq != self.seg.seq+1 {
+					self.discontinuity = true
+				}
+				return
+			}
+		}
+		if dvr.finished {
+			err = io.EOF
+			return
+		}
+		dvr.cond.Wait()
+	}
+}
+
+func (self *DVRCursor) openSegment(seg *dvrSegment) (err error) {
+	var f *os.File
+	if f, err = os.Open(seg.path); err != nil {
+		return
+	}
+	self.dvr.lock.Lock()
+	if self.reader != nil {
+		self.reader.f.Close()
+	}
+	self.seg = seg
+	self.reader = &dvrSegmentReader{
+		cursor: self,
+		seg:    seg,
+		f:      f,
+	}
+	if self.closed {
+		f.Close()
+	}
+	self.dvr.lock.Unlock()
+	self.demuxer = ts.NewDemuxer(self.reader)
+	if err = self.readStart(seg); err != nil {
+		return
+	}
+
+	if self.streams == nil {
+		self.streams = seg.streams
+		self.changed = make([]bool, len(seg.streams))
+		return
+	}
+	for i, stream := range seg.streams {
+		if i < len(self.streams) && !reflect.DeepEqual(stream, self.streams[i]) {
+			self.changed[i] = true
+		}
+	}
+	self.streams = seg.streams
+	return
+}
+
+// Demux up to packet segment started at, its time maps to seg.base.
+// Audio can be demuxed before it, as video is sent at next video packet.
+func (self *DVRCursor) readStart(seg *dvrSegment) (err error) {
+	hasvideo := hasVideo(seg.streams)
+	self.pending = self.pending[:0]
+	self.tsbase = 0
+	for {
+		var pkt av.Packet
+		if pkt, err = self.demuxer.ReadPacket(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		self.pending = append(self.pending, pkt)
+		isvideo := int(pkt.Idx) < len(seg.streams) && seg.streams[pkt.Idx].Type().IsVideo()
+		if !hasvideo || isvideo && pkt.IsKeyFrame {
+			self.tsbase = pkt.Time
+			return
+		}
+	}
+}
+
+// Open segment of start time, and buffer GOP of key frame before it.
+func (self *DVRCursor) open() (err error) {
+	var start time.Duration
+	for {
+		var seg *dvrSegment
+		self.dvr.lock.Lock()
+		if seg, err = self.firstSegment(); err == nil {
+			start = seg.base + self.wall.Sub(seg.wall)
+			if end := seg.base + seg.dur; start > end {
+				start = end
+			}
+		}
+		self.dvr.lock.Unlock()
+		if err != nil {
+			return
+		}
+		if err = self.openSegment(seg); err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return
+		}
+		// removed after found
+	}
+	hasvideo := hasVideo(self.streams)
+	for {
+		var pkt av.Packet
+		if pkt, err = self.readSegmentPacket(); err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			return
+		}
+		isvideo := int(pkt.Idx) < len(self.streams) && self.streams[pkt.Idx].Type().IsVideo()
+		if !hasvideo {
+			if pkt.Time >= start {
+				self.gop = append(self.gop, pkt)
+				break
+			}
+			continue
+		}
+		if isvideo && pkt.IsKeyFrame && pkt.Time <= start {
+			self.gop = self.gop[:0]
+		}
+		self.gop = append(self.gop, pkt)
+		if isvideo && pkt.Time > start {
+			break
+		}
+	}
+	return
+}
+
+// Packet of current segment with recorded time.
+func (self *DVRCursor) readSegmentPacket() (pkt av.Packet, err error) {
+	if len(self.pending) > 0 {
+		pkt = self.pending[0]
+		self.pending = self.pending[1:]
+	} else if pkt, err = self.demuxer.ReadPacket(); err != nil {
+		return
+	}
+	pkt.Time += self.seg.base - self.tsbase
+	return
+}
+
+func (self *DVRCursor) Streams() (streams []av.CodecData, err error) {
+	if !self.opened {
+		if err = self.open(); err != nil {
+			return
+		}
+		self.opened = true
+	}
+	streams = self.streams
+	return
+}
+
+func (self *DVRCursor) ReadPacket() (pkt av.Packet, err error) {
+	if !self.opened {
+		if err = self.open(); err != nil {
+			return
+		}
+		self.opened = true
+	}
+
+	if len(self.gop) > 0 {
+		pkt = self.gop[0]
+		self.gop = self.gop[1:]
+	} else {
+		for {
+			if pkt, err = self.readSegmentPacket(); err == nil {
+				break
+			}
+			if err != io.EOF {
+				return
+			}
+			var seg *dvrSegment
+			self.dvr.lock.Lock()
+			seg, err = self.nextSegment()
+			self.dvr.lock.Unlock()
+			if err != nil {
+				return
+			}
+			if err = self.openSegment(seg); err != nil {
+				if os.IsNotExist(err) {
+					// removed after found
+					self.discontinuity = true
+					continue
+				}
+				return
+			}
+			if seg.discontinuity {
+				self.discontinuity = true
+			}
+		}
+	}
+
+	if int(pkt.Idx) < len(self.changed) && self.changed[pkt.Idx] {
+		pkt.CodecData = self.streams[pkt.Idx]
+		self.changed[pkt.Idx] = false
+	}
+	if self.discontinuity {
+		pkt.SetDiscontinuity()
+		self.discontinuity = false
+	}
+	return
+}
+
+// Stop reading, ReadPacket waiting at live edge returns io.EOF.
+func (self *DVRCursor) Close() (err error) {
+	self.dvr.lock.Lock()
+	self.closed = true
+	if self.reader != nil {
+		self.reader.f.Close()
+	}
+	self.dvr.cond.Broadcast()
+	self.dvr.lock.Unlock()
+	return
+}
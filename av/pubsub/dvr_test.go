@@ -0,0 +1,191 @@
+package pubsub
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/h264parser"
+)
+
+func testStreams(t *testing.T) []av.CodecData {
+	sps, _ := hex.DecodeString("67640028acd940780227e5c05a808080a0000003002000000781e3062cb0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	video, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AOT_AAC_LC,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []av.CodecData{video, audio}
+}
+
+// 25fps video with 1s gop and audio, wallclock from start plus packet time.
+func testPackets(start time.Time, from, to int) (pkts []av.Packet) {
+	for i := from; i < to; i++ {
+		tm := time.Duration(i) * time.Second / 25
+		video := av.Packet{Idx: 0, Time: tm, Data: []byte{0, 0, 0, 2, 0x41, byte(i)}}
+		if i%25 == 0 {
+			video.IsKeyFrame = true
+			video.Data = []byte{0, 0, 0, 2, 0x65, byte(i)}
+		}
+		video.SetWallclock(start.Add(tm))
+		pkts = append(pkts, video, av.Packet{Idx: 1, Time: tm, Data: []byte{0x21, byte(i)}})
+	}
+	return
+}
+
+func TestDVR(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	que := NewQueue()
+	que.SetMaxGopCount(100)
+	que.WriteHeader(testStreams(t))
+	dvr := NewDVR(dir)
+	dvr.SegmentDuration = time.Second
+	dvr.MaxDuration = time.Second * 5
+	recorded := make(chan error, 1)
+	go func() {
+		recorded <- dvr.Record(que.Oldest())
+	}()
+
+	start := time.Now().Add(-time.Second * 10)
+	for _, pkt := range testPackets(start, 0, 250) {
+		que.WritePacket(pkt)
+	}
+
+	for {
+		if _, end := dvr.Available(); !end.Before(start.Add(time.Second * 9)) {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// follows live edge
+	cursor := dvr.At(start.Add(time.Second*8 + time.Second/2))
+	streams, err := cursor.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 2 {
+		t.Fatalf("streams=%d", len(streams))
+	}
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		for _, pkt := range testPackets(start, 250, 300) {
+			que.WritePacket(pkt)
+		}
+		que.Close()
+	}()
+
+	var first, last av.Packet
+	videos := 0
+	for {
+		pkt, err := cursor.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Idx != 0 {
+			continue
+		}
+		if videos == 0 {
+			first = pkt
+		} else if pkt.Time <= last.Time {
+			t.Fatalf("time %v after %v", pkt.Time, last.Time)
+		}
+		last = pkt
+		videos++
+	}
+	cursor.Close()
+	if err := <-recorded; err != nil {
+		t.Fatal(err)
+	}
+
+	if !first.IsKeyFrame || first.Time != time.Second*8 {
+		t.Fatalf("first key=%v time=%v", first.IsKeyFrame, first.Time)
+	}
+	// last frame is held by ts demuxer until segment done
+	if last.Time != time.Second*299/25 || videos != 100 {
+		t.Fatalf("last=%v videos=%d", last.Time, videos)
+	}
+
+	avstart, avend := dvr.Available()
+	if got := avend.Sub(avstart); got > time.Second*6 || got < time.Second*5 {
+		t.Fatalf("available %v", got)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 6 {
+		t.Fatalf("files=%d", len(files))
+	}
+
+	dvr.Close()
+	if files, _ = ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("files=%d after close", len(files))
+	}
+}
+
+func TestDVRTimestampJump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dvr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	que := NewQueue()
+	que.SetMaxGopCount(100)
+	que.WriteHeader(testStreams(t))
+	start := time.Now().Add(-time.Second * 10)
+	// restarted publisher, timestamps from 0 again
+	pkts := append(testPackets(start, 0, 50), testPackets(start.Add(time.Second*2), 0, 50)...)
+	for _, pkt := range pkts {
+		que.WritePacket(pkt)
+	}
+	que.Close()
+
+	dvr := NewDVR(dir)
+	if err = dvr.Record(que.Oldest()); err != nil {
+		t.Fatal(err)
+	}
+	defer dvr.Close()
+
+	cursor := dvr.At(start)
+	defer cursor.Close()
+	n := 0
+	for {
+		pkt, err := cursor.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.IsDiscontinuity() != (n == 100) {
+			t.Fatalf("packet#%d discontinuity=%v", n, pkt.IsDiscontinuity())
+		}
+		if n == 100 && pkt.Time != 0 {
+			t.Fatalf("packet#%d time=%v after jump", n, pkt.Time)
+		}
+		n++
+	}
+	if n != 200 {
+		t.Fatalf("got %d packets", n)
+	}
+}
@@ -0,0 +1,409 @@
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+var (
+	ErrPublisherExists   = errors.New("pubsub: stream already has publisher")
+	ErrPublisherReplaced = errors.New("pubsub: publisher replaced by new one")
+	ErrNoPublisher       = errors.New("pubsub: no publisher for stream")
+	ErrHubClosed         = errors.New("pubsub: hub closed")
+)
+
+// What Hub does when stream already has a publisher.
+type PublishPolicy int
+
+const (
+	PublishReject   PublishPolicy = iota // new publisher gets ErrPublisherExists
+	PublishTakeover                      // old publisher gets ErrPublisherReplaced, its subscribers io.EOF
+)
+
+// Queues of streams keyed by name, e.g: path of rtmp or http url.
+//
+// Stream is created by first Publish or Subscribe, and removed after it has
+// neither publisher nor subscribers for IdleTimeout.
+type Hub struct {
+	Policy      PublishPolicy
+	IdleTimeout time.Duration
+
+	NewQueue  func() *Queue             // to set buffer limits, NewQueue if nil
+	NewCursor func(*Queue) *QueueCursor // start position of subscribers, LatestKeyFrame if nil
+
+	// Lifecycle callbacks, called outside of hub lock.
+	OnPublish     func(name string)
+	OnUnpublish   func(name string)
+	OnSubscribe   func(name string, subscribers int)
+	OnUnsubscribe func(name string, subscribers int)
+	OnRemove      func(name string) // idle stream removed
+
+	lock    sync.Mutex
+	streams map[string]*hubStream
+	closed  bool
+}
+
+type hubStream struct {
+	name        string
+	publisher   *Publisher
+	announced   bool          // publisher wrote header
+	changed     chan struct{} // closed and renewed when publisher changes
+	subscribers int
+	idletimer   *time.Timer
+}
+
+// Called with lock held, wakes subscribers waiting for publisher to check again.
+func (self *hubStream) notify() {
+	close(self.changed)
+	self.changed = make(chan struct{})
+}
+
+func NewHub() *Hub {
+	return &Hub{}
+}
+
+// Callbacks collected under lock and called after unlock.
+type hubEvents []func()
+
+func (self hubEvents) call() {
+	for _, fn := range self {
+		fn()
+	}
+}
+
+func (self *Hub) getStream(name string) *hubStream {
+	if self.streams == nil {
+		self.streams = map[string]*hubStream{}
+	}
+	stream := self.streams[name]
+	if stream == nil {
+		stream = &hubStream{
+			name:    name,
+			changed: make(chan struct{}),
+		}
+		self.streams[name] = stream
+	}
+	if stream.idletimer != nil {
+		stream.idletimer.Stop()
+		stream.idletimer = nil
+	}
+	return stream
+}
+
+// Called with lock held after publisher or subscriber left.
+func (self *Hub) checkIdle(stream *hubStream, events *hubEvents) {
+	if stream.publisher != nil || stream.subscribers > 0 {
+		return
+	}
+	if self.IdleTimeout <= 0 {
+		self.removeStream(stream, events)
+		return
+	}
+	stream.idletimer = time.AfterFunc(self.IdleTimeout, func() {
+		var events hubEvents
+		self.lock.Lock()
+		if self.streams[stream.name] == stream && stream.publisher == nil && stream.subscribers == 0 {
+			self.removeStream(stream, &events)
+		}
+		self.lock.Unlock()
+		events.call()
+	})
+}
+
+func (self *Hub) removeStream(stream *hubStream, events *hubEvents) {
+	delete(self.streams, stream.name)
+	if self.OnRemove != nil {
+		*events = append(*events, func() { self.OnRemove(stream.name) })
+	}
+}
+
+// Register publisher of stream name, streams are written into queue by
+// returned Publisher, which must be closed after publishing ends.
+func (self *Hub) Publish(name string) (publisher *Publisher, err error) {
+	var events hubEvents
+	defer func() {
+		events.call()
+	}()
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if self.closed {
+		err = ErrHubClosed
+		return
+	}
+	stream := self.getStream(name)
+	if old := stream.publisher; old != nil {
+		if self.Policy != PublishTakeover {
+			err = ErrPublisherExists
+			return
+		}
+		old.replaced()
+		if self.OnUnpublish != nil {
+			events = append(events, func() { self.OnUnpublish(name) })
+		}
+	}
+
+	var que *Queue
+	if self.NewQueue != nil {
+		que = self.NewQueue()
+	} else {
+		que = NewQueue()
+	}
+	publisher = &Publisher{
+		hub:    self,
+		stream: stream,
+		Queue:  que,
+	}
+	stream.publisher = publisher
+	stream.announced = false
+	stream.notify()
+	if self.OnPublish != nil {
+		events = append(events, func() { self.OnPublish(name) })
+	}
+	return
+}
+
+// Called by Publisher after WriteHeader, so that subscribers see streams.
+func (self *Hub) announce(publisher *Publisher) {
+	self.lock.Lock()
+	stream := publisher.stream
+	if stream.publisher == publisher && !stream.announced {
+		stream.announced = true
+		stream.notify()
+	}
+	self.lock.Unlock()
+}
+
+func (self *Hub) unpublish(publisher *Publisher) {
+	var events hubEvents
+	self.lock.Lock()
+	stream := publisher.stream
+	if stream.publisher == publisher {
+		stream.publisher = nil
+		stream.announced = false
+		stream.notify()
+		if self.OnUnpublish != nil {
+			events = append(events, func() { self.OnUnpublish(stream.name) })
+		}
+		self.checkIdle(stream, &events)
+	}
+	self.lock.Unlock()
+	events.call()
+}
+
+// Subscribe stream name, waiting up to timeout for publisher to appear.
+// Returned Subscriber must be closed after reading.
+func (self *Hub) Subscribe(name string, timeout time.Duration) (subscriber *Subscriber, err error) {
+	return self.SubscribeWith(name, timeout, self.NewCursor)
+}
+
+// Like Subscribe, with start position of this subscriber given by newcursor.
+func (self *Hub) SubscribeWith(name string, timeout time.Duration, newcursor func(*Queue) *QueueCursor) (subscriber *Subscriber, err error) {
+	var events hubEvents
+	self.lock.Lock()
+	if self.closed {
+		self.lock.Unlock()
+		err = ErrHubClosed
+		return
+	}
+	stream := self.getStream(name)
+	stream.subscribers++
+	subscribers := stream.subscribers
+	self.lock.Unlock()
+
+	if self.OnSubscribe != nil {
+		self.OnSubscribe(name, subscribers)
+	}
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	// publisher may leave or be replaced while waiting, check again after
+	// every change
+	for {
+		self.lock.Lock()
+		if self.closed {
+			self.lock.Unlock()
+			err = ErrHubClosed
+			break
+		}
+		if publisher := stream.publisher; publisher != nil && stream.announced {
+			self.lock.Unlock()
+			var cursor *QueueCursor
+			if newcursor != nil {
+				cursor = newcursor(publisher.Queue)
+			} else {
+				cursor = publisher.Queue.LatestKeyFrame()
+			}
+			cursor.Track()
+			subscriber = &Subscriber{
+				QueueCursor: cursor,
+				hub:         self,
+				stream:      stream,
+			}
+			return
+		}
+		changed := stream.changed
+		self.lock.Unlock()
+
+		if timer == nil {
+			err = ErrNoPublisher
+			break
+		}
+		select {
+		case <-changed:
+			continue
+		case <-timer:
+			err = ErrNoPublisher
+		}
+		break
+	}
+
+	self.lock.Lock()
+	self.leave(stream, &events)
+	self.lock.Unlock()
+	events.call()
+	return
+}
+
+// Called with lock held when subscriber leaves.
+func (self *Hub) leave(stream *hubStream, events *hubEvents) {
+	stream.subscribers--
+	subscribers := stream.subscribers
+	if self.OnUnsubscribe != nil {
+		*events = append(*events, func() { self.OnUnsubscribe(stream.name, subscribers) })
+	}
+	self.checkIdle(stream, events)
+}
+
+// Publisher and subscriber count of stream name.
+func (self *Hub) Stat(name string) (published bool, subscribers int, ok bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var stream *hubStream
+	if stream, ok = self.streams[name]; !ok {
+		return
+	}
+	published = stream.publisher != nil
+	subscribers = stream.subscribers
+	return
+}
+
+// Queue stats of streams having publisher, keyed by name.
+func (self *Hub) Stats() (stats map[string]QueueStats) {
+	self.lock.Lock()
+	queues := map[string]*Queue{}
+	for name, stream := range self.streams {
+		if stream.publisher != nil {
+			queues[name] = stream.publisher.Queue
+		}
+	}
+	self.lock.Unlock()
+
+	stats = map[string]QueueStats{}
+	for name, que := range queues {
+		stats[name] = que.Stats()
+	}
+	return
+}
+
+// Names of streams in hub.
+func (self *Hub) Names() (names []string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for name := range self.streams {
+		names = append(names, name)
+	}
+	return
+}
+
+// Close queues of all publishers, later Publish and Subscribe fail, and
+// subscribers waiting for publisher get ErrHubClosed.
+func (self *Hub) Close() {
+	self.lock.Lock()
+	self.closed = true
+	var publishers []*Publisher
+	for _, stream := range self.streams {
+		if stream.publisher != nil {
+			publishers = append(publishers, stream.publisher)
+		}
+		stream.notify()
+	}
+	self.lock.Unlock()
+	for _, publisher := range publishers {
+		publisher.Close()
+	}
+}
+
+// Writes packets of one publishing session into its own Queue.
+type Publisher struct {
+	*Queue
+	hub        *Hub
+	stream     *hubStream
+	isreplaced int32
+	closeonce  sync.Once
+}
+
+func (self *Publisher) replaced() {
+	atomic.StoreInt32(&self.isreplaced, 1)
+	self.Queue.Close()
+}
+
+func (self *Publisher) WriteHeader(streams []av.CodecData) (err error) {
+	if atomic.LoadInt32(&self.isreplaced) != 0 {
+		err = ErrPublisherReplaced
+		return
+	}
+	if err = self.Queue.WriteHeader(streams); err != nil {
+		return
+	}
+	self.hub.announce(self)
+	return
+}
+
+func (self *Publisher) WritePacket(pkt av.Packet) (err error) {
+	if atomic.LoadInt32(&self.isreplaced) != 0 {
+		err = ErrPublisherReplaced
+		return
+	}
+	return self.Queue.WritePacket(pkt)
+}
+
+// Unregister publisher, subscribers reading its queue get io.EOF.
+func (self *Publisher) Close() (err error) {
+	self.closeonce.Do(func() {
+		self.Queue.Close()
+		self.hub.unpublish(self)
+	})
+	return
+}
+
+// Reads queue of stream publisher at time of Subscribe. After publisher
+// leaves or is replaced, ReadPacket returns io.EOF, subscribe again then.
+type Subscriber struct {
+	*QueueCursor
+	hub       *Hub
+	stream    *hubStream
+	closeonce sync.Once
+}
+
+func (self *Subscriber) Close() (err error) {
+	self.closeonce.Do(func() {
+		self.QueueCursor.Close()
+		var events hubEvents
+		self.hub.lock.Lock()
+		self.hub.leave(self.stream, &events)
+		self.hub.lock.Unlock()
+		events.call()
+	})
+	return
+}
@@ -0,0 +1,207 @@
+package pubsub
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testPublish(t *testing.T, hub *Hub, name string) *Publisher {
+	publisher, err := hub.Publish(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = publisher.WriteHeader(testStreams(t)); err != nil {
+		t.Fatal(err)
+	}
+	return publisher
+}
+
+type testSubscribe struct {
+	subscriber *Subscriber
+	err        error
+}
+
+func goSubscribe(hub *Hub, name string, timeout time.Duration) <-chan testSubscribe {
+	done := make(chan testSubscribe, 1)
+	go func() {
+		subscriber, err := hub.Subscribe(name, timeout)
+		done <- testSubscribe{subscriber, err}
+	}()
+	return done
+}
+
+// Wait until n subscribers joined stream name.
+func waitSubscribers(t *testing.T, hub *Hub, name string, n int) {
+	for i := 0; i < 1000; i++ {
+		if _, subscribers, _ := hub.Stat(name); subscribers == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no %d subscribers", n)
+}
+
+func TestHubTakeover(t *testing.T) {
+	hub := NewHub()
+	hub.Policy = PublishTakeover
+	old := testPublish(t, hub, "live")
+	sub, err := hub.Subscribe("live", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	publisher := testPublish(t, hub, "live")
+	defer publisher.Close()
+	if err = old.WritePacket(testPackets(time.Now(), 0, 1)[0]); err != ErrPublisherReplaced {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err = sub.ReadPacket(); err != io.EOF {
+		t.Fatalf("err=%v", err)
+	}
+	// old publisher leaving doesn't unregister new one
+	old.Close()
+	if published, _, _ := hub.Stat("live"); !published {
+		t.Fatal("new publisher unregistered")
+	}
+
+	sub2, err := hub.Subscribe("live", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub2.Close()
+	publisher.WritePacket(testPackets(time.Now(), 0, 1)[0])
+	if _, err = sub2.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHubReject(t *testing.T) {
+	hub := NewHub()
+	publisher := testPublish(t, hub, "live")
+	if _, err := hub.Publish("live"); err != ErrPublisherExists {
+		t.Fatalf("err=%v", err)
+	}
+	publisher.Close()
+	publisher = testPublish(t, hub, "live")
+	publisher.Close()
+}
+
+func TestHubWaitingSubscriber(t *testing.T) {
+	hub := NewHub()
+	done := goSubscribe(hub, "live", time.Second*10)
+	waitSubscribers(t, hub, "live", 1)
+
+	// first publisher leaves before WriteHeader, subscriber keeps waiting
+	publisher, err := hub.Publish("live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher.Close()
+	select {
+	case res := <-done:
+		t.Fatalf("subscribe returned err=%v", res.err)
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	publisher = testPublish(t, hub, "live")
+	defer publisher.Close()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		defer res.subscriber.Close()
+		publisher.WritePacket(testPackets(time.Now(), 0, 1)[0])
+		if _, err = res.subscriber.ReadPacket(); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("subscriber missed second publisher")
+	}
+
+	// timeout
+	if _, err = hub.Subscribe("other", time.Millisecond*10); err != ErrNoPublisher {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestHubIdleRemove(t *testing.T) {
+	hub := NewHub()
+	hub.IdleTimeout = time.Millisecond * 50
+	var lock sync.Mutex
+	var removed []string
+	hub.OnRemove = func(name string) {
+		lock.Lock()
+		removed = append(removed, name)
+		lock.Unlock()
+	}
+
+	publisher := testPublish(t, hub, "live")
+	sub, err := hub.Subscribe("live", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher.Close()
+	sub.Close()
+	if _, _, ok := hub.Stat("live"); !ok {
+		t.Fatal("removed before IdleTimeout")
+	}
+
+	// new publisher within IdleTimeout keeps stream
+	publisher = testPublish(t, hub, "live")
+	time.Sleep(time.Millisecond * 100)
+	if _, _, ok := hub.Stat("live"); !ok {
+		t.Fatal("removed with publisher")
+	}
+	publisher.Close()
+
+	for i := 0; ; i++ {
+		if _, _, ok := hub.Stat("live"); !ok {
+			break
+		}
+		if i == 1000 {
+			t.Fatal("idle stream not removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(removed) != 1 || removed[0] != "live" {
+		t.Fatalf("removed %v", removed)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	publisher := testPublish(t, hub, "live")
+	defer publisher.Close()
+	sub, err := hub.Subscribe("live", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	done := goSubscribe(hub, "other", time.Second*10)
+	waitSubscribers(t, hub, "other", 1)
+
+	hub.Close()
+	select {
+	case res := <-done:
+		if res.err != ErrHubClosed {
+			t.Fatalf("err=%v", res.err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("waiting subscriber not woken by Close")
+	}
+	if _, err = sub.ReadPacket(); err != io.EOF {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err = hub.Publish("live2"); err != ErrHubClosed {
+		t.Fatalf("err=%v", err)
+	}
+	if _, err = hub.Subscribe("live", 0); err != ErrHubClosed {
+		t.Fatalf("err=%v", err)
+	}
+}
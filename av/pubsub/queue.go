@@ -2,6 +2,7 @@
 package pubsub
 
 import (
+	"fmt"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/av/pktque"
 	"io"
@@ -28,9 +29,17 @@ type Queue struct {
 	lock                     *sync.RWMutex
 	cond                     *sync.Cond
 	curgopcount, maxgopcount int
+	maxsize                  int
+	maxduration              time.Duration
+	poppedsize               int64 // bytes of all discarded packets
 	streams                  []av.CodecData
 	videoidx                 int
 	closed                   bool
+
+	stats     []queueStream
+	lastwrite time.Time
+	counter   ByteCounter
+	cursors   map[*QueueCursor]bool // tracked and not closed
 }
 
 func NewQueue() *Queue {
@@ -40,6 +49,7 @@ func NewQueue() *Queue {
 	q.lock = &sync.RWMutex{}
 	q.cond = sync.NewCond(q.lock.RLocker())
 	q.videoidx = -1
+	q.cursors = map[*QueueCursor]bool{}
 	return q
 }
 
@@ -50,14 +60,85 @@ func (self *Queue) SetMaxGopCount(n int) {
 	return
 }
 
+// Limit total bytes of buffered packet data, 0 means no limit.
+func (self *Queue) SetMaxBufferSize(n int) {
+	self.lock.Lock()
+	self.maxsize = n
+	self.lock.Unlock()
+}
+
+// Buffered time span of queues without video if SetMaxBufferDuration not called.
+const DefaultMaxAudioBufferDuration = time.Second * 10
+
+// Limit time span of buffered packets, 0 means no limit with video, or
+// DefaultMaxAudioBufferDuration for audio only streams, which have no GOP
+// to count.
+func (self *Queue) SetMaxBufferDuration(dur time.Duration) {
+	self.lock.Lock()
+	self.maxduration = dur
+	self.lock.Unlock()
+}
+
+// Packet count, bytes of packet data and time span currently buffered.
+func (self *Queue) Buffered() (count int, size int, dur time.Duration) {
+	self.lock.RLock()
+	count, size, dur = self.buf.Count, self.buf.Size, self.duration()
+	self.lock.RUnlock()
+	return
+}
+
+func (self *Queue) duration() time.Duration {
+	if self.buf.Count == 0 {
+		return 0
+	}
+	return self.buf.Get(self.buf.Tail-1).Time - self.buf.Get(self.buf.Head).Time
+}
+
+func (self *Queue) maxDuration() time.Duration {
+	if self.maxduration == 0 && self.videoidx == -1 {
+		return DefaultMaxAudioBufferDuration
+	}
+	return self.maxduration
+}
+
+// Any of GOP count, size and duration limits exceeded.
+func (self *Queue) overLimit() bool {
+	return self.curgopcount >= self.maxgopcount ||
+		(self.maxsize > 0 && self.buf.Size > self.maxsize) ||
+		(self.maxDuration() > 0 && self.duration() > self.maxDuration())
+}
+
+// Discard oldest packet.
+func (self *Queue) pop() {
+	pkt := self.buf.Pop()
+	if pkt.Idx == int8(self.videoidx) && pkt.IsKeyFrame {
+		self.curgopcount--
+	}
+	self.poppedsize += int64(len(pkt.Data))
+	pkt.Release()
+}
+
+// Video key frame after oldest packet.
+func (self *Queue) nextKeyFrame() (pos pktque.BufPos, ok bool) {
+	for pos = self.buf.Head + 1; pos.LT(self.buf.Tail); pos++ {
+		if isKeyFrame(self.buf.Get(pos), self.videoidx) {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
 func (self *Queue) WriteHeader(streams []av.CodecData) error {
 	self.lock.Lock()
 
 	self.streams = streams
+	self.stats = make([]queueStream, len(streams))
 	for i, stream := range streams {
 		if stream.Type().IsVideo() {
 			self.videoidx = i
 		}
+		self.stats[i].Type = stream.Type()
 	}
 	self.cond.Broadcast()
 
@@ -75,6 +156,7 @@ func (self *Queue) Close() (err error) {
 	self.lock.Lock()
 
 	self.closed = true
+	self.cursors = map[*QueueCursor]bool{}
 	self.cond.Broadcast()
 
 	self.lock.Unlock()
@@ -82,23 +164,39 @@ func (self *Queue) Close() (err error) {
 }
 
 // Put packet into buffer, old packets will be discared.
+// Queue holds its own reference of pooled packet data until it's discarded.
 func (self *Queue) WritePacket(pkt av.Packet) (err error) {
 	self.lock.Lock()
 
+	pkt.Ref()
 	self.buf.Push(pkt)
+	// subscribers joining later start with new codec data
+	self.streams = av.ApplyCodecDataChange(self.streams, pkt)
+	if int(pkt.Idx) < len(self.stats) {
+		stream := &self.stats[pkt.Idx]
+		if pkt.CodecData != nil {
+			stream.Type = pkt.CodecData.Type()
+		}
+		stream.update(pkt)
+	}
+	self.lastwrite = time.Now()
 	// 包的下标是视频类型 && 关键帧
 	if pkt.Idx == int8(self.videoidx) && pkt.IsKeyFrame {
 		self.curgopcount++
 	}
 
-	for self.curgopcount >= self.maxgopcount && self.buf.Count > 1 {
-		pkt := self.buf.Pop()  // 环形队列，丢弃旧的帧
-		if pkt.Idx == int8(self.videoidx) && pkt.IsKeyFrame {
-			self.curgopcount--  // 关键帧,curgopcount减一
-		}
-		if self.curgopcount < self.maxgopcount {
-			break  // 符合条件,退出
+	for self.overLimit() && self.buf.Count > 1 {
+		if self.videoidx != -1 && self.curgopcount < self.maxgopcount {
+			// size or duration limit, discard whole GOP so that oldest packet
+			// is a key frame, unless latest GOP alone exceeds limit
+			if pos, ok := self.nextKeyFrame(); ok {
+				for self.buf.Head.LT(pos) {
+					self.pop()
+				}
+				continue
+			}
 		}
+		self.pop()  // 环形队列，丢弃旧的帧
 	}
 	//println("shrink", self.curgopcount, self.maxgopcount, self.buf.Head, self.buf.Tail, "count", self.buf.Count, "size", self.buf.Size)
 
@@ -108,17 +206,78 @@ func (self *Queue) WritePacket(pkt av.Packet) (err error) {
 	return
 }
 
+// What QueueCursor does when packets not read yet are discarded from Queue.
+type OverrunPolicy int
+
+const (
+	// Skip to next video key frame, first packet read after it is marked as discontinuity.
+	OverrunResync OverrunPolicy = iota
+	// Resync too, but return *OverrunError once first.
+	OverrunReturnError
+	// Continue from oldest packet even if it's not a key frame.
+	OverrunSkip
+)
+
+// Returned by QueueCursor.ReadPacket with OverrunReturnError policy, caller may disconnect.
+type OverrunError struct {
+	Packets int // discarded before read
+	Bytes   int
+}
+
+func (self *OverrunError) Error() string {
+	return fmt.Sprintf("pubsub: cursor overrun, %d packets %d bytes dropped", self.Packets, self.Bytes)
+}
+
 type QueueCursor struct {
 	que    *Queue
 	pos    pktque.BufPos
 	gotpos bool
 	init   func(buf *pktque.Buf, videoidx int) pktque.BufPos
+
+	policy     OverrunPolicy
+	byteoffset int64 // bytes written to queue before pos
+	resync     bool          // skip to next video key frame
+	resyncdrop bool          // packets skipped by resync are counted as dropped
+	overrun    *OverrunError // not returned yet
+	dropped    OverrunError  // total
+
+	maxlatency    time.Duration
+	discontinuity bool // mark next packet
+
+	packets  int64 // read
+	bytes    int64
+	lasttime time.Duration
+	counter  ByteCounter
+	closed   bool
 }
 
 func (self *Queue) newCursor() *QueueCursor {
-	return &QueueCursor{
+	cursor := &QueueCursor{
 		que: self,
 	}
+	return cursor
+}
+
+// Count cursor as subscriber in Queue.Stats, until Close is called or Queue
+// closed. Cursors not tracked are not referenced by Queue and need no Close.
+func (self *QueueCursor) Track() {
+	que := self.que
+	que.lock.Lock()
+	if !self.closed && !que.closed {
+		que.cursors[self] = true
+	}
+	que.lock.Unlock()
+}
+
+// Remove cursor from subscribers of Queue.Stats, ReadPacket returns io.EOF then.
+func (self *QueueCursor) Close() (err error) {
+	que := self.que
+	que.lock.Lock()
+	delete(que.cursors, self)
+	self.closed = true
+	que.cond.Broadcast()
+	que.lock.Unlock()
+	return
 }
 
 // Create cursor position at latest packet.
@@ -176,6 +335,135 @@ func (self *Queue) DelayedGopCount(n int) *QueueCursor {
 	return cursor
 }
 
+func isKeyFrame(pkt av.Packet, videoidx int) bool {
+	return videoidx != -1 && pkt.Idx == int8(videoidx) && pkt.IsKeyFrame
+}
+
+// Latest video key frame, or latest packet without video.
+func lastKeyFrame(buf *pktque.Buf, videoidx int) (pos pktque.BufPos, ok bool) {
+	for pos = buf.Tail - 1; buf.IsValidPos(pos); pos-- {
+		if videoidx == -1 || isKeyFrame(buf.Get(pos), videoidx) {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+// Create cursor position at latest video key frame, so that viewer starts
+// without waiting for next one. If none is buffered, packets before next key
+// frame are skipped.
+func (self *Queue) LatestKeyFrame() *QueueCursor {
+	cursor := self.newCursor()
+	cursor.init = func(buf *pktque.Buf, videoidx int) pktque.BufPos {
+		if pos, ok := lastKeyFrame(buf, videoidx); ok {
+			return pos
+		}
+		cursor.resync = videoidx != -1
+		return buf.Tail
+	}
+	return cursor
+}
+
+// Create cursor position at video key frame whose time is nearest to latest
+// packet time minus latency.
+func (self *Queue) DelayedKeyFrame(latency time.Duration) *QueueCursor {
+	cursor := self.newCursor()
+	cursor.init = func(buf *pktque.Buf, videoidx int) pktque.BufPos {
+		end, ok := lastKeyFrame(buf, videoidx)
+		if !ok {
+			cursor.resync = videoidx != -1
+			return buf.Tail
+		}
+		target := buf.Get(buf.Tail-1).Time - latency
+		best := end
+		diff := func(pos pktque.BufPos) time.Duration {
+			d := buf.Get(pos).Time - target
+			if d < 0 {
+				return -d
+			}
+			return d
+		}
+		for i := end; buf.IsValidPos(i); i-- {
+			if videoidx == -1 || isKeyFrame(buf.Get(i), videoidx) {
+				if diff(i) < diff(best) {
+					best = i
+				}
+			}
+		}
+		return best
+	}
+	return cursor
+}
+
+// Jump to latest key frame when packets read are older than latest buffered
+// one by more than latency, 0 means never. Jumps are marked as discontinuity.
+func (self *QueueCursor) SetMaxLatency(latency time.Duration) {
+	self.maxlatency = latency
+}
+
+func (self *QueueCursor) catchUp() {
+	buf := self.que.buf
+	if buf.Get(buf.Tail-1).Time-buf.Get(self.pos).Time <= self.maxlatency {
+		return
+	}
+	pos, ok := lastKeyFrame(buf, self.que.videoidx)
+	if !ok || !pos.GT(self.pos) {
+		return
+	}
+	for ; self.pos.LT(pos); self.pos++ {
+		self.byteoffset += int64(len(buf.Get(self.pos).Data))
+	}
+	self.discontinuity = true
+}
+
+func (self *QueueCursor) SetOverrunPolicy(policy OverrunPolicy) {
+	self.policy = policy
+}
+
+// Total packets and bytes dropped by overruns.
+func (self *QueueCursor) Dropped() (packets int, bytes int) {
+	return self.dropped.Packets, self.dropped.Bytes
+}
+
+// Count packets skipped since last overrun.
+func (self *QueueCursor) drop(packets int, bytes int64) {
+	if self.overrun == nil {
+		self.overrun = &OverrunError{}
+	}
+	self.overrun.Packets += packets
+	self.overrun.Bytes += int(bytes)
+	self.dropped.Packets += packets
+	self.dropped.Bytes += int(bytes)
+}
+
+// Position is discarded, jump to oldest packet.
+func (self *QueueCursor) handleOverrun() {
+	que := self.que
+	self.drop(int(que.buf.Head-self.pos), que.poppedsize-self.byteoffset)
+	self.pos = que.buf.Head
+	self.byteoffset = que.poppedsize
+	if self.policy != OverrunSkip && que.videoidx != -1 {
+		self.resync = true
+		self.resyncdrop = true
+	}
+}
+
+func (self *QueueCursor) initPos() {
+	buf := self.que.buf
+	self.pos = self.init(buf, self.que.videoidx)  // 获取起点位置
+	if self.pos.LT(buf.Head) {
+		self.pos = buf.Head
+	} else if self.pos.GT(buf.Tail) {
+		self.pos = buf.Tail
+	}
+	self.byteoffset = self.que.poppedsize
+	for i := buf.Head; i.LT(self.pos); i++ {
+		self.byteoffset += int64(len(buf.Get(i).Data))
+	}
+	self.gotpos = true
+}
+
 func (self *QueueCursor) Streams() (streams []av.CodecData, err error) {
 	self.que.cond.L.Lock()
 	for self.que.streams == nil && !self.que.closed {
@@ -191,23 +479,65 @@ func (self *QueueCursor) Streams() (streams []av.CodecData, err error) {
 }
 
 // ReadPacket will not consume packets in Queue, it's just a cursor.
+// Caller owns a reference of pooled packet data, see av.Buffer.
 // ReadPacket不消耗队列的元素，仅仅是一个游标，进行移动
 func (self *QueueCursor) ReadPacket() (pkt av.Packet, err error) {
 	self.que.cond.L.Lock()
 	buf := self.que.buf
 	if !self.gotpos {
-		self.pos = self.init(buf, self.que.videoidx)  // 获取起点位置
-		self.gotpos = true
+		self.initPos()
 	}
 	for {
+		if self.closed {
+			err = io.EOF
+			break
+		}
 		if self.pos.LT(buf.Head) {
-			self.pos = buf.Head
+			self.handleOverrun()
 		} else if self.pos.GT(buf.Tail) {
 			self.pos = buf.Tail
 		}
 		if buf.IsValidPos(self.pos) {
+			if self.maxlatency > 0 && !self.resync {
+				self.catchUp()
+			}
 			pkt = buf.Get(self.pos)  // 读取成功，退出
 			self.pos++
+			self.byteoffset += int64(len(pkt.Data))
+			if self.resync {
+				if !isKeyFrame(pkt, self.que.videoidx) {
+					// new cursors waiting for first key frame lose nothing
+					if self.resyncdrop {
+						self.drop(1, int64(len(pkt.Data)))
+					}
+					continue
+				}
+				self.resync = false
+				self.resyncdrop = false
+			}
+			if self.overrun != nil {
+				if self.policy == OverrunReturnError {
+					err = self.overrun
+					self.overrun = nil
+					self.discontinuity = true
+					self.pos--
+					self.byteoffset -= int64(len(pkt.Data))
+					pkt = av.Packet{}
+					break
+				}
+				self.overrun = nil
+				self.discontinuity = true
+			}
+			if self.discontinuity {
+				// don't modify side data shared with other cursors
+				pkt.SideData = append([]av.SideData(nil), pkt.SideData...)
+				pkt.SetDiscontinuity()
+				self.discontinuity = false
+			}
+			self.packets++
+			self.bytes += int64(len(pkt.Data))
+			self.lasttime = pkt.Time
+			pkt.Ref()
 			break
 		}
 		if self.que.closed {
@@ -0,0 +1,241 @@
+package pubsub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Oldest buffered packet is a video key frame.
+func checkOldestKeyFrame(t *testing.T, que *Queue) {
+	cursor := que.Oldest()
+	pkt, err := cursor.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt.Idx != 0 || !pkt.IsKeyFrame {
+		t.Fatalf("oldest packet idx=%d key=%v time=%v", pkt.Idx, pkt.IsKeyFrame, pkt.Time)
+	}
+	cursor.Close()
+}
+
+func TestQueueMaxBufferSize(t *testing.T) {
+	que := NewQueue()
+	que.SetMaxGopCount(100)
+	// 8 bytes per frame, 200 bytes per GOP
+	que.SetMaxBufferSize(480)
+	que.WriteHeader(testStreams(t))
+	for _, pkt := range testPackets(time.Now(), 0, 260) {
+		que.WritePacket(pkt)
+		if _, size, _ := que.Buffered(); size > 480 {
+			t.Fatalf("buffered %d bytes", size)
+		}
+	}
+	checkOldestKeyFrame(t, que)
+	if _, size, _ := que.Buffered(); size != 200*2+10*8 {
+		t.Fatalf("buffered %d bytes", size)
+	}
+
+	// latest GOP alone is larger than limit
+	que.SetMaxBufferSize(100)
+	que.WritePacket(testPackets(time.Now(), 260, 261)[0])
+	if _, size, _ := que.Buffered(); size > 100 {
+		t.Fatalf("buffered %d bytes", size)
+	}
+}
+
+func TestQueueMaxBufferDuration(t *testing.T) {
+	que := NewQueue()
+	que.SetMaxGopCount(100)
+	que.SetMaxBufferDuration(time.Second + time.Second/2)
+	que.WriteHeader(testStreams(t))
+	for _, pkt := range testPackets(time.Now(), 0, 260) {
+		que.WritePacket(pkt)
+		if _, _, dur := que.Buffered(); dur > time.Second+time.Second/2 {
+			t.Fatalf("buffered %v", dur)
+		}
+	}
+	checkOldestKeyFrame(t, que)
+	if _, _, dur := que.Buffered(); dur != time.Second*259/25-time.Second*9 {
+		t.Fatalf("buffered %v", dur)
+	}
+}
+
+func TestQueueAudioOnlyBounded(t *testing.T) {
+	que := NewQueue()
+	que.WriteHeader(testStreams(t)[1:])
+	for _, pkt := range testPackets(time.Now(), 0, 25*30) {
+		if pkt.Idx == 1 {
+			pkt.Idx = 0
+			que.WritePacket(pkt)
+		}
+	}
+	if _, _, dur := que.Buffered(); dur != DefaultMaxAudioBufferDuration {
+		t.Fatalf("buffered %v", dur)
+	}
+}
+
+// Cursor reading first packet, then overrun by writing 4s of packets.
+func newOverrunCursor(t *testing.T, policy OverrunPolicy) (que *Queue, cursor *QueueCursor) {
+	que = NewQueue()
+	que.WriteHeader(testStreams(t))
+	cursor = que.Oldest()
+	cursor.SetOverrunPolicy(policy)
+	pkts := testPackets(time.Now(), 0, 100)
+	que.WritePacket(pkts[0])
+	if _, err := cursor.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+	for _, pkt := range pkts[1:] {
+		que.WritePacket(pkt)
+	}
+	return
+}
+
+func TestQueueOverrunResync(t *testing.T) {
+	que, cursor := newOverrunCursor(t, OverrunResync)
+	head := que.Oldest()
+	oldest, _ := head.ReadPacket()
+	if oldest.IsKeyFrame {
+		t.Fatal("oldest packet is key frame")
+	}
+
+	pkt, err := cursor.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame || !pkt.IsDiscontinuity() || pkt.Time != time.Second*3 {
+		t.Fatalf("packet after overrun key=%v discontinuity=%v time=%v", pkt.IsKeyFrame, pkt.IsDiscontinuity(), pkt.Time)
+	}
+	// discarded until audio after key frame at 2s, then skipped to key frame at 3s
+	if packets, bytes := cursor.Dropped(); packets != 100+49 || bytes != 400+6-6+24*6+25*2 {
+		t.Fatalf("dropped %d packets %d bytes", packets, bytes)
+	}
+	if pkt, _ = cursor.ReadPacket(); pkt.IsDiscontinuity() {
+		t.Fatal("discontinuity after resync")
+	}
+}
+
+func TestQueueOverrunReturnError(t *testing.T) {
+	_, cursor := newOverrunCursor(t, OverrunReturnError)
+	_, err := cursor.ReadPacket()
+	overrun, ok := err.(*OverrunError)
+	if !ok {
+		t.Fatalf("err=%v", err)
+	}
+	if packets, _ := cursor.Dropped(); overrun.Packets != packets {
+		t.Fatalf("overrun %d packets, dropped %d", overrun.Packets, packets)
+	}
+	pkt, err := cursor.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame || !pkt.IsDiscontinuity() {
+		t.Fatalf("packet after overrun key=%v discontinuity=%v", pkt.IsKeyFrame, pkt.IsDiscontinuity())
+	}
+}
+
+func TestQueueOverrunSkip(t *testing.T) {
+	que, cursor := newOverrunCursor(t, OverrunSkip)
+	head := que.Oldest()
+	oldest, _ := head.ReadPacket()
+	pkt, err := cursor.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkt.Time != oldest.Time || pkt.Idx != oldest.Idx || !pkt.IsDiscontinuity() {
+		t.Fatalf("packet after overrun idx=%d time=%v", pkt.Idx, pkt.Time)
+	}
+}
+
+func TestQueueLatestKeyFrame(t *testing.T) {
+	que := NewQueue()
+	que.WriteHeader(testStreams(t))
+	pkts := testPackets(time.Now(), 0, 100)
+	for _, pkt := range pkts[:80] {
+		que.WritePacket(pkt)
+	}
+	cursor := que.LatestKeyFrame()
+	pkt, err := cursor.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame || pkt.Time != time.Second || pkt.IsDiscontinuity() {
+		t.Fatalf("first packet key=%v time=%v", pkt.IsKeyFrame, pkt.Time)
+	}
+	if packets, _ := cursor.Dropped(); packets != 0 {
+		t.Fatalf("dropped %d packets", packets)
+	}
+}
+
+func TestQueueLatestKeyFrameWait(t *testing.T) {
+	que := NewQueue()
+	que.WriteHeader(testStreams(t))
+	pkts := testPackets(time.Now(), 1, 40)
+	for _, pkt := range pkts[:20] {
+		que.WritePacket(pkt)
+	}
+
+	// no key frame buffered, packets before next one are skipped
+	cursor := que.LatestKeyFrame()
+	cursor.Track()
+	read := make(chan error)
+	go func() {
+		pkt, err := cursor.ReadPacket()
+		if err == nil && (!pkt.IsKeyFrame || pkt.Time != time.Second) {
+			err = fmt.Errorf("first packet key=%v time=%v", pkt.IsKeyFrame, pkt.Time)
+		}
+		read <- err
+	}()
+	for {
+		que.lock.Lock()
+		gotpos := cursor.gotpos
+		que.lock.Unlock()
+		if gotpos {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, pkt := range pkts[20:] {
+		que.WritePacket(pkt)
+	}
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+	if packets, _ := cursor.Dropped(); packets != 0 {
+		t.Fatalf("dropped %d packets", packets)
+	}
+	if stats := que.Stats(); stats.Cursors[0].DroppedPackets != 0 {
+		t.Fatalf("stats dropped %d packets", stats.Cursors[0].DroppedPackets)
+	}
+}
+
+func TestQueueDelayedKeyFrame(t *testing.T) {
+	que := NewQueue()
+	que.SetMaxGopCount(5)
+	que.WriteHeader(testStreams(t))
+	for _, pkt := range testPackets(time.Now(), 0, 100) {
+		que.WritePacket(pkt)
+	}
+	// nearest to 3.96s-1.8s
+	cursor := que.DelayedKeyFrame(time.Second * 18 / 10)
+	pkt, err := cursor.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame || pkt.Time != time.Second*2 {
+		t.Fatalf("first packet key=%v time=%v", pkt.IsKeyFrame, pkt.Time)
+	}
+
+	// jumps to latest key frame
+	cursor.SetMaxLatency(time.Second + time.Second/2)
+	if pkt, err = cursor.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+	if !pkt.IsKeyFrame || pkt.Time != time.Second*3 || !pkt.IsDiscontinuity() {
+		t.Fatalf("packet after catch up key=%v time=%v", pkt.IsKeyFrame, pkt.Time)
+	}
+	if packets, _ := cursor.Dropped(); packets != 0 {
+		t.Fatalf("dropped %d packets", packets)
+	}
+}
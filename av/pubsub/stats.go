@@ -0,0 +1,163 @@
+package pubsub
+
+import (
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+// Rates are measured over this span of packet time.
+const statsWindow = time.Second * 2
+
+// Byte counters of connection, e.g: rtmp.Conn.
+type ByteCounter interface {
+	TxBytes() uint64
+	RxBytes() uint64
+}
+
+// Ingest of one stream written to Queue.
+type StreamStats struct {
+	Type             av.CodecType
+	Packets          int64
+	Bytes            int64
+	Bitrate          int64         // bits per second
+	FrameRate        float64       // packets per second
+	KeyFrameInterval time.Duration // between last two key frames, video only
+	LastTime         time.Duration // of latest packet
+}
+
+// Subscriber reading Queue by a QueueCursor.
+type CursorStats struct {
+	Packets        int64 // read
+	Bytes          int64
+	DroppedPackets int // by overruns
+	DroppedBytes   int
+	Latency        time.Duration // latest packet in queue minus latest read
+	TxBytes        uint64        // of connection set by SetByteCounter
+}
+
+// Snapshot of Queue by Stats.
+type QueueStats struct {
+	Streams          []StreamStats
+	LastWrite        time.Time // wallclock of latest WritePacket, to detect stalled publisher
+	BufferedPackets  int
+	BufferedBytes    int
+	BufferedDuration time.Duration
+	Subscribers      int
+	Cursors          []CursorStats
+	RxBytes          uint64 // of connection set by SetByteCounter
+	Closed           bool
+}
+
+// Bitrate of all streams.
+func (self QueueStats) Bitrate() (bitrate int64) {
+	for _, stream := range self.Streams {
+		bitrate += stream.Bitrate
+	}
+	return
+}
+
+// Dropped packets and bytes of all cursors.
+func (self QueueStats) Dropped() (packets int, bytes int) {
+	for _, cursor := range self.Cursors {
+		packets += cursor.DroppedPackets
+		bytes += cursor.DroppedBytes
+	}
+	return
+}
+
+type queueStream struct {
+	StreamStats
+	started   bool
+	gotkey    bool
+	lastkey   time.Duration
+	winstart  time.Duration
+	winbytes  int64
+	winframes int
+}
+
+// Called with lock held by WritePacket.
+func (self *queueStream) update(pkt av.Packet) {
+	size := int64(len(pkt.Data))
+	self.Packets++
+	self.Bytes += size
+	self.LastTime = pkt.Time
+
+	if pkt.IsKeyFrame && self.Type.IsVideo() {
+		if self.gotkey && pkt.Time > self.lastkey {
+			self.KeyFrameInterval = pkt.Time - self.lastkey
+		}
+		self.lastkey = pkt.Time
+		self.gotkey = true
+	}
+
+	if !self.started || pkt.Time < self.winstart {
+		// first packet or time jumped back
+		self.started = true
+		self.winstart = pkt.Time
+		self.winbytes = 0
+		self.winframes = 0
+	} else if elapsed := pkt.Time - self.winstart; elapsed >= statsWindow {
+		self.Bitrate = self.winbytes * 8 * int64(time.Second) / int64(elapsed)
+		self.FrameRate = float64(self.winframes) / elapsed.Seconds()
+		self.winstart = pkt.Time
+		self.winbytes = 0
+		self.winframes = 0
+	}
+	self.winbytes += size
+	self.winframes++
+}
+
+// Connection of publisher, its RxBytes is reported in QueueStats.
+func (self *Queue) SetByteCounter(counter ByteCounter) {
+	self.lock.Lock()
+	self.counter = counter
+	self.lock.Unlock()
+}
+
+// Snapshot of ingest, buffer and subscribers. Only cursors tracked and not
+// closed are counted as subscribers, see QueueCursor.Track.
+func (self *Queue) Stats() (stats QueueStats) {
+	// cursors update their counters with read lock held
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for _, stream := range self.stats {
+		stats.Streams = append(stats.Streams, stream.StreamStats)
+	}
+	stats.LastWrite = self.lastwrite
+	stats.BufferedPackets = self.buf.Count
+	stats.BufferedBytes = self.buf.Size
+	stats.BufferedDuration = self.duration()
+	stats.Subscribers = len(self.cursors)
+	for cursor := range self.cursors {
+		stats.Cursors = append(stats.Cursors, cursor.stats())
+	}
+	if self.counter != nil {
+		stats.RxBytes = self.counter.RxBytes()
+	}
+	stats.Closed = self.closed
+	return
+}
+
+// Connection of subscriber, its TxBytes is reported in CursorStats.
+func (self *QueueCursor) SetByteCounter(counter ByteCounter) {
+	self.que.lock.Lock()
+	self.counter = counter
+	self.que.lock.Unlock()
+}
+
+// Called with lock held.
+func (self *QueueCursor) stats() (stats CursorStats) {
+	stats.Packets = self.packets
+	stats.Bytes = self.bytes
+	stats.DroppedPackets, stats.DroppedBytes = self.Dropped()
+	buf := self.que.buf
+	if self.gotpos && buf.Count > 0 && self.packets > 0 {
+		stats.Latency = buf.Get(buf.Tail-1).Time - self.lasttime
+	}
+	if self.counter != nil {
+		stats.TxBytes = self.counter.TxBytes()
+	}
+	return
+}
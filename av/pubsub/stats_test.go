@@ -0,0 +1,67 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueStats(t *testing.T) {
+	que := NewQueue()
+	que.SetMaxGopCount(2)
+	que.WriteHeader(testStreams(t))
+
+	slow := que.Oldest()
+	slow.Track()
+	fast := que.Oldest()
+	fast.Track()
+	closed := que.Latest()
+	closed.Track()
+	closed.Close()
+	// not counted
+	que.Latest()
+
+	for i, pkt := range testPackets(time.Now(), 0, 100) {
+		que.WritePacket(pkt)
+		if _, err := fast.ReadPacket(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// stays at first packet
+			if _, err := slow.ReadPacket(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := slow.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := que.Stats()
+	if stats.Subscribers != 2 {
+		t.Fatalf("subscribers=%d", stats.Subscribers)
+	}
+	video := stats.Streams[0]
+	if video.Packets != 100 || video.KeyFrameInterval != time.Second || video.FrameRate != 25 {
+		t.Fatalf("video %+v", video)
+	}
+	// 6 bytes per frame
+	if video.Bitrate != 6*8*25 {
+		t.Fatalf("bitrate=%d", video.Bitrate)
+	}
+	if stats.BufferedDuration != time.Second*99/25-time.Second*2 {
+		t.Fatalf("buffered=%v", stats.BufferedDuration)
+	}
+	if packets, _ := stats.Dropped(); packets == 0 {
+		t.Fatalf("slow cursor not dropped")
+	}
+	for _, cursor := range stats.Cursors {
+		if cursor.Packets == 100*2 && cursor.Latency != 0 {
+			t.Fatalf("fast cursor latency=%v", cursor.Latency)
+		}
+	}
+
+	que.Close()
+	if stats = que.Stats(); stats.Subscribers != 0 {
+		t.Fatalf("subscribers=%d after close", stats.Subscribers)
+	}
+}
@@ -1,9 +1,11 @@
 
-// Package transcoder implements Transcoder based on Muxer/Demuxer and AudioEncoder/AudioDecoder interface.
+// Package transcoder implements Transcoder based on Muxer/Demuxer and AudioEncoder/AudioDecoder,
+// VideoEncoder/VideoDecoder interface.
 package transcode
 
 import (
 	"fmt"
+	"io"
 	"time"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/av/pktque"
@@ -17,6 +19,8 @@ type tStream struct {
 	aencodec, adecodec av.AudioCodecData
 	aenc av.AudioEncoder
 	adec av.AudioDecoder
+	venc av.VideoEncoder
+	vdec av.VideoDecoder
 }
 
 type Options struct {
@@ -24,6 +28,11 @@ type Options struct {
 	FindAudioDecoderEncoder func(codec av.AudioCodecData, i int) (
 		need bool, dec av.AudioDecoder, enc av.AudioEncoder, err error,
 	)
+	// check if transcode is needed, and create the VideoDecoder and VideoEncoder.
+	// Size of encoder should be same as decoded frames.
+	FindVideoDecoderEncoder func(codec av.VideoCodecData, i int) (
+		need bool, dec av.VideoDecoder, enc av.VideoEncoder, err error,
+	)
 }
 
 // 转码器
@@ -58,6 +67,22 @@ func NewTranscoder(streams []av.CodecData, options Options) (_self *Transcoder,
 					ts.adec = dec
 				}
 			}
+		} else if stream.Type().IsVideo() {
+			if options.FindVideoDecoderEncoder != nil {
+				var ok bool
+				var enc av.VideoEncoder
+				var dec av.VideoDecoder
+				if ok, dec, enc, err = options.FindVideoDecoderEncoder(stream.(av.VideoCodecData), i); err != nil {
+					return
+				}
+				if ok {
+					if ts.codec, err = enc.CodecData(); err != nil {
+						return
+					}
+					ts.venc = enc
+					ts.vdec = dec
+				}
+			}
 		}
 		self.streams = append(self.streams, ts)
 	}
@@ -125,6 +150,57 @@ func (self *tStream) audioDecodeAndEncode(inpkt av.Packet) (outpkts []av.Packet,
 	return
 }
 
+// Decoded frames keep presentation time and key frame flag of input packets,
+// so encoder makes key frames at same time as input.
+func (self *tStream) videoDecodeAndEncode(inpkt av.Packet) (outpkts []av.Packet, err error) {
+	if inpkt.CodecData != nil {
+		err = fmt.Errorf("transcode: codec data change of video stream #%d unsupported", inpkt.Idx)
+		return
+	}
+	var frames []av.VideoFrame
+	if frames, err = self.vdec.DecodePacket(inpkt); err != nil {
+		return
+	}
+	return self.videoEncode(inpkt.Idx, frames)
+}
+
+func (self *tStream) videoEncode(idx int8, frames []av.VideoFrame) (outpkts []av.Packet, err error) {
+	for _, frame := range frames {
+		if Debug {
+			fmt.Println("transcode: frame", frame.Time, frame.IsKeyFrame)
+		}
+		var pkts []av.Packet
+		if pkts, err = self.venc.EncodeFrame(frame); err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			pkt.Idx = idx
+			outpkts = append(outpkts, pkt)
+		}
+	}
+	return
+}
+
+// Frames and packets delayed in video decoder and encoder.
+func (self *tStream) videoFlush(idx int8) (outpkts []av.Packet, err error) {
+	var frames []av.VideoFrame
+	if frames, err = self.vdec.Flush(); err != nil {
+		return
+	}
+	if outpkts, err = self.videoEncode(idx, frames); err != nil {
+		return
+	}
+	var pkts []av.Packet
+	if pkts, err = self.venc.Flush(); err != nil {
+		return
+	}
+	for _, pkt := range pkts {
+		pkt.Idx = idx
+		outpkts = append(outpkts, pkt)
+	}
+	return
+}
+
 // Do the transcode.
 //
 // 在音频转码中，一个Packet可能会转码成多个Packet
@@ -137,6 +213,10 @@ func (self *Transcoder) Do(pkt av.Packet) (out []av.Packet, err error) {
 		if out, err = stream.audioDecodeAndEncode(pkt); err != nil {
 			return
 		}
+	} else if stream.venc != nil && stream.vdec != nil {
+		if out, err = stream.videoDecodeAndEncode(pkt); err != nil {
+			return
+		}
 	} else {
 		// 编码器或者解码器为空，默认不转码
 		out = append(out, pkt)
@@ -144,6 +224,20 @@ func (self *Transcoder) Do(pkt av.Packet) (out []av.Packet, err error) {
 	return
 }
 
+// Output packets still delayed in video decoders and encoders, at end of stream.
+func (self *Transcoder) Flush() (out []av.Packet, err error) {
+	for i, stream := range self.streams {
+		if stream.venc != nil && stream.vdec != nil {
+			var pkts []av.Packet
+			if pkts, err = stream.videoFlush(int8(i)); err != nil {
+				return
+			}
+			out = append(out, pkts...)
+		}
+	}
+	return
+}
+
 // Get CodecDatas after transcoding.
 // 获取转码过后的CodecData（元数据）
 func (self *Transcoder) Streams() (streams []av.CodecData, err error) {
@@ -165,6 +259,14 @@ func (self *Transcoder) Close() (err error) {
 			stream.adec.Close()
 			stream.adec = nil
 		}
+		if stream.venc != nil {
+			stream.venc.Close()
+			stream.venc = nil
+		}
+		if stream.vdec != nil {
+			stream.vdec.Close()
+			stream.vdec = nil
+		}
 	}
 	self.streams = nil
 	return
@@ -211,6 +313,20 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 	return
 }
 
+// Write packets delayed in transcoder before trailer.
+func (self *Muxer) WriteTrailer() (err error) {
+	var outpkts []av.Packet
+	if outpkts, err = self.transcoder.Flush(); err != nil {
+		return
+	}
+	for _, pkt := range outpkts {
+		if err = self.Muxer.WritePacket(pkt); err != nil {
+			return
+		}
+	}
+	return self.Muxer.WriteTrailer()
+}
+
 func (self *Muxer) Close() (err error) {
 	if self.transcoder != nil {
 		return self.transcoder.Close()
@@ -226,6 +342,7 @@ type Demuxer struct {
 	Options
 	transcoder *Transcoder
 	outpkts []av.Packet
+	flushed bool
 }
 
 func (self *Demuxer) prepare() (err error) {
@@ -257,6 +374,17 @@ func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 		var rpkt av.Packet
 		// 从分离器读取一个包
 		if rpkt, err = self.Demuxer.ReadPacket(); err != nil {
+			if err == io.EOF && !self.flushed {
+				// packets delayed in transcoder at end
+				self.flushed = true
+				if self.outpkts, err = self.transcoder.Flush(); err != nil {
+					return
+				}
+				if len(self.outpkts) > 0 {
+					continue
+				}
+				err = io.EOF
+			}
 			return
 		}
 		// 进行转码
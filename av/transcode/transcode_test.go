@@ -0,0 +1,145 @@
+package transcode
+
+import (
+	"image"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+)
+
+type testVideoCodecData struct {
+	typ av.CodecType
+}
+
+func (self testVideoCodecData) Type() av.CodecType { return self.typ }
+func (self testVideoCodecData) Width() int         { return 16 }
+func (self testVideoCodecData) Height() int        { return 16 }
+
+type testDemuxer struct {
+	streams []av.CodecData
+	pkts    []av.Packet
+}
+
+func (self *testDemuxer) Streams() ([]av.CodecData, error) {
+	return self.streams, nil
+}
+
+func (self *testDemuxer) ReadPacket() (pkt av.Packet, err error) {
+	if len(self.pkts) == 0 {
+		err = io.EOF
+		return
+	}
+	pkt = self.pkts[0]
+	self.pkts = self.pkts[1:]
+	return
+}
+
+// Holds one frame like decoder with reordering.
+type testVideoDecoder struct {
+	delayed []av.VideoFrame
+}
+
+func (self *testVideoDecoder) DecodePacket(pkt av.Packet) (frames []av.VideoFrame, err error) {
+	self.delayed = append(self.delayed, av.VideoFrame{
+		Image:      image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420),
+		Time:       pkt.Time + pkt.CompositionTime,
+		IsKeyFrame: pkt.IsKeyFrame,
+	})
+	if len(self.delayed) > 1 {
+		frames = self.delayed[:1]
+		self.delayed = self.delayed[1:]
+	}
+	return
+}
+
+func (self *testVideoDecoder) Flush() (frames []av.VideoFrame, err error) {
+	frames = self.delayed
+	self.delayed = nil
+	return
+}
+
+func (self *testVideoDecoder) Close() {}
+
+// Holds one frame like encoder with lookahead.
+type testVideoEncoder struct {
+	delayed []av.VideoFrame
+}
+
+func (self *testVideoEncoder) CodecData() (av.VideoCodecData, error) {
+	return testVideoCodecData{av.H264}, nil
+}
+
+func (self *testVideoEncoder) packets(frames []av.VideoFrame) (pkts []av.Packet) {
+	for _, frame := range frames {
+		pkts = append(pkts, av.Packet{Time: frame.Time, IsKeyFrame: frame.IsKeyFrame, Data: []byte{1}})
+	}
+	return
+}
+
+func (self *testVideoEncoder) EncodeFrame(frame av.VideoFrame) (pkts []av.Packet, err error) {
+	self.delayed = append(self.delayed, frame)
+	if len(self.delayed) > 1 {
+		pkts = self.packets(self.delayed[:1])
+		self.delayed = self.delayed[1:]
+	}
+	return
+}
+
+func (self *testVideoEncoder) Flush() (pkts []av.Packet, err error) {
+	pkts = self.packets(self.delayed)
+	self.delayed = nil
+	return
+}
+
+func (self *testVideoEncoder) Close()                              {}
+func (self *testVideoEncoder) SetBitrate(int) error                { return nil }
+func (self *testVideoEncoder) SetOption(string, interface{}) error { return nil }
+func (self *testVideoEncoder) GetOption(string, interface{}) error { return nil }
+
+func TestVideoTranscode(t *testing.T) {
+	demuxer := &testDemuxer{streams: []av.CodecData{testVideoCodecData{av.VP8}}}
+	for i := 0; i < 10; i++ {
+		demuxer.pkts = append(demuxer.pkts, av.Packet{
+			Time:       time.Duration(i) * time.Second / 25,
+			IsKeyFrame: i%5 == 0,
+			Data:       []byte{0},
+		})
+	}
+
+	trans := &Demuxer{
+		Demuxer: demuxer,
+		Options: Options{
+			FindVideoDecoderEncoder: func(codec av.VideoCodecData, i int) (need bool, dec av.VideoDecoder, enc av.VideoEncoder, err error) {
+				return true, &testVideoDecoder{}, &testVideoEncoder{}, nil
+			},
+		},
+	}
+	streams, err := trans.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streams[0].Type() != av.H264 {
+		t.Fatalf("stream type %v", streams[0].Type())
+	}
+
+	n := 0
+	for {
+		pkt, err := trans.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Time != time.Duration(n)*time.Second/25 || pkt.IsKeyFrame != (n%5 == 0) || pkt.Data[0] != 1 {
+			t.Fatalf("packet #%d time=%v key=%v", n, pkt.Time, pkt.IsKeyFrame)
+		}
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("got %d packets", n)
+	}
+	trans.Close()
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/av/avutil"
 	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/opusparser"
 )
 
 const debug = false
@@ -668,6 +669,24 @@ func NewAudioDecoder(codec av.AudioCodecData) (dec *AudioDecoder, err error) {
 			return
 		}
 
+	case av.OPUS:
+		if opuscodec, ok := codec.(opusparser.CodecData); ok {
+			_dec.Extradata = opuscodec.OpusHeadBytes()
+			id = C.AV_CODEC_ID_OPUS
+		} else {
+			err = fmt.Errorf("ffmpeg: opus CodecData must be opusparser.CodecData")
+			return
+		}
+
+	case av.MP3:
+		id = C.AV_CODEC_ID_MP3
+
+	case av.AC3:
+		id = C.AV_CODEC_ID_AC3
+
+	case av.EAC3:
+		id = C.AV_CODEC_ID_EAC3
+
 	case av.SPEEX:
 		id = C.AV_CODEC_ID_SPEEX
 
@@ -5,6 +5,7 @@
 #include <libavresample/avresample.h>
 #include <libavutil/opt.h>
 #include <string.h>
+#include <stdlib.h>
 #include <libswscale/swscale.h>
 
 typedef struct {
@@ -23,3 +24,6 @@ static inline int avcodec_profile_name_to_int(AVCodec *codec, const char *name)
 	return FF_PROFILE_UNKNOWN;
 }
 
+static inline uint8_t *wrap_plane_row(AVFrame *frame, int plane, int row) {
+	return frame->data[plane] + row*frame->linesize[plane];
+}
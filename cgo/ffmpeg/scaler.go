@@ -0,0 +1,322 @@
+package ffmpeg
+
+/*
+#include "ffmpeg.h"
+int wrap_sws_scale(struct SwsContext *ctx, AVFrame *src, AVFrame *dst) {
+	return sws_scale(ctx, (const uint8_t * const *)src->data, src->linesize, 0, src->height, dst->data, dst->linesize);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime"
+	"unsafe"
+)
+
+// Pixel format of VideoScaler output.
+type PixelFormat int
+
+const (
+	YUV420P = PixelFormat(iota + 1) // *image.YCbCr with 4:2:0 subsampling
+	NV12                            // *NV12Image
+	RGBA                            // *image.RGBA
+)
+
+func (self PixelFormat) String() string {
+	switch self {
+	case YUV420P:
+		return "YUV420P"
+	case NV12:
+		return "NV12"
+	case RGBA:
+		return "RGBA"
+	}
+	return fmt.Sprintf("PixelFormat(%d)", int(self))
+}
+
+// Scaling algorithms of VideoScaler.
+const (
+	SCALE_FAST_BILINEAR = int(C.SWS_FAST_BILINEAR)
+	SCALE_BILINEAR      = int(C.SWS_BILINEAR)
+	SCALE_BICUBIC       = int(C.SWS_BICUBIC)
+	SCALE_LANCZOS       = int(C.SWS_LANCZOS)
+)
+
+// NV12 image, full size Y plane followed by interleaved Cb/Cr plane of half
+// width and height, used by hardware decoders and encoders.
+type NV12Image struct {
+	Y       []byte
+	CbCr    []byte
+	YStride int
+	CStride int
+	Rect    image.Rectangle
+}
+
+func NewNV12Image(r image.Rectangle) *NV12Image {
+	w, h := r.Dx(), r.Dy()
+	cw, ch := (w+1)/2, (h+1)/2
+	return &NV12Image{
+		Y:       make([]byte, w*h),
+		CbCr:    make([]byte, cw*2*ch),
+		YStride: w,
+		CStride: cw * 2,
+		Rect:    r,
+	}
+}
+
+func (self *NV12Image) ColorModel() color.Model {
+	return color.YCbCrModel
+}
+
+func (self *NV12Image) Bounds() image.Rectangle {
+	return self.Rect
+}
+
+func (self *NV12Image) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(self.Rect)) {
+		return color.YCbCr{}
+	}
+	x, y = x-self.Rect.Min.X, y-self.Rect.Min.Y
+	c := (y/2)*self.CStride + (x/2)*2
+	return color.YCbCr{
+		Y:  self.Y[y*self.YStride+x],
+		Cb: self.CbCr[c],
+		Cr: self.CbCr[c+1],
+	}
+}
+
+// Rows of one plane in image.
+type scalerPlane struct {
+	data   []byte
+	stride int
+	width  int // bytes of row
+	height int
+}
+
+// Resize raw video images and convert pixel format by libswscale.
+//
+// Input can be *image.YCbCr (4:2:0, 4:2:2 or 4:4:4), *NV12Image,
+// *image.RGBA, or any other image.Image drawn to RGBA first.
+type VideoScaler struct {
+	OutWidth       int         // same as input if 0
+	OutHeight      int         // same as input if 0
+	OutPixelFormat PixelFormat // YUV420P if 0
+	Algorithm      int         // SCALE_BICUBIC if 0
+
+	ctx      *C.struct_SwsContext
+	src, dst *C.AVFrame
+}
+
+func NewVideoScaler(width, height int, pixfmt PixelFormat) *VideoScaler {
+	return &VideoScaler{
+		OutWidth:       width,
+		OutHeight:      height,
+		OutPixelFormat: pixfmt,
+	}
+}
+
+func pixelFormatAV2FF(pixfmt PixelFormat) (ffpixfmt int32) {
+	switch pixfmt {
+	case YUV420P:
+		ffpixfmt = C.AV_PIX_FMT_YUV420P
+	case NV12:
+		ffpixfmt = C.AV_PIX_FMT_NV12
+	case RGBA:
+		ffpixfmt = C.AV_PIX_FMT_RGBA
+	}
+	return
+}
+
+// Planes and ffmpeg pixel format of input image.
+func scalerInput(img image.Image) (planes []scalerPlane, ffpixfmt int32, err error) {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+
+	switch src := img.(type) {
+	case *image.YCbCr:
+		var cw, ch int
+		switch src.SubsampleRatio {
+		case image.YCbCrSubsampleRatio420:
+			cw, ch = (w+1)/2, (h+1)/2
+			ffpixfmt = C.AV_PIX_FMT_YUV420P
+		case image.YCbCrSubsampleRatio422:
+			cw, ch = (w+1)/2, h
+			ffpixfmt = C.AV_PIX_FMT_YUV422P
+		case image.YCbCrSubsampleRatio444:
+			cw, ch = w, h
+			ffpixfmt = C.AV_PIX_FMT_YUV444P
+		default:
+			err = fmt.Errorf("ffmpeg: scaler: subsample ratio %v unsupported", src.SubsampleRatio)
+			return
+		}
+		coff := src.COffset(r.Min.X, r.Min.Y)
+		planes = []scalerPlane{
+			{src.Y[src.YOffset(r.Min.X, r.Min.Y):], src.YStride, w, h},
+			{src.Cb[coff:], src.CStride, cw, ch},
+			{src.Cr[coff:], src.CStride, cw, ch},
+		}
+
+	case *NV12Image:
+		planes = []scalerPlane{
+			{src.Y, src.YStride, w, h},
+			{src.CbCr, src.CStride, (w + 1) / 2 * 2, (h + 1) / 2},
+		}
+		ffpixfmt = C.AV_PIX_FMT_NV12
+
+	case *image.RGBA:
+		planes = []scalerPlane{
+			{src.Pix[src.PixOffset(r.Min.X, r.Min.Y):], src.Stride, w * 4, h},
+		}
+		ffpixfmt = C.AV_PIX_FMT_RGBA
+
+	default:
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(rgba, rgba.Rect, img, r.Min, draw.Src)
+		return scalerInput(rgba)
+	}
+	return
+}
+
+// Output image and its planes, pixel data is copied into them after scaling.
+func scalerOutput(pixfmt PixelFormat, w, h int) (img image.Image, planes []scalerPlane) {
+	r := image.Rect(0, 0, w, h)
+	switch pixfmt {
+	case NV12:
+		dst := NewNV12Image(r)
+		planes = []scalerPlane{
+			{dst.Y, dst.YStride, w, h},
+			{dst.CbCr, dst.CStride, dst.CStride, (h + 1) / 2},
+		}
+		img = dst
+
+	case RGBA:
+		dst := image.NewRGBA(r)
+		planes = []scalerPlane{
+			{dst.Pix, dst.Stride, w * 4, h},
+		}
+		img = dst
+
+	default:
+		dst := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+		cw, ch := (w+1)/2, (h+1)/2
+		planes = []scalerPlane{
+			{dst.Y, dst.YStride, w, h},
+			{dst.Cb, dst.CStride, cw, ch},
+			{dst.Cr, dst.CStride, cw, ch},
+		}
+		img = dst
+	}
+	return
+}
+
+// (Re)allocate buffer of frame if size or format changed.
+func allocScalerFrame(frame *C.AVFrame, ffpixfmt int32, w, h int) (err error) {
+	if frame.data[0] != nil && frame.format == C.int(ffpixfmt) && frame.width == C.int(w) && frame.height == C.int(h) {
+		return
+	}
+	C.av_frame_unref(frame)
+	frame.format = C.int(ffpixfmt)
+	frame.width = C.int(w)
+	frame.height = C.int(h)
+	if C.av_frame_get_buffer(frame, 32) < 0 {
+		err = fmt.Errorf("ffmpeg: scaler: av_frame_get_buffer failed")
+		return
+	}
+	return
+}
+
+func (self *VideoScaler) Scale(in image.Image) (out image.Image, err error) {
+	var inplanes []scalerPlane
+	var inpixfmt int32
+	if inplanes, inpixfmt, err = scalerInput(in); err != nil {
+		return
+	}
+	r := in.Bounds()
+	inw, inh := r.Dx(), r.Dy()
+	if inw <= 0 || inh <= 0 {
+		err = fmt.Errorf("ffmpeg: scaler: empty image")
+		return
+	}
+
+	outw, outh := self.OutWidth, self.OutHeight
+	if outw <= 0 {
+		outw = inw
+	}
+	if outh <= 0 {
+		outh = inh
+	}
+	outpixfmt := self.OutPixelFormat
+	if outpixfmt == PixelFormat(0) {
+		outpixfmt = YUV420P
+	}
+	algorithm := self.Algorithm
+	if algorithm == 0 {
+		algorithm = SCALE_BICUBIC
+	}
+
+	if self.src == nil {
+		self.src = C.av_frame_alloc()
+		self.dst = C.av_frame_alloc()
+		runtime.SetFinalizer(self, func(self *VideoScaler) {
+			self.Close()
+		})
+	}
+	self.ctx = C.sws_getCachedContext(self.ctx,
+		C.int(inw), C.int(inh), C.enum_AVPixelFormat(inpixfmt),
+		C.int(outw), C.int(outh), C.enum_AVPixelFormat(pixelFormatAV2FF(outpixfmt)),
+		C.int(algorithm), nil, nil, nil,
+	)
+	if self.ctx == nil {
+		err = fmt.Errorf("ffmpeg: scaler: sws_getCachedContext failed %dx%d -> %dx%d %v", inw, inh, outw, outh, outpixfmt)
+		return
+	}
+
+	if err = allocScalerFrame(self.src, inpixfmt, inw, inh); err != nil {
+		return
+	}
+	if err = allocScalerFrame(self.dst, pixelFormatAV2FF(outpixfmt), outw, outh); err != nil {
+		return
+	}
+
+	// pixel data is copied in and out, so no Go memory is kept by C
+	for i, plane := range inplanes {
+		for y := 0; y < plane.height; y++ {
+			row := fromCPtr(unsafe.Pointer(C.wrap_plane_row(self.src, C.int(i), C.int(y))), plane.width)
+			off := y * plane.stride
+			if off >= len(plane.data) && y > 0 {
+				// last chroma row of odd height missing, e.g: sized h/2, repeat previous one
+				off -= plane.stride
+			}
+			if off < len(plane.data) {
+				copy(row, plane.data[off:])
+			}
+		}
+	}
+	if C.wrap_sws_scale(self.ctx, self.src, self.dst) < 0 {
+		err = fmt.Errorf("ffmpeg: scaler: sws_scale failed")
+		return
+	}
+	var outplanes []scalerPlane
+	out, outplanes = scalerOutput(outpixfmt, outw, outh)
+	for i, plane := range outplanes {
+		for y := 0; y < plane.height; y++ {
+			row := fromCPtr(unsafe.Pointer(C.wrap_plane_row(self.dst, C.int(i), C.int(y))), plane.width)
+			copy(plane.data[y*plane.stride:], row)
+		}
+	}
+	return
+}
+
+func (self *VideoScaler) Close() {
+	if self.ctx != nil {
+		C.sws_freeContext(self.ctx)
+		self.ctx = nil
+	}
+	if self.src != nil {
+		C.av_frame_free(&self.src)
+		C.av_frame_free(&self.dst)
+	}
+}
@@ -0,0 +1,123 @@
+package ffmpeg
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func near(a, b uint8, d int) bool {
+	diff := int(a) - int(b)
+	return diff >= -d && diff <= d
+}
+
+func clamp8(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// BT.601 limited range, default of swscale, color.YCbCrToRGB is full range.
+func limitedYCbCrToRGB(y, cb, cr uint8) (r, g, b uint8) {
+	fy := 1.164 * (float64(y) - 16)
+	fcb, fcr := float64(cb)-128, float64(cr)-128
+	return clamp8(fy + 1.596*fcr), clamp8(fy - 0.392*fcb - 0.813*fcr), clamp8(fy + 2.017*fcb)
+}
+
+func TestVideoScalerRGBAToYUV(t *testing.T) {
+	in := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for i := 0; i < len(in.Pix); i += 4 {
+		in.Pix[i], in.Pix[i+1], in.Pix[i+2], in.Pix[i+3] = 255, 0, 0, 255
+	}
+
+	scaler := NewVideoScaler(32, 24, YUV420P)
+	defer scaler.Close()
+	out, err := scaler.Scale(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yuv, ok := out.(*image.YCbCr)
+	if !ok || yuv.Rect.Dx() != 32 || yuv.Rect.Dy() != 24 || yuv.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		t.Fatalf("output %T %v", out, out.Bounds())
+	}
+	// BT.601 limited range red
+	c := yuv.YCbCrAt(16, 12)
+	if !near(c.Y, 81, 2) || !near(c.Cb, 90, 2) || !near(c.Cr, 240, 2) {
+		t.Fatalf("red is %v", c)
+	}
+}
+
+func TestVideoScalerNV12RoundTrip(t *testing.T) {
+	in := image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio420)
+	for i := range in.Y {
+		in.Y[i] = 100
+	}
+	for i := range in.Cb {
+		in.Cb[i] = 60
+		in.Cr[i] = 200
+	}
+
+	scaler := &VideoScaler{OutPixelFormat: NV12}
+	defer scaler.Close()
+	out, err := scaler.Scale(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nv12, ok := out.(*NV12Image)
+	if !ok || nv12.Rect != in.Rect {
+		t.Fatalf("output %T %v", out, out.Bounds())
+	}
+	if c := nv12.At(7, 9).(color.YCbCr); c != (color.YCbCr{100, 60, 200}) {
+		t.Fatalf("nv12 is %v", c)
+	}
+
+	// back to rgba and double size, same scaler converts other formats too
+	scaler.OutWidth, scaler.OutHeight, scaler.OutPixelFormat = 32, 32, RGBA
+	if out, err = scaler.Scale(nv12); err != nil {
+		t.Fatal(err)
+	}
+	rgba, ok := out.(*image.RGBA)
+	if !ok || rgba.Rect.Dx() != 32 {
+		t.Fatalf("output %T %v", out, out.Bounds())
+	}
+	r, g, b := limitedYCbCrToRGB(100, 60, 200)
+	if c := rgba.RGBAAt(20, 20); !near(c.R, r, 4) || !near(c.G, g, 4) || !near(c.B, b, 4) {
+		t.Fatalf("rgba is %v want %v %v %v", c, r, g, b)
+	}
+}
+
+// Odd size 4:2:0, chroma planes short of last row like h/2 sized ones.
+func TestVideoScalerOddSize(t *testing.T) {
+	in := image.NewYCbCr(image.Rect(0, 0, 15, 15), image.YCbCrSubsampleRatio420)
+	for i := range in.Y {
+		in.Y[i] = 100
+	}
+	for i := range in.Cb {
+		in.Cb[i] = 60
+		in.Cr[i] = 200
+	}
+	short := *in
+	short.Cb = in.Cb[:in.CStride*15/2]
+	short.Cr = in.Cr[:in.CStride*15/2]
+
+	scaler := &VideoScaler{OutPixelFormat: RGBA}
+	defer scaler.Close()
+	r, g, b := limitedYCbCrToRGB(100, 60, 200)
+	for _, img := range []*image.YCbCr{in, &short} {
+		out, err := scaler.Scale(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rgba, ok := out.(*image.RGBA)
+		if !ok || rgba.Rect != in.Rect {
+			t.Fatalf("output %T %v", out, out.Bounds())
+		}
+		if c := rgba.RGBAAt(14, 14); !near(c.R, r, 4) || !near(c.G, g, 4) || !near(c.B, b, 4) {
+			t.Fatalf("rgba is %v want %v %v %v", c, r, g, b)
+		}
+	}
+}
@@ -6,6 +6,19 @@ int wrap_avcodec_decode_video2(AVCodecContext *ctx, AVFrame *frame, void *data,
 	struct AVPacket pkt = {.data = data, .size = size};
 	return avcodec_decode_video2(ctx, frame, got, &pkt);
 }
+int wrap_avcodec_decode_video2_ts(AVCodecContext *ctx, AVFrame *frame, void *data, int size, int64_t pts, int64_t dts, int *got) {
+	struct AVPacket pkt = {.data = data, .size = size, .pts = pts, .dts = dts};
+	return avcodec_decode_video2(ctx, frame, got, &pkt);
+}
+int wrap_avcodec_encode_video2(AVCodecContext *ctx, AVPacket *pkt, AVFrame *frame, int *got) {
+	av_init_packet(pkt);
+	pkt->data = NULL;
+	pkt->size = 0;
+	return avcodec_encode_video2(ctx, pkt, frame, got);
+}
+int64_t wrap_nopts_value() {
+	return AV_NOPTS_VALUE;
+}
 */
 import "C"
 import (
@@ -14,6 +27,7 @@ import (
 	"fmt"
 	"image"
 	"reflect"
+	"time"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/codec/h264parser"
 )
@@ -29,6 +43,8 @@ func (self *VideoDecoder) Setup() (err error) {
 		ff.codecCtx.extradata = (*C.uint8_t)(unsafe.Pointer(&self.Extradata[0]))
 		ff.codecCtx.extradata_size = C.int(len(self.Extradata))
 	}
+	// frames stay valid after next decode until freed
+	ff.codecCtx.refcounted_frames = 1
 	if C.avcodec_open2(ff.codecCtx, ff.codec, nil) != 0 {
 		err = fmt.Errorf("ffmpeg: decoder: avcodec_open2 failed")
 		return
@@ -46,9 +62,20 @@ func fromCPtr(buf unsafe.Pointer, size int) (ret []uint8) {
 
 type VideoFrame struct {
 	Image image.YCbCr
+	Time time.Duration // presentation time of packet given to DecodePacket
+	IsKeyFrame bool
 	frame *C.AVFrame
 }
 
+// Frame for VideoEncoder, Image is valid until Free called.
+func (self *VideoFrame) Frame() av.VideoFrame {
+	return av.VideoFrame{
+		Image: &self.Image,
+		Time: self.Time,
+		IsKeyFrame: self.IsKeyFrame,
+	}
+}
+
 func (self *VideoFrame) Free() {
 	self.Image = image.YCbCr{}
 	C.av_frame_free(&self.frame)
@@ -59,12 +86,51 @@ func freeVideoFrame(self *VideoFrame) {
 }
 
 func (self *VideoDecoder) Decode(pkt []byte) (img *VideoFrame, err error) {
+	return self.decode(pkt, C.wrap_nopts_value(), C.wrap_nopts_value())
+}
+
+// Decode packet keeping its time and key frame flag in VideoFrame.
+func (self *VideoDecoder) DecodePacket(pkt av.Packet) (frames []av.VideoFrame, err error) {
+	var img *VideoFrame
+	if img, err = self.decode(pkt.Data, C.int64_t(pkt.Time+pkt.CompositionTime), C.int64_t(pkt.Time)); err != nil {
+		return
+	}
+	if img != nil {
+		frames = append(frames, img.Frame())
+	}
+	return
+}
+
+// Frames delayed in decoder by reordering, decoder can't be used after it.
+func (self *VideoDecoder) Flush() (frames []av.VideoFrame, err error) {
+	for {
+		var img *VideoFrame
+		if img, err = self.decode(nil, C.wrap_nopts_value(), C.wrap_nopts_value()); err != nil {
+			return
+		}
+		if img == nil {
+			return
+		}
+		frames = append(frames, img.Frame())
+	}
+}
+
+func (self *VideoDecoder) Close() {
+	freeFFCtx(self.ff)
+}
+
+func (self *VideoDecoder) decode(pkt []byte, pts, dts C.int64_t) (img *VideoFrame, err error) {
 	ff := &self.ff.ff
 
+	var data unsafe.Pointer
+	if len(pkt) > 0 {
+		data = unsafe.Pointer(&pkt[0])
+	}
 	cgotimg := C.int(0)
 	frame := C.av_frame_alloc()
-	cerr := C.wrap_avcodec_decode_video2(ff.codecCtx, frame, unsafe.Pointer(&pkt[0]), C.int(len(pkt)), &cgotimg)
+	cerr := C.wrap_avcodec_decode_video2_ts(ff.codecCtx, frame, data, C.int(len(pkt)), pts, dts, &cgotimg)
 	if cerr < C.int(0) {
+		C.av_frame_free(&frame)
 		err = fmt.Errorf("ffmpeg: avcodec_decode_video2 failed: %d", cerr)
 		return
 	}
@@ -77,14 +143,20 @@ func (self *VideoDecoder) Decode(pkt []byte) (img *VideoFrame, err error) {
 
 		img = &VideoFrame{Image: image.YCbCr{
 			Y: fromCPtr(unsafe.Pointer(frame.data[0]), ys*h),
-			Cb: fromCPtr(unsafe.Pointer(frame.data[1]), cs*h/2),
-			Cr: fromCPtr(unsafe.Pointer(frame.data[2]), cs*h/2),
+			Cb: fromCPtr(unsafe.Pointer(frame.data[1]), cs*((h+1)/2)),
+			Cr: fromCPtr(unsafe.Pointer(frame.data[2]), cs*((h+1)/2)),
 			YStride: ys,
 			CStride: cs,
 			SubsampleRatio: image.YCbCrSubsampleRatio420,
 			Rect: image.Rect(0, 0, w, h),
 		}, frame: frame}
+		if ts := frame.best_effort_timestamp; ts != C.wrap_nopts_value() {
+			img.Time = time.Duration(ts)
+		}
+		img.IsKeyFrame = frame.key_frame != 0
 		runtime.SetFinalizer(img, freeVideoFrame)
+	} else {
+		C.av_frame_free(&frame)
 	}
 
 	return
@@ -100,6 +172,12 @@ func NewVideoDecoder(stream av.CodecData) (dec *VideoDecoder, err error) {
 		_dec.Extradata = h264.AVCDecoderConfRecordBytes()
 		id = C.AV_CODEC_ID_H264
 
+	case av.VP8:
+		id = C.AV_CODEC_ID_VP8
+
+	case av.VP9:
+		id = C.AV_CODEC_ID_VP9
+
 	default:
 		err = fmt.Errorf("ffmpeg: NewVideoDecoder codec=%v unsupported", stream.Type())
 		return
@@ -122,3 +200,330 @@ func NewVideoDecoder(stream av.CodecData) (dec *VideoDecoder, err error) {
 	return
 }
 
+
+// H.264 encoder, output packets are AVCC and CodecData is h264parser.CodecData.
+// Settings are used when encoder opened by first CodecData or EncodeFrame.
+type VideoEncoder struct {
+	ff *ffctx
+	Width int
+	Height int
+	Bitrate int // bits per second, encoder default if 0
+	GopSize int // max frames between key frames, encoder default if 0
+	FrameRate int // for rate control, 25 if 0
+	Preset string // e.g: ultrafast, veryfast, medium for libx264
+	Profile string // e.g: baseline, main, high
+	codecData h264parser.CodecData
+}
+
+// Encoder time base, same as mpegts.
+const videoEncoderTimeScale = 90000
+
+// Seconds and remainder converted apart, tm*90000 overflows after 28h.
+func timeToVideoTs(tm time.Duration) C.int64_t {
+	return C.int64_t(tm/time.Second*videoEncoderTimeScale + tm%time.Second*videoEncoderTimeScale/time.Second)
+}
+
+func videoTsToTime(ts C.int64_t) time.Duration {
+	return time.Duration(ts/videoEncoderTimeScale)*time.Second + time.Duration(ts%videoEncoderTimeScale)*time.Second/videoEncoderTimeScale
+}
+
+func (self *VideoEncoder) SetBitrate(bitrate int) (err error) {
+	self.Bitrate = bitrate
+	return
+}
+
+// av_dict_set copies key and value, C strings are freed after.
+func avDictSet(dict **C.AVDictionary, key, val string) {
+	ckey := C.CString(key)
+	cval := C.CString(val)
+	C.av_dict_set(dict, ckey, cval, 0)
+	C.free(unsafe.Pointer(ckey))
+	C.free(unsafe.Pointer(cval))
+}
+
+func (self *VideoEncoder) SetOption(key string, val interface{}) (err error) {
+	ff := &self.ff.ff
+	avDictSet(&ff.options, key, fmt.Sprint(val))
+	return
+}
+
+func (self *VideoEncoder) GetOption(key string, val interface{}) (err error) {
+	ff := &self.ff.ff
+	ckey := C.CString(key)
+	entry := C.av_dict_get(ff.options, ckey, nil, 0)
+	C.free(unsafe.Pointer(ckey))
+	if entry == nil {
+		err = fmt.Errorf("ffmpeg: GetOption failed: `%s` not exists", key)
+		return
+	}
+	switch p := val.(type) {
+	case *string:
+		*p = C.GoString(entry.value)
+	case *int:
+		fmt.Sscanf(C.GoString(entry.value), "%d", p)
+	default:
+		err = fmt.Errorf("ffmpeg: GetOption failed: val must be *string or *int receiver")
+		return
+	}
+	return
+}
+
+func (self *VideoEncoder) Setup() (err error) {
+	ff := &self.ff.ff
+
+	if self.Width <= 0 || self.Height <= 0 {
+		err = fmt.Errorf("ffmpeg: video encoder: size %dx%d invalid", self.Width, self.Height)
+		return
+	}
+	if self.FrameRate == 0 {
+		self.FrameRate = 25
+	}
+
+	ff.frame = C.av_frame_alloc()
+
+	ff.codecCtx.width = C.int(self.Width)
+	ff.codecCtx.height = C.int(self.Height)
+	ff.codecCtx.pix_fmt = C.AV_PIX_FMT_YUV420P
+	ff.codecCtx.time_base = C.AVRational{num: 1, den: videoEncoderTimeScale}
+	ff.codecCtx.framerate = C.AVRational{num: C.int(self.FrameRate), den: 1}
+	ff.codecCtx.bit_rate = C.int64_t(self.Bitrate)
+	if self.GopSize > 0 {
+		ff.codecCtx.gop_size = C.int(self.GopSize)
+	}
+	ff.codecCtx.flags |= C.AV_CODEC_FLAG_GLOBAL_HEADER
+
+	// private options of encoder, options not known by it are left in dict
+	var options *C.AVDictionary
+	if C.GoString(ff.codec.name) == "libx264" {
+		// forced I frames are IDR, so that packets are flagged as key frame
+		avDictSet(&options, "forced-idr", "1")
+	}
+	C.av_dict_copy(&options, ff.options, 0)
+	if self.Preset != "" {
+		avDictSet(&options, "preset", self.Preset)
+	}
+	if self.Profile != "" {
+		avDictSet(&options, "profile", self.Profile)
+		cprofile := C.CString(self.Profile)
+		profile := C.avcodec_profile_name_to_int(ff.codec, cprofile)
+		C.free(unsafe.Pointer(cprofile))
+		if profile != C.FF_PROFILE_UNKNOWN {
+			ff.codecCtx.profile = profile
+		}
+	}
+	cerr := C.avcodec_open2(ff.codecCtx, ff.codec, &options)
+	C.av_dict_free(&options)
+	if cerr != 0 {
+		err = fmt.Errorf("ffmpeg: video encoder: avcodec_open2 failed: %d", cerr)
+		return
+	}
+
+	extradata := C.GoBytes(unsafe.Pointer(ff.codecCtx.extradata), ff.codecCtx.extradata_size)
+	if self.codecData, err = h264CodecDataFromExtradata(extradata); err != nil {
+		return
+	}
+	return
+}
+
+// Extradata is AVCDecoderConfRecord or annexb SPS/PPS, e.g: libx264.
+func h264CodecDataFromExtradata(extradata []byte) (codec h264parser.CodecData, err error) {
+	if len(extradata) > 0 && extradata[0] == 1 {
+		return h264parser.NewCodecDataFromAVCDecoderConfRecord(extradata)
+	}
+	var sps, pps []byte
+	nalus, _ := h264parser.SplitNALUs(extradata)
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch nalu[0]&0x1f {
+		case 7:
+			sps = nalu
+		case 8:
+			pps = nalu
+		}
+	}
+	if sps == nil || pps == nil {
+		err = fmt.Errorf("ffmpeg: video encoder: no SPS/PPS in extradata")
+		return
+	}
+	return h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+}
+
+func (self *VideoEncoder) prepare() (err error) {
+	ff := &self.ff.ff
+	if ff.frame == nil {
+		if err = self.Setup(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Underlying type is h264parser.CodecData.
+func (self *VideoEncoder) CodecData() (codec av.VideoCodecData, err error) {
+	if err = self.prepare(); err != nil {
+		return
+	}
+	codec = self.codecData
+	return
+}
+
+// Copy YUV420 image into encoder frame, encoder may still hold previous one.
+func (self *VideoEncoder) fillFrame(img *image.YCbCr) (err error) {
+	ff := &self.ff.ff
+	frame := ff.frame
+
+	if img.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		err = fmt.Errorf("ffmpeg: video encoder: subsample ratio %v unsupported, convert by VideoScaler", img.SubsampleRatio)
+		return
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w != self.Width || h != self.Height {
+		err = fmt.Errorf("ffmpeg: video encoder: frame size %dx%d differs from %dx%d", w, h, self.Width, self.Height)
+		return
+	}
+
+	if frame.data[0] == nil {
+		frame.format = C.int(C.AV_PIX_FMT_YUV420P)
+		frame.width = C.int(w)
+		frame.height = C.int(h)
+		if C.av_frame_get_buffer(frame, 32) < 0 {
+			err = fmt.Errorf("ffmpeg: video encoder: av_frame_get_buffer failed")
+			return
+		}
+	} else if C.av_frame_make_writable(frame) < 0 {
+		err = fmt.Errorf("ffmpeg: video encoder: av_frame_make_writable failed")
+		return
+	}
+
+	cw, ch := (w+1)/2, (h+1)/2
+	x0, y0 := img.Rect.Min.X, img.Rect.Min.Y
+	for y := 0; y < h; y++ {
+		row := fromCPtr(unsafe.Pointer(C.wrap_plane_row(frame, 0, C.int(y))), w)
+		copy(row, img.Y[img.YOffset(x0, y0+y):])
+	}
+	for y := 0; y < ch; y++ {
+		coff := img.COffset(x0, y0+y*2)
+		row := fromCPtr(unsafe.Pointer(C.wrap_plane_row(frame, 1, C.int(y))), cw)
+		copy(row, img.Cb[coff:])
+		row = fromCPtr(unsafe.Pointer(C.wrap_plane_row(frame, 2, C.int(y))), cw)
+		copy(row, img.Cr[coff:])
+	}
+	return
+}
+
+// Packets of encoder, until it needs more input.
+func (self *VideoEncoder) encode(frame *C.AVFrame) (pkts []av.Packet, err error) {
+	ff := &self.ff.ff
+	for {
+		var cpkt C.AVPacket
+		cgotpkt := C.int(0)
+		cerr := C.wrap_avcodec_encode_video2(ff.codecCtx, &cpkt, frame, &cgotpkt)
+		if cerr < C.int(0) {
+			err = fmt.Errorf("ffmpeg: avcodec_encode_video2 failed: %d", cerr)
+			return
+		}
+		if cgotpkt == 0 {
+			return
+		}
+
+		data := C.GoBytes(unsafe.Pointer(cpkt.data), cpkt.size)
+		pkt := av.Packet{
+			IsKeyFrame: cpkt.flags&C.AV_PKT_FLAG_KEY != 0,
+			Time: videoTsToTime(cpkt.dts),
+		}
+		if cpkt.pts != C.wrap_nopts_value() {
+			pkt.CompositionTime = videoTsToTime(cpkt.pts) - pkt.Time
+		}
+		if nalus, typ := h264parser.SplitNALUs(data); typ == h264parser.NALU_AVCC {
+			pkt.Data = data
+		} else {
+			pkt.Data = h264parser.PrependNALUsToAVCC(nalus, nil)
+		}
+		C.av_packet_unref(&cpkt)
+		pkts = append(pkts, pkt)
+
+		if frame != nil {
+			// one packet at most for each input frame
+			return
+		}
+	}
+}
+
+// Encode YUV420 *image.YCbCr of frame, e.g: VideoFrame.Frame() of VideoDecoder.
+// Frame with IsKeyFrame set is encoded as key frame, IDR with libx264, other
+// encoders may need their own option, e.g: forced-idr of h264_nvenc.
+func (self *VideoEncoder) EncodeFrame(frame av.VideoFrame) (pkts []av.Packet, err error) {
+	if err = self.prepare(); err != nil {
+		return
+	}
+	ff := &self.ff.ff
+
+	img, ok := frame.Image.(*image.YCbCr)
+	if !ok {
+		err = fmt.Errorf("ffmpeg: video encoder: image %T unsupported, convert by VideoScaler", frame.Image)
+		return
+	}
+	if err = self.fillFrame(img); err != nil {
+		return
+	}
+	ff.frame.pts = timeToVideoTs(frame.Time)
+	if frame.IsKeyFrame {
+		ff.frame.pict_type = C.AV_PICTURE_TYPE_I
+		ff.frame.key_frame = 1
+	} else {
+		ff.frame.pict_type = C.AV_PICTURE_TYPE_NONE
+		ff.frame.key_frame = 0
+	}
+	return self.encode(ff.frame)
+}
+
+// Packets delayed in encoder by lookahead and B-frames, encoder can't be used after it.
+func (self *VideoEncoder) Flush() (pkts []av.Packet, err error) {
+	if err = self.prepare(); err != nil {
+		return
+	}
+	return self.encode(nil)
+}
+
+func (self *VideoEncoder) Close() {
+	freeFFCtx(self.ff)
+}
+
+// libx264 if available, otherwise any H.264 encoder of ffmpeg.
+func NewVideoEncoder() (enc *VideoEncoder, err error) {
+	name := C.CString("libx264")
+	codec := C.avcodec_find_encoder_by_name(name)
+	C.free(unsafe.Pointer(name))
+	if codec == nil {
+		codec = C.avcodec_find_encoder(C.AV_CODEC_ID_H264)
+	}
+	if codec == nil {
+		err = fmt.Errorf("ffmpeg: cannot find h264 encoder")
+		return
+	}
+	_enc := &VideoEncoder{}
+	if _enc.ff, err = newFFCtxByCodec(codec); err != nil {
+		return
+	}
+	enc = _enc
+	return
+}
+
+// H.264 encoder by name, e.g: libx264, h264_nvenc, h264_videotoolbox.
+func NewVideoEncoderByName(name string) (enc *VideoEncoder, err error) {
+	cname := C.CString(name)
+	codec := C.avcodec_find_encoder_by_name(cname)
+	C.free(unsafe.Pointer(cname))
+	if codec == nil || codec.id != C.AV_CODEC_ID_H264 {
+		err = fmt.Errorf("ffmpeg: cannot find h264 encoder name=%s", name)
+		return
+	}
+	_enc := &VideoEncoder{}
+	if _enc.ff, err = newFFCtxByCodec(codec); err != nil {
+		return
+	}
+	enc = _enc
+	return
+}
@@ -0,0 +1,110 @@
+package ffmpeg
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec/h264parser"
+)
+
+func TestVideoEncoder(t *testing.T) {
+	enc, err := NewVideoEncoder()
+	if err != nil {
+		t.Skip(err)
+	}
+	defer enc.Close()
+	enc.Width, enc.Height = 64, 48
+	enc.GopSize = 10
+	enc.Preset = "ultrafast"
+	enc.Profile = "baseline"
+	enc.SetOption("tune", "zerolatency")
+
+	var tune string
+	if err = enc.GetOption("tune", &tune); err != nil || tune != "zerolatency" {
+		t.Fatalf("tune=%q err=%v", tune, err)
+	}
+
+	codec, err := enc.CodecData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Type() != av.H264 || codec.Width() != 64 || codec.Height() != 48 {
+		t.Fatalf("codec %v %dx%d", codec.Type(), codec.Width(), codec.Height())
+	}
+
+	var pkts []av.Packet
+	for i := 0; i < 30; i++ {
+		img := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+		for j := range img.Y {
+			img.Y[j] = uint8(i * 8)
+		}
+		out, err := enc.EncodeFrame(av.VideoFrame{
+			Image:      img,
+			Time:       time.Duration(i) * time.Second / 25,
+			IsKeyFrame: i == 15,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts = append(pkts, out...)
+	}
+	out, err := enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts = append(pkts, out...)
+
+	if len(pkts) != 30 {
+		t.Fatalf("got %d packets", len(pkts))
+	}
+	// frame with IsKeyFrame is IDR, flagged as key frame
+	for _, i := range []int{0, 15} {
+		if !pkts[i].IsKeyFrame {
+			t.Fatalf("packet #%d not key frame", i)
+		}
+	}
+	for i, pkt := range pkts {
+		if pkt.Time+pkt.CompositionTime != time.Duration(i)*time.Second/25 {
+			t.Fatalf("packet #%d pts=%v", i, pkt.Time+pkt.CompositionTime)
+		}
+		if _, typ := h264parser.SplitNALUs(pkt.Data); typ != h264parser.NALU_AVCC {
+			t.Fatalf("packet #%d not avcc", i)
+		}
+	}
+
+	// decoded by ffmpeg again
+	dec, err := NewVideoDecoder(codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	n := 0
+	for _, pkt := range pkts {
+		frames, err := dec.DecodePacket(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += len(frames)
+	}
+	frames, err := dec.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n += len(frames)
+	if n != 30 {
+		t.Fatalf("decoded %d frames", n)
+	}
+}
+
+func TestVideoTsConvert(t *testing.T) {
+	tm := time.Hour*48 + time.Second/25
+	ts := timeToVideoTs(tm)
+	if int64(ts) != 48*3600*90000+3600 {
+		t.Fatalf("ts=%d", int64(ts))
+	}
+	if videoTsToTime(ts) != tm {
+		t.Fatalf("time=%v", videoTsToTime(ts))
+	}
+}
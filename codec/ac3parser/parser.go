@@ -0,0 +1,475 @@
+package ac3parser
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/utils/bits"
+	"time"
+)
+
+const SyncWordLength = 2
+
+// E-AC-3 stream types
+const (
+	STREAM_INDEPENDENT = 0
+	STREAM_DEPENDENT   = 1
+	STREAM_AC3_CONVERT = 2
+)
+
+/*
+AC-3 syncframe header (ETSI TS 102 366 section 4.4)
+
+	syncword(16)=0x0B77
+	crc1(16)
+	fscod(2)
+	frmsizecod(6)
+	bsid(5)
+	bsmod(3)
+	acmod(3)
+	if (acmod & 0x1) && (acmod != 0x1) cmixlev(2)
+	if acmod & 0x4 surmixlev(2)
+	if acmod == 0x2 dsurmod(2)
+	lfeon(1)
+
+E-AC-3 syncframe header (ETSI TS 102 366 annex E)
+
+	syncword(16)=0x0B77
+	strmtyp(2)
+	substreamid(3)
+	frmsiz(11)
+	fscod(2)
+	if fscod == 0x3 fscod2(2) else numblkscod(2)
+	acmod(3)
+	lfeon(1)
+	bsid(5)
+
+bsid <= 8 is AC-3, 11-16 is E-AC-3.
+*/
+type SyncFrameHeader struct {
+	EAC3           bool
+	SampleRate     int
+	SampleRateCode uint // fscod
+	BitRateCode    uint // frmsizecod>>1, AC-3 only
+	Bsid           uint
+	Bsmod          uint
+	Acmod          uint
+	LFEOn          bool
+	StreamType     uint // strmtyp, E-AC-3 only
+	SubstreamId    uint // E-AC-3 only
+	FrameSize      int  // bytes
+	Samples        int
+}
+
+var ErrSyncFrameInvalid = fmt.Errorf("ac3parser: syncframe invalid")
+
+var sampleRateTable = []int{48000, 44100, 32000}
+
+// E-AC-3 reduced sample rates selected by fscod2
+var reducedSampleRateTable = []int{24000, 22050, 16000}
+
+// kbps, indexed by frmsizecod>>1
+var bitRateTable = []int{
+	32, 40, 48, 56, 64, 80, 96, 112, 128, 160,
+	192, 224, 256, 320, 384, 448, 512, 576, 640,
+}
+
+var blocksTable = []int{1, 2, 3, 6}
+
+// full bandwidth channels of each acmod
+var channelsTable = []int{2, 1, 2, 3, 3, 4, 4, 5}
+
+var chanLayoutTable = []av.ChannelLayout{
+	av.CH_STEREO, // 1+1 dual mono
+	av.CH_MONO,
+	av.CH_STEREO,
+	av.CH_SURROUND,
+	av.CH_STEREO | av.CH_BACK_CENTER,
+	av.CH_SURROUND | av.CH_BACK_CENTER,
+	av.CH_STEREO | av.CH_SIDE_LEFT | av.CH_SIDE_RIGHT,
+	av.CH_SURROUND | av.CH_SIDE_LEFT | av.CH_SIDE_RIGHT,
+}
+
+func IsSyncWord(b []byte) bool {
+	return len(b) >= SyncWordLength && b[0] == 0x0b && b[1] == 0x77
+}
+
+func ParseSyncFrameHeader(b []byte) (hdr SyncFrameHeader, err error) {
+	if len(b) < 6 || !IsSyncWord(b) {
+		err = ErrSyncFrameInvalid
+		return
+	}
+	// bsid is at the same position in both syntaxes
+	bsid := uint(b[5] >> 3)
+	switch {
+	case bsid <= 8:
+		return parseAC3Header(b)
+	case bsid >= 11 && bsid <= 16:
+		return parseEAC3Header(b)
+	}
+	err = fmt.Errorf("ac3parser: bsid=%d unsupported", bsid)
+	return
+}
+
+func parseAC3Header(b []byte) (hdr SyncFrameHeader, err error) {
+	br := &bits.GolombBitReader{R: bytes.NewReader(b[4:])}
+
+	if hdr.SampleRateCode, err = br.ReadBits(2); err != nil {
+		return
+	}
+	var frmsizecod uint
+	if frmsizecod, err = br.ReadBits(6); err != nil {
+		return
+	}
+	if hdr.SampleRateCode == 3 || frmsizecod >= uint(len(bitRateTable)*2) {
+		err = ErrSyncFrameInvalid
+		return
+	}
+	hdr.SampleRate = sampleRateTable[hdr.SampleRateCode]
+	hdr.BitRateCode = frmsizecod >> 1
+
+	// frame size in 16-bit words, 44.1kHz frames are padded by one word alternately
+	words := bitRateTable[hdr.BitRateCode] * 96000 / hdr.SampleRate
+	if hdr.SampleRate == 44100 {
+		words += int(frmsizecod & 1)
+	}
+	hdr.FrameSize = words * 2
+	hdr.Samples = 1536
+
+	if hdr.Bsid, err = br.ReadBits(5); err != nil {
+		return
+	}
+	if hdr.Bsmod, err = br.ReadBits(3); err != nil {
+		return
+	}
+	if hdr.Acmod, err = br.ReadBits(3); err != nil {
+		return
+	}
+	skip := 0
+	if hdr.Acmod&0x1 != 0 && hdr.Acmod != 0x1 {
+		skip += 2 // cmixlev
+	}
+	if hdr.Acmod&0x4 != 0 {
+		skip += 2 // surmixlev
+	}
+	if hdr.Acmod == 0x2 {
+		skip += 2 // dsurmod
+	}
+	if skip > 0 {
+		if _, err = br.ReadBits(skip); err != nil {
+			return
+		}
+	}
+	var lfeon uint
+	if lfeon, err = br.ReadBits(1); err != nil {
+		return
+	}
+	hdr.LFEOn = lfeon == 1
+	return
+}
+
+func parseEAC3Header(b []byte) (hdr SyncFrameHeader, err error) {
+	br := &bits.GolombBitReader{R: bytes.NewReader(b[2:])}
+	hdr.EAC3 = true
+
+	if hdr.StreamType, err = br.ReadBits(2); err != nil {
+		return
+	}
+	if hdr.SubstreamId, err = br.ReadBits(3); err != nil {
+		return
+	}
+	var frmsiz uint
+	if frmsiz, err = br.ReadBits(11); err != nil {
+		return
+	}
+	hdr.FrameSize = int(frmsiz+1) * 2
+
+	if hdr.SampleRateCode, err = br.ReadBits(2); err != nil {
+		return
+	}
+	var code uint
+	if code, err = br.ReadBits(2); err != nil {
+		return
+	}
+	if hdr.SampleRateCode == 3 {
+		// fscod2, always 6 blocks
+		if code == 3 {
+			err = ErrSyncFrameInvalid
+			return
+		}
+		hdr.SampleRate = reducedSampleRateTable[code]
+		hdr.Samples = 6 * 256
+	} else {
+		hdr.SampleRate = sampleRateTable[hdr.SampleRateCode]
+		hdr.Samples = blocksTable[code] * 256
+	}
+
+	if hdr.Acmod, err = br.ReadBits(3); err != nil {
+		return
+	}
+	var lfeon uint
+	if lfeon, err = br.ReadBits(1); err != nil {
+		return
+	}
+	hdr.LFEOn = lfeon == 1
+	if hdr.Bsid, err = br.ReadBits(5); err != nil {
+		return
+	}
+	return
+}
+
+func (self SyncFrameHeader) ChannelCount() int {
+	n := channelsTable[self.Acmod]
+	if self.LFEOn {
+		n++
+	}
+	return n
+}
+
+func (self SyncFrameHeader) ChannelLayout() av.ChannelLayout {
+	layout := chanLayoutTable[self.Acmod]
+	if self.LFEOn {
+		layout |= av.CH_LOW_FREQ
+	}
+	return layout
+}
+
+func (self SyncFrameHeader) Duration() time.Duration {
+	return time.Duration(self.Samples) * time.Second / time.Duration(self.SampleRate)
+}
+
+/*
+AC3SpecificBox (ETSI TS 102 366 annex F.4)
+
+	fscod(2)
+	bsid(5)
+	bsmod(3)
+	acmod(3)
+	lfeon(1)
+	bit_rate_code(5)
+	reserved(5)
+*/
+const Dac3Length = 3
+
+func ParseDac3(b []byte) (hdr SyncFrameHeader, err error) {
+	if len(b) < Dac3Length {
+		err = fmt.Errorf("ac3parser: dac3 invalid")
+		return
+	}
+	br := &bits.GolombBitReader{R: bytes.NewReader(b)}
+	hdr.SampleRateCode, _ = br.ReadBits(2)
+	hdr.Bsid, _ = br.ReadBits(5)
+	hdr.Bsmod, _ = br.ReadBits(3)
+	hdr.Acmod, _ = br.ReadBits(3)
+	lfeon, _ := br.ReadBits(1)
+	hdr.LFEOn = lfeon == 1
+	hdr.BitRateCode, _ = br.ReadBits(5)
+	if hdr.SampleRateCode == 3 || hdr.BitRateCode >= uint(len(bitRateTable)) {
+		err = fmt.Errorf("ac3parser: dac3 invalid")
+		return
+	}
+	hdr.SampleRate = sampleRateTable[hdr.SampleRateCode]
+	hdr.Samples = 1536
+	return
+}
+
+func FillDac3(b []byte, hdr SyncFrameHeader) (n int) {
+	v := uint32(hdr.SampleRateCode&0x3)<<22 |
+		uint32(hdr.Bsid&0x1f)<<17 |
+		uint32(hdr.Bsmod&0x7)<<14 |
+		uint32(hdr.Acmod&0x7)<<11 |
+		uint32(hdr.BitRateCode&0x1f)<<5
+	if hdr.LFEOn {
+		v |= 1 << 10
+	}
+	b[0] = byte(v >> 16)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v)
+	n = Dac3Length
+	return
+}
+
+/*
+EC3SpecificBox (ETSI TS 102 366 annex F.6)
+
+	data_rate(13)
+	num_ind_sub(3)
+	for (i = 0; i < num_ind_sub + 1; i++) {
+		fscod(2)
+		bsid(5)
+		reserved(1)
+		asvc(1)
+		bsmod(3)
+		acmod(3)
+		lfeon(1)
+		reserved(3)
+		num_dep_sub(4)
+		if num_dep_sub > 0 chan_loc(9) else reserved(1)
+	}
+
+Only the first independent substream is kept in SyncFrameHeader.
+*/
+func ParseDec3(b []byte) (hdr SyncFrameHeader, datarate int, err error) {
+	if len(b) < 5 {
+		err = fmt.Errorf("ac3parser: dec3 invalid")
+		return
+	}
+	br := &bits.GolombBitReader{R: bytes.NewReader(b)}
+	var v uint
+	v, _ = br.ReadBits(13)
+	datarate = int(v)
+	br.ReadBits(3)
+	hdr.EAC3 = true
+	hdr.SampleRateCode, _ = br.ReadBits(2)
+	hdr.Bsid, _ = br.ReadBits(5)
+	br.ReadBits(2)
+	hdr.Bsmod, _ = br.ReadBits(3)
+	hdr.Acmod, _ = br.ReadBits(3)
+	lfeon, _ := br.ReadBits(1)
+	hdr.LFEOn = lfeon == 1
+	if hdr.SampleRateCode == 3 {
+		err = fmt.Errorf("ac3parser: dec3 reduced sample rate unsupported")
+		return
+	}
+	hdr.SampleRate = sampleRateTable[hdr.SampleRateCode]
+	hdr.Samples = 1536
+	return
+}
+
+const Dec3Length = 5
+
+// Writes one independent substream without dependent substreams.
+func FillDec3(b []byte, hdr SyncFrameHeader, datarate int) (n int) {
+	b[0] = byte(datarate >> 5)
+	b[1] = byte(datarate << 3) // num_ind_sub=0
+	v := uint32(hdr.SampleRateCode&0x3)<<22 |
+		uint32(hdr.Bsid&0x1f)<<17 |
+		uint32(hdr.Bsmod&0x7)<<12 |
+		uint32(hdr.Acmod&0x7)<<9
+	if hdr.LFEOn {
+		v |= 1 << 8
+	}
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 8)
+	b[4] = byte(v)
+	n = Dec3Length
+	return
+}
+
+type CodecData struct {
+	Header SyncFrameHeader
+}
+
+func (self CodecData) Type() av.CodecType {
+	if self.Header.EAC3 {
+		return av.EAC3
+	}
+	return av.AC3
+}
+
+func (self CodecData) SampleRate() int {
+	return self.Header.SampleRate
+}
+
+func (self CodecData) ChannelLayout() av.ChannelLayout {
+	return self.Header.ChannelLayout()
+}
+
+func (self CodecData) SampleFormat() av.SampleFormat {
+	return av.FLTP
+}
+
+func (self CodecData) PacketDuration(data []byte) (dur time.Duration, err error) {
+	hdr := self.Header
+	if _hdr, _err := ParseSyncFrameHeader(data); _err == nil {
+		hdr = _hdr
+	}
+	dur = hdr.Duration()
+	return
+}
+
+// Bitrate in kbps, for E-AC-3 it is estimated from frame size.
+func (self CodecData) BitRate() int {
+	if !self.Header.EAC3 {
+		return bitRateTable[self.Header.BitRateCode]
+	}
+	if self.Header.Samples == 0 {
+		return 0
+	}
+	return self.Header.FrameSize * 8 * self.Header.SampleRate / self.Header.Samples / 1000
+}
+
+func (self CodecData) Dac3Bytes() []byte {
+	b := make([]byte, Dac3Length)
+	FillDac3(b, self.Header)
+	return b
+}
+
+func (self CodecData) Dec3Bytes() []byte {
+	b := make([]byte, Dec3Length)
+	FillDec3(b, self.Header, self.BitRate())
+	return b
+}
+
+func NewCodecDataFromSyncFrameHeader(hdr SyncFrameHeader) (self CodecData, err error) {
+	if hdr.SampleRate == 0 || hdr.Samples == 0 {
+		err = fmt.Errorf("ac3parser: sample rate invalid")
+		return
+	}
+	if hdr.EAC3 && hdr.StreamType == STREAM_DEPENDENT {
+		err = fmt.Errorf("ac3parser: codec data must come from independent substream")
+		return
+	}
+	self.Header = hdr
+	return
+}
+
+// Parse codec data from the first syncframe of packet.
+func NewCodecDataFromSyncFrame(frame []byte) (self CodecData, err error) {
+	var hdr SyncFrameHeader
+	if hdr, err = ParseSyncFrameHeader(frame); err != nil {
+		return
+	}
+	return NewCodecDataFromSyncFrameHeader(hdr)
+}
+
+func NewCodecDataFromDac3(b []byte) (self CodecData, err error) {
+	var hdr SyncFrameHeader
+	if hdr, err = ParseDac3(b); err != nil {
+		return
+	}
+	return NewCodecDataFromSyncFrameHeader(hdr)
+}
+
+func NewCodecDataFromDec3(b []byte) (self CodecData, err error) {
+	var hdr SyncFrameHeader
+	if hdr, _, err = ParseDec3(b); err != nil {
+		return
+	}
+	return NewCodecDataFromSyncFrameHeader(hdr)
+}
+
+// Splits a buffer of concatenated syncframes into access units. E-AC-3
+// dependent substreams are kept together with their independent substream.
+func SplitSyncFrames(b []byte) (frames [][]byte, hdrs []SyncFrameHeader, err error) {
+	for len(b) > 0 {
+		var hdr SyncFrameHeader
+		if hdr, err = ParseSyncFrameHeader(b); err != nil {
+			return
+		}
+		if hdr.FrameSize > len(b) {
+			err = fmt.Errorf("ac3parser: syncframe size=%d exceeds buffer", hdr.FrameSize)
+			return
+		}
+		if hdr.EAC3 && hdr.StreamType == STREAM_DEPENDENT && len(frames) > 0 {
+			// frames are contiguous in b, so extending the slice takes the substream
+			last := frames[len(frames)-1]
+			frames[len(frames)-1] = last[:len(last)+hdr.FrameSize]
+		} else {
+			frames = append(frames, b[:hdr.FrameSize])
+			hdrs = append(hdrs, hdr)
+		}
+		b = b[hdr.FrameSize:]
+	}
+	return
+}
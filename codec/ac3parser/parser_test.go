@@ -0,0 +1,72 @@
+package ac3parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	// AC-3 48kHz 384kbps 3/2 with lfe
+	hdr, err := ParseSyncFrameHeader([]byte{0x0b, 0x77, 0x00, 0x00, 0x1c, 0x40, 0xe1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.EAC3 || hdr.SampleRate != 48000 || hdr.Bsid != 8 || hdr.Acmod != 7 || !hdr.LFEOn {
+		t.Fatalf("hdr=%+v", hdr)
+	}
+	if hdr.FrameSize != 1536 || hdr.Samples != 1536 || hdr.ChannelCount() != 6 {
+		t.Fatalf("hdr=%+v", hdr)
+	}
+
+	codec, err := NewCodecDataFromSyncFrameHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.BitRate() != 384 || codec.ChannelLayout().Count() != 6 {
+		t.Fatalf("bitrate=%d layout=%v", codec.BitRate(), codec.ChannelLayout())
+	}
+	dac3 := codec.Dac3Bytes()
+	if !bytes.Equal(dac3, []byte{0x10, 0x3d, 0xc0}) {
+		t.Fatalf("dac3=%x", dac3)
+	}
+	if _codec, err := NewCodecDataFromDac3(dac3); err != nil || _codec.Header.ChannelCount() != 6 {
+		t.Fatalf("dac3 parse failed: %v", err)
+	}
+
+	// E-AC-3 48kHz 6 blocks stereo, 768 bytes
+	hdr, err = ParseSyncFrameHeader([]byte{0x0b, 0x77, 0x01, 0x7f, 0x34, 0x80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hdr.EAC3 || hdr.SampleRate != 48000 || hdr.Bsid != 16 || hdr.Acmod != 2 || hdr.LFEOn {
+		t.Fatalf("hdr=%+v", hdr)
+	}
+	if hdr.FrameSize != 768 || hdr.Samples != 1536 {
+		t.Fatalf("hdr=%+v", hdr)
+	}
+	if codec, err = NewCodecDataFromSyncFrameHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if codec.BitRate() != 192 {
+		t.Fatalf("bitrate=%d", codec.BitRate())
+	}
+	_codec, err := NewCodecDataFromDec3(codec.Dec3Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _codec.Header.SampleRate != 48000 || _codec.Header.Acmod != 2 || _codec.Header.Bsid != 16 {
+		t.Fatalf("dec3 hdr=%+v", _codec.Header)
+	}
+
+	// dependent substream is kept with the independent one
+	frames := make([]byte, 768+64)
+	copy(frames, []byte{0x0b, 0x77, 0x01, 0x7f, 0x34, 0x80})
+	copy(frames[768:], []byte{0x0b, 0x77, 0x40, 0x1f, 0x34, 0x80})
+	split, hdrs, err := SplitSyncFrames(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(split) != 1 || len(split[0]) != 768+64 || len(hdrs) != 1 {
+		t.Fatalf("split=%d", len(split))
+	}
+}
@@ -0,0 +1,696 @@
+package av1parser
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/utils/bits"
+)
+
+const (
+	OBU_SEQUENCE_HEADER        = 1
+	OBU_TEMPORAL_DELIMITER     = 2
+	OBU_FRAME_HEADER           = 3
+	OBU_TILE_GROUP             = 4
+	OBU_METADATA               = 5
+	OBU_FRAME                  = 6
+	OBU_REDUNDANT_FRAME_HEADER = 7
+	OBU_TILE_LIST              = 8
+	OBU_PADDING                = 15
+)
+
+/*
+obu_header
+
+	forbidden_bit(1)
+	obu_type(4)
+	obu_extension_flag(1)
+	obu_has_size_field(1)
+	obu_reserved_1bit(1)
+	if obu_extension_flag {
+		temporal_id(3)
+		spatial_id(2)
+		extension_header_reserved_3bits(3)
+	}
+	if obu_has_size_field {
+		obu_size(leb128)
+	}
+*/
+type OBUHeader struct {
+	Type         int
+	HasExtension bool
+	HasSize      bool
+	TemporalId   int
+	SpatialId    int
+	Size         int // payload size, -1 if no size field
+}
+
+var ErrOBUInvalid = fmt.Errorf("av1parser: obu invalid")
+
+func ReadLEB128(b []byte) (v uint64, n int, err error) {
+	for i := 0; i < 8; i++ {
+		if n >= len(b) {
+			err = ErrOBUInvalid
+			return
+		}
+		c := b[n]
+		v |= uint64(c&0x7f) << uint(i*7)
+		n++
+		if c&0x80 == 0 {
+			return
+		}
+	}
+	err = ErrOBUInvalid
+	return
+}
+
+func LEB128Len(v uint64) (n int) {
+	for {
+		n++
+		if v >>= 7; v == 0 {
+			return
+		}
+	}
+}
+
+func PutLEB128(b []byte, v uint64) (n int) {
+	for {
+		c := uint8(v & 0x7f)
+		if v >>= 7; v != 0 {
+			c |= 0x80
+		}
+		b[n] = c
+		n++
+		if v == 0 {
+			return
+		}
+	}
+}
+
+func ParseOBUHeader(b []byte) (hdr OBUHeader, hdrlen int, err error) {
+	if len(b) < 1 || b[0]&0x80 != 0 {
+		err = ErrOBUInvalid
+		return
+	}
+	hdr.Type = int(b[0]>>3) & 0xf
+	hdr.HasExtension = b[0]&0x4 != 0
+	hdr.HasSize = b[0]&0x2 != 0
+	hdrlen = 1
+	if hdr.HasExtension {
+		if len(b) < 2 {
+			err = ErrOBUInvalid
+			return
+		}
+		hdr.TemporalId = int(b[1] >> 5)
+		hdr.SpatialId = int(b[1]>>3) & 0x3
+		hdrlen++
+	}
+	hdr.Size = -1
+	if hdr.HasSize {
+		var size uint64
+		var n int
+		if size, n, err = ReadLEB128(b[hdrlen:]); err != nil {
+			return
+		}
+		hdr.Size = int(size)
+		hdrlen += n
+	}
+	return
+}
+
+// Split low overhead bitstream (obu with size field) into obus, header included.
+func SplitOBUs(b []byte) (obus [][]byte, err error) {
+	for len(b) > 0 {
+		var hdr OBUHeader
+		var hdrlen int
+		if hdr, hdrlen, err = ParseOBUHeader(b); err != nil {
+			return
+		}
+		size := len(b) - hdrlen
+		if hdr.HasSize {
+			size = hdr.Size
+		}
+		if hdrlen+size > len(b) {
+			err = ErrOBUInvalid
+			return
+		}
+		obus = append(obus, b[:hdrlen+size])
+		b = b[hdrlen+size:]
+	}
+	return
+}
+
+// Payload of obu, without header and size field.
+func OBUPayload(obu []byte) (payload []byte, err error) {
+	var hdr OBUHeader
+	var hdrlen int
+	if hdr, hdrlen, err = ParseOBUHeader(obu); err != nil {
+		return
+	}
+	payload = obu[hdrlen:]
+	if hdr.HasSize {
+		if hdr.Size > len(payload) {
+			err = ErrOBUInvalid
+			return
+		}
+		payload = payload[:hdr.Size]
+	}
+	return
+}
+
+// A temporal unit starting with a sequence header is a random access point.
+func IsKeyFrame(b []byte) bool {
+	obus, _ := SplitOBUs(b)
+	for _, obu := range obus {
+		switch int(obu[0]>>3) & 0xf {
+		case OBU_TEMPORAL_DELIMITER:
+		case OBU_SEQUENCE_HEADER:
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+type SequenceHeader struct {
+	SeqProfile              uint
+	StillPicture            uint
+	ReducedStillPictureHdr  uint
+	SeqLevelIdx0            uint
+	SeqTier0                uint
+	InitialDisplayDelay0    uint // initial_display_delay_minus_1 + 1, 0 if not present
+	MaxFrameWidthMinus1     uint
+	MaxFrameHeightMinus1    uint
+	HighBitdepth            uint
+	TwelveBit               uint
+	MonoChrome              uint
+	ColorPrimaries          uint
+	TransferCharacteristics uint
+	MatrixCoefficients      uint
+	ColorRange              uint
+	ChromaSubsamplingX      uint
+	ChromaSubsamplingY      uint
+	ChromaSamplePosition    uint
+}
+
+func (self SequenceHeader) Width() int {
+	return int(self.MaxFrameWidthMinus1) + 1
+}
+
+func (self SequenceHeader) Height() int {
+	return int(self.MaxFrameHeightMinus1) + 1
+}
+
+func (self SequenceHeader) BitDepth() int {
+	switch {
+	case self.TwelveBit != 0:
+		return 12
+	case self.HighBitdepth != 0:
+		return 10
+	}
+	return 8
+}
+
+// Parse sequence header obu, header included. See AV1 spec 5.5.
+func ParseSequenceHeader(obu []byte) (self SequenceHeader, err error) {
+	var hdr OBUHeader
+	if hdr, _, err = ParseOBUHeader(obu); err != nil {
+		return
+	}
+	if hdr.Type != OBU_SEQUENCE_HEADER {
+		err = fmt.Errorf("av1parser: obu type=%d is not sequence header", hdr.Type)
+		return
+	}
+	var payload []byte
+	if payload, err = OBUPayload(obu); err != nil {
+		return
+	}
+	r := &bits.GolombBitReader{R: bytes.NewReader(payload)}
+
+	if self.SeqProfile, err = r.ReadBits(3); err != nil {
+		return
+	}
+	if self.StillPicture, err = r.ReadBit(); err != nil {
+		return
+	}
+	if self.ReducedStillPictureHdr, err = r.ReadBit(); err != nil {
+		return
+	}
+
+	if self.ReducedStillPictureHdr != 0 {
+		if self.SeqLevelIdx0, err = r.ReadBits(5); err != nil {
+			return
+		}
+	} else {
+		var timingInfoPresent, decoderModelInfoPresent, initialDisplayDelayPresent uint
+		var bufferDelayLength uint
+
+		if timingInfoPresent, err = r.ReadBit(); err != nil {
+			return
+		}
+		if timingInfoPresent != 0 {
+			// num_units_in_display_tick, time_scale
+			if _, err = r.ReadBits(32); err != nil {
+				return
+			}
+			if _, err = r.ReadBits(32); err != nil {
+				return
+			}
+			var equalPictureInterval uint
+			if equalPictureInterval, err = r.ReadBit(); err != nil {
+				return
+			}
+			if equalPictureInterval != 0 {
+				// num_ticks_per_picture_minus_1 uvlc
+				if _, err = r.ReadExponentialGolombCode(); err != nil {
+					return
+				}
+			}
+
+			if decoderModelInfoPresent, err = r.ReadBit(); err != nil {
+				return
+			}
+			if decoderModelInfoPresent != 0 {
+				if bufferDelayLength, err = r.ReadBits(5); err != nil {
+					return
+				}
+				bufferDelayLength++
+				// num_units_in_decoding_tick
+				if _, err = r.ReadBits(32); err != nil {
+					return
+				}
+				// buffer_removal_time_length_minus_1, frame_presentation_time_length_minus_1
+				if _, err = r.ReadBits(10); err != nil {
+					return
+				}
+			}
+		}
+
+		if initialDisplayDelayPresent, err = r.ReadBit(); err != nil {
+			return
+		}
+		var operatingPointsCnt uint
+		if operatingPointsCnt, err = r.ReadBits(5); err != nil {
+			return
+		}
+		operatingPointsCnt++
+
+		for i := uint(0); i < operatingPointsCnt; i++ {
+			var levelIdx, tier uint
+			// operating_point_idc
+			if _, err = r.ReadBits(12); err != nil {
+				return
+			}
+			if levelIdx, err = r.ReadBits(5); err != nil {
+				return
+			}
+			if levelIdx > 7 {
+				if tier, err = r.ReadBit(); err != nil {
+					return
+				}
+			}
+			if decoderModelInfoPresent != 0 {
+				var decoderModelPresent uint
+				if decoderModelPresent, err = r.ReadBit(); err != nil {
+					return
+				}
+				if decoderModelPresent != 0 {
+					// decoder_buffer_delay, encoder_buffer_delay, low_delay_mode_flag
+					if _, err = r.ReadBits(int(bufferDelayLength*2 + 1)); err != nil {
+						return
+					}
+				}
+			}
+			var displayDelay uint
+			if initialDisplayDelayPresent != 0 {
+				var displayDelayPresent uint
+				if displayDelayPresent, err = r.ReadBit(); err != nil {
+					return
+				}
+				if displayDelayPresent != 0 {
+					if displayDelay, err = r.ReadBits(4); err != nil {
+						return
+					}
+					displayDelay++
+				}
+			}
+			if i == 0 {
+				self.SeqLevelIdx0 = levelIdx
+				self.SeqTier0 = tier
+				self.InitialDisplayDelay0 = displayDelay
+			}
+		}
+	}
+
+	var frameWidthBits, frameHeightBits uint
+	if frameWidthBits, err = r.ReadBits(4); err != nil {
+		return
+	}
+	if frameHeightBits, err = r.ReadBits(4); err != nil {
+		return
+	}
+	if self.MaxFrameWidthMinus1, err = r.ReadBits(int(frameWidthBits + 1)); err != nil {
+		return
+	}
+	if self.MaxFrameHeightMinus1, err = r.ReadBits(int(frameHeightBits + 1)); err != nil {
+		return
+	}
+
+	if self.ReducedStillPictureHdr == 0 {
+		var frameIdNumbersPresent uint
+		if frameIdNumbersPresent, err = r.ReadBit(); err != nil {
+			return
+		}
+		if frameIdNumbersPresent != 0 {
+			// delta_frame_id_length_minus_2, additional_frame_id_length_minus_1
+			if _, err = r.ReadBits(7); err != nil {
+				return
+			}
+		}
+	}
+
+	// use_128x128_superblock, enable_filter_intra, enable_intra_edge_filter
+	if _, err = r.ReadBits(3); err != nil {
+		return
+	}
+
+	if self.ReducedStillPictureHdr == 0 {
+		// enable_interintra_compound, enable_masked_compound,
+		// enable_warped_motion, enable_dual_filter
+		if _, err = r.ReadBits(4); err != nil {
+			return
+		}
+		var enableOrderHint uint
+		if enableOrderHint, err = r.ReadBit(); err != nil {
+			return
+		}
+		if enableOrderHint != 0 {
+			// enable_jnt_comp, enable_ref_frame_mvs
+			if _, err = r.ReadBits(2); err != nil {
+				return
+			}
+		}
+		var chooseScreenContentTools uint
+		forceScreenContentTools := uint(2)
+		if chooseScreenContentTools, err = r.ReadBit(); err != nil {
+			return
+		}
+		if chooseScreenContentTools == 0 {
+			if forceScreenContentTools, err = r.ReadBit(); err != nil {
+				return
+			}
+		}
+		if forceScreenContentTools > 0 {
+			var chooseIntegerMv uint
+			if chooseIntegerMv, err = r.ReadBit(); err != nil {
+				return
+			}
+			if chooseIntegerMv == 0 {
+				// seq_force_integer_mv
+				if _, err = r.ReadBit(); err != nil {
+					return
+				}
+			}
+		}
+		if enableOrderHint != 0 {
+			// order_hint_bits_minus_1
+			if _, err = r.ReadBits(3); err != nil {
+				return
+			}
+		}
+	}
+
+	// enable_superres, enable_cdef, enable_restoration
+	if _, err = r.ReadBits(3); err != nil {
+		return
+	}
+
+	if err = (&self).parseColorConfig(r); err != nil {
+		return
+	}
+	return
+}
+
+const (
+	CP_BT_709      = 1
+	CP_UNSPECIFIED = 2
+	TC_UNSPECIFIED = 2
+	TC_SRGB        = 13
+	MC_IDENTITY    = 0
+	MC_UNSPECIFIED = 2
+)
+
+func (self *SequenceHeader) parseColorConfig(r *bits.GolombBitReader) (err error) {
+	if self.HighBitdepth, err = r.ReadBit(); err != nil {
+		return
+	}
+	if self.SeqProfile == 2 && self.HighBitdepth != 0 {
+		if self.TwelveBit, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+	if self.SeqProfile != 1 {
+		if self.MonoChrome, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+
+	var colorDescriptionPresent uint
+	if colorDescriptionPresent, err = r.ReadBit(); err != nil {
+		return
+	}
+	if colorDescriptionPresent != 0 {
+		if self.ColorPrimaries, err = r.ReadBits(8); err != nil {
+			return
+		}
+		if self.TransferCharacteristics, err = r.ReadBits(8); err != nil {
+			return
+		}
+		if self.MatrixCoefficients, err = r.ReadBits(8); err != nil {
+			return
+		}
+	} else {
+		self.ColorPrimaries = CP_UNSPECIFIED
+		self.TransferCharacteristics = TC_UNSPECIFIED
+		self.MatrixCoefficients = MC_UNSPECIFIED
+	}
+
+	if self.MonoChrome != 0 {
+		if self.ColorRange, err = r.ReadBit(); err != nil {
+			return
+		}
+		self.ChromaSubsamplingX = 1
+		self.ChromaSubsamplingY = 1
+		return
+	}
+
+	if self.ColorPrimaries == CP_BT_709 && self.TransferCharacteristics == TC_SRGB && self.MatrixCoefficients == MC_IDENTITY {
+		self.ColorRange = 1
+		return
+	}
+
+	if self.ColorRange, err = r.ReadBit(); err != nil {
+		return
+	}
+	switch self.SeqProfile {
+	case 0:
+		self.ChromaSubsamplingX = 1
+		self.ChromaSubsamplingY = 1
+	case 1:
+	default:
+		if self.BitDepth() == 12 {
+			if self.ChromaSubsamplingX, err = r.ReadBit(); err != nil {
+				return
+			}
+			if self.ChromaSubsamplingX != 0 {
+				if self.ChromaSubsamplingY, err = r.ReadBit(); err != nil {
+					return
+				}
+			}
+		} else {
+			self.ChromaSubsamplingX = 1
+		}
+	}
+	if self.ChromaSubsamplingX != 0 && self.ChromaSubsamplingY != 0 {
+		if self.ChromaSamplePosition, err = r.ReadBits(2); err != nil {
+			return
+		}
+	}
+	return
+}
+
+/*
+AV1CodecConfigurationRecord (https://aomediacodec.github.io/av1-isobmff/#av1codecconfigurationbox-syntax)
+
+	marker(1)=1
+	version(7)=1
+	seq_profile(3)
+	seq_level_idx_0(5)
+	seq_tier_0(1)
+	high_bitdepth(1)
+	twelve_bit(1)
+	monochrome(1)
+	chroma_subsampling_x(1)
+	chroma_subsampling_y(1)
+	chroma_sample_position(2)
+	reserved(3)=0
+	initial_presentation_delay_present(1)
+	initial_presentation_delay_minus_one(4)
+	configOBUs
+*/
+type AV1CodecConfRecord struct {
+	SeqProfile                       uint8
+	SeqLevelIdx0                     uint8
+	SeqTier0                         uint8
+	HighBitdepth                     uint8
+	TwelveBit                        uint8
+	MonoChrome                       uint8
+	ChromaSubsamplingX               uint8
+	ChromaSubsamplingY               uint8
+	ChromaSamplePosition             uint8
+	InitialPresentationDelayPresent  uint8
+	InitialPresentationDelayMinusOne uint8
+	ConfigOBUs                       []byte
+}
+
+var ErrAV1CodecConfRecordInvalid = fmt.Errorf("av1parser: AV1CodecConfigurationRecord invalid")
+
+func (self *AV1CodecConfRecord) Unmarshal(b []byte) (n int, err error) {
+	if len(b) < 4 || b[0] != 0x81 {
+		err = ErrAV1CodecConfRecordInvalid
+		return
+	}
+	self.SeqProfile = b[1] >> 5
+	self.SeqLevelIdx0 = b[1] & 0x1f
+	self.SeqTier0 = b[2] >> 7
+	self.HighBitdepth = (b[2] >> 6) & 1
+	self.TwelveBit = (b[2] >> 5) & 1
+	self.MonoChrome = (b[2] >> 4) & 1
+	self.ChromaSubsamplingX = (b[2] >> 3) & 1
+	self.ChromaSubsamplingY = (b[2] >> 2) & 1
+	self.ChromaSamplePosition = b[2] & 0x3
+	self.InitialPresentationDelayPresent = (b[3] >> 4) & 1
+	self.InitialPresentationDelayMinusOne = b[3] & 0xf
+	self.ConfigOBUs = b[4:]
+	n = len(b)
+	return
+}
+
+func (self AV1CodecConfRecord) Len() (n int) {
+	return 4 + len(self.ConfigOBUs)
+}
+
+func (self AV1CodecConfRecord) Marshal(b []byte) (n int) {
+	b[0] = 0x81
+	b[1] = self.SeqProfile<<5 | self.SeqLevelIdx0&0x1f
+	b[2] = self.SeqTier0<<7 | self.HighBitdepth<<6 | self.TwelveBit<<5 | self.MonoChrome<<4 |
+		self.ChromaSubsamplingX<<3 | self.ChromaSubsamplingY<<2 | self.ChromaSamplePosition&0x3
+	b[3] = self.InitialPresentationDelayPresent<<4 | self.InitialPresentationDelayMinusOne&0xf
+	n = 4
+	n += copy(b[n:], self.ConfigOBUs)
+	return
+}
+
+type CodecData struct {
+	Record     []byte
+	RecordInfo AV1CodecConfRecord
+	SeqHdr     SequenceHeader
+	SeqHdrOBU  []byte
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.AV1
+}
+
+func (self CodecData) AV1CodecConfRecordBytes() []byte {
+	return self.Record
+}
+
+// Sequence header obu with size field.
+func (self CodecData) SequenceHeaderOBU() []byte {
+	return self.SeqHdrOBU
+}
+
+func (self CodecData) Width() int {
+	return self.SeqHdr.Width()
+}
+
+func (self CodecData) Height() int {
+	return self.SeqHdr.Height()
+}
+
+func NewCodecDataFromAV1CodecConfRecord(record []byte) (self CodecData, err error) {
+	self.Record = record
+	if _, err = (&self.RecordInfo).Unmarshal(record); err != nil {
+		return
+	}
+	var obus [][]byte
+	if obus, err = SplitOBUs(self.RecordInfo.ConfigOBUs); err != nil {
+		return
+	}
+	for _, obu := range obus {
+		if int(obu[0]>>3)&0xf == OBU_SEQUENCE_HEADER {
+			self.SeqHdrOBU = obu
+			break
+		}
+	}
+	if self.SeqHdrOBU == nil {
+		err = fmt.Errorf("av1parser: no sequence header found in AV1CodecConfigurationRecord")
+		return
+	}
+	if self.SeqHdr, err = ParseSequenceHeader(self.SeqHdrOBU); err != nil {
+		err = fmt.Errorf("av1parser: parse sequence header failed(%s)", err)
+		return
+	}
+	return
+}
+
+// Make codec data from sequence header obu, size field is added if missing.
+func NewCodecDataFromSequenceHeader(obu []byte) (self CodecData, err error) {
+	var hdr OBUHeader
+	var hdrlen int
+	if hdr, hdrlen, err = ParseOBUHeader(obu); err != nil {
+		return
+	}
+	if !hdr.HasSize {
+		payload := obu[hdrlen:]
+		b := make([]byte, hdrlen+LEB128Len(uint64(len(payload)))+len(payload))
+		copy(b, obu[:hdrlen])
+		b[0] |= 0x2
+		n := hdrlen
+		n += PutLEB128(b[n:], uint64(len(payload)))
+		copy(b[n:], payload)
+		obu = b
+	} else if hdrlen+hdr.Size < len(obu) {
+		obu = obu[:hdrlen+hdr.Size]
+	}
+
+	if self.SeqHdr, err = ParseSequenceHeader(obu); err != nil {
+		return
+	}
+	self.SeqHdrOBU = obu
+
+	info := self.SeqHdr
+	recordinfo := AV1CodecConfRecord{}
+	recordinfo.SeqProfile = uint8(info.SeqProfile)
+	recordinfo.SeqLevelIdx0 = uint8(info.SeqLevelIdx0)
+	recordinfo.SeqTier0 = uint8(info.SeqTier0)
+	recordinfo.HighBitdepth = uint8(info.HighBitdepth)
+	recordinfo.TwelveBit = uint8(info.TwelveBit)
+	recordinfo.MonoChrome = uint8(info.MonoChrome)
+	recordinfo.ChromaSubsamplingX = uint8(info.ChromaSubsamplingX)
+	recordinfo.ChromaSubsamplingY = uint8(info.ChromaSubsamplingY)
+	recordinfo.ChromaSamplePosition = uint8(info.ChromaSamplePosition)
+	if info.InitialDisplayDelay0 > 0 {
+		recordinfo.InitialPresentationDelayPresent = 1
+		recordinfo.InitialPresentationDelayMinusOne = uint8(info.InitialDisplayDelay0 - 1)
+	}
+	recordinfo.ConfigOBUs = obu
+
+	buf := make([]byte, recordinfo.Len())
+	recordinfo.Marshal(buf)
+	self.RecordInfo = recordinfo
+	self.Record = buf
+	return
+}
@@ -0,0 +1,43 @@
+package av1parser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	seqhdr, _ := hex.DecodeString("0a0b00000042abbfc373ffe601")
+
+	codec, err := NewCodecDataFromSequenceHeader(seqhdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Width() != 1920 || codec.Height() != 1080 {
+		t.Fatalf("size=%dx%d", codec.Width(), codec.Height())
+	}
+	if codec.SeqHdr.SeqProfile != 0 || codec.SeqHdr.SeqLevelIdx0 != 8 || codec.SeqHdr.BitDepth() != 8 {
+		t.Fatalf("seqhdr=%+v", codec.SeqHdr)
+	}
+
+	codec2, err := NewCodecDataFromAV1CodecConfRecord(codec.AV1CodecConfRecordBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(codec2.SequenceHeaderOBU(), seqhdr) {
+		t.Fatal("sequence header mismatch")
+	}
+	if codec2.RecordInfo.ChromaSubsamplingX != 1 || codec2.RecordInfo.ChromaSubsamplingY != 1 {
+		t.Fatalf("record=%+v", codec2.RecordInfo)
+	}
+
+	// temporal delimiter + sequence header
+	tu := append([]byte{0x12, 0x00}, seqhdr...)
+	obus, err := SplitOBUs(tu)
+	if err != nil || len(obus) != 2 {
+		t.Fatalf("obus=%d err=%v", len(obus), err)
+	}
+	if !IsKeyFrame(tu) {
+		t.Fatal("should be keyframe")
+	}
+}
@@ -62,3 +62,36 @@ func NewSpeexCodecData(sr int, cl av.ChannelLayout) SpeexCodecData {
 	return codec
 }
 
+
+type DataCodecData struct {
+	typ       av.CodecType
+	extradata []byte
+}
+
+func (self DataCodecData) Type() av.CodecType {
+	return self.typ
+}
+
+func (self DataCodecData) Extradata() []byte {
+	return self.extradata
+}
+
+func NewID3CodecData() av.DataCodecData {
+	return DataCodecData{
+		typ: av.ID3,
+	}
+}
+
+func NewAMF0CodecData() av.DataCodecData {
+	return DataCodecData{
+		typ: av.AMF0,
+	}
+}
+
+// desc is the tx3g sample entry after data reference index.
+func NewTX3GCodecData(desc []byte) av.DataCodecData {
+	return DataCodecData{
+		typ:       av.TX3G,
+		extradata: desc,
+	}
+}
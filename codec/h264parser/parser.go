@@ -21,6 +21,26 @@ func IsDataNALU(b []byte) bool {
 	return typ >= 1 && typ <= 5
 }
 
+// Prepend nal units to AVCC packet data, e.g: SEI in packet side data.
+// H265 uses the same 4 bytes length prefix so it works as well.
+func PrependNALUsToAVCC(nalus [][]byte, data []byte) []byte {
+	if len(nalus) == 0 {
+		return data
+	}
+	n := len(data)
+	for _, nalu := range nalus {
+		n += 4 + len(nalu)
+	}
+	b := make([]byte, 0, n)
+	for _, nalu := range nalus {
+		var h [4]byte
+		pio.PutU32BE(h[:], uint32(len(nalu)))
+		b = append(b, h[:]...)
+		b = append(b, nalu...)
+	}
+	return append(b, data...)
+}
+
 /*
 From: http://stackoverflow.com/questions/24884827/possible-locations-for-sequence-picture-parameter-sets-for-h-264-stream
 
@@ -0,0 +1,604 @@
+package h265parser
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/utils/bits"
+	"github.com/nareix/joy4/utils/bits/pio"
+)
+
+// copied from libavcodec/hevc.h
+const (
+	NALU_TRAIL_N    = 0
+	NALU_TRAIL_R    = 1
+	NALU_BLA_W_LP   = 16
+	NALU_BLA_W_RADL = 17
+	NALU_BLA_N_LP   = 18
+	NALU_IDR_W_RADL = 19
+	NALU_IDR_N_LP   = 20
+	NALU_CRA_NUT    = 21
+	NALU_VPS        = 32
+	NALU_SPS        = 33
+	NALU_PPS        = 34
+	NALU_AUD        = 35
+	NALU_EOS        = 36
+	NALU_EOB        = 37
+	NALU_FD         = 38
+	NALU_SEI_PREFIX = 39
+	NALU_SEI_SUFFIX = 40
+	NALU_AP         = 48   // rtp aggregation packet
+	NALU_FU         = 49   // rtp fragmentation unit
+	NALU_INVALID    = 0xff // returned by NALUType for empty nalu
+)
+
+/*
+The HEVC NAL unit header is two bytes long:
+
++---------------+---------------+
+|0|1|2|3|4|5|6|7|0|1|2|3|4|5|6|7|
++-+-------------+---------+-----+
+|F|   Type    |  LayerId  | TID |
++-------------+-----------------+
+
+Annex B and AVCC framing are the same as H264, so SplitNALUs can be shared.
+*/
+
+func NALUType(b []byte) uint8 {
+	if len(b) == 0 {
+		return NALU_INVALID
+	}
+	return (b[0] >> 1) & 0x3f
+}
+
+func IsDataNALU(b []byte) bool {
+	return NALUType(b) < NALU_VPS
+}
+
+// IRAP pictures (BLA/IDR/CRA) can be decoded without reference to previous pictures.
+func IsKeyFrameNALU(b []byte) bool {
+	typ := NALUType(b)
+	return typ >= NALU_BLA_W_LP && typ <= 23
+}
+
+var StartCodeBytes = []byte{0, 0, 1}
+var AUDBytes = []byte{0, 0, 0, 1, 0x46, 0x01, 0x50, 0, 0, 0, 1} // AUD
+
+const (
+	NALU_RAW    = h264parser.NALU_RAW
+	NALU_AVCC   = h264parser.NALU_AVCC
+	NALU_ANNEXB = h264parser.NALU_ANNEXB
+)
+
+func SplitNALUs(b []byte) (nalus [][]byte, typ int) {
+	return h264parser.SplitNALUs(b)
+}
+
+// remove emulation prevention bytes 0x000003 -> 0x0000
+func nalToRBSP(b []byte) []byte {
+	if bytes.Index(b, []byte{0, 0, 3}) == -1 {
+		return b
+	}
+	rbsp := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, c)
+	}
+	return rbsp
+}
+
+type ProfileTierLevel struct {
+	ProfileSpace              uint
+	TierFlag                  uint
+	ProfileIdc                uint
+	ProfileCompatibilityFlags uint32
+	ConstraintIndicatorFlags  uint64
+	LevelIdc                  uint
+}
+
+func parseProfileTierLevel(r *bits.GolombBitReader, maxSubLayersMinus1 uint) (self ProfileTierLevel, err error) {
+	if self.ProfileSpace, err = r.ReadBits(2); err != nil {
+		return
+	}
+	if self.TierFlag, err = r.ReadBits(1); err != nil {
+		return
+	}
+	if self.ProfileIdc, err = r.ReadBits(5); err != nil {
+		return
+	}
+	var u uint
+	if u, err = r.ReadBits(32); err != nil {
+		return
+	}
+	self.ProfileCompatibilityFlags = uint32(u)
+	// progressive_source_flag, interlaced_source_flag, non_packed_constraint_flag,
+	// frame_only_constraint_flag, reserved_zero_43bits, inbld_flag
+	if u, err = r.ReadBits(48); err != nil {
+		return
+	}
+	self.ConstraintIndicatorFlags = uint64(u)
+	if self.LevelIdc, err = r.ReadBits(8); err != nil {
+		return
+	}
+
+	subLayerProfilePresent := make([]uint, maxSubLayersMinus1)
+	subLayerLevelPresent := make([]uint, maxSubLayersMinus1)
+	for i := uint(0); i < maxSubLayersMinus1; i++ {
+		if subLayerProfilePresent[i], err = r.ReadBit(); err != nil {
+			return
+		}
+		if subLayerLevelPresent[i], err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+	if maxSubLayersMinus1 > 0 {
+		for i := maxSubLayersMinus1; i < 8; i++ {
+			// reserved_zero_2bits
+			if _, err = r.ReadBits(2); err != nil {
+				return
+			}
+		}
+	}
+	for i := uint(0); i < maxSubLayersMinus1; i++ {
+		if subLayerProfilePresent[i] != 0 {
+			// sub_layer_profile_space ... sub_layer_inbld_flag
+			if _, err = r.ReadBits(32); err != nil {
+				return
+			}
+			if _, err = r.ReadBits(32); err != nil {
+				return
+			}
+			if _, err = r.ReadBits(24); err != nil {
+				return
+			}
+		}
+		if subLayerLevelPresent[i] != 0 {
+			// sub_layer_level_idc
+			if _, err = r.ReadBits(8); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+type VPSInfo struct {
+	Id                 uint
+	MaxSubLayersMinus1 uint
+	TemporalIdNesting  uint
+	ProfileTierLevel
+}
+
+func ParseVPS(data []byte) (self VPSInfo, err error) {
+	if len(data) < 2 {
+		err = fmt.Errorf("h265parser: vps too short")
+		return
+	}
+	r := &bits.GolombBitReader{R: bytes.NewReader(nalToRBSP(data[2:]))}
+
+	// vps_video_parameter_set_id
+	if self.Id, err = r.ReadBits(4); err != nil {
+		return
+	}
+	// vps_base_layer_internal_flag, vps_base_layer_available_flag, vps_max_layers_minus1
+	if _, err = r.ReadBits(8); err != nil {
+		return
+	}
+	if self.MaxSubLayersMinus1, err = r.ReadBits(3); err != nil {
+		return
+	}
+	if self.TemporalIdNesting, err = r.ReadBit(); err != nil {
+		return
+	}
+	// vps_reserved_0xffff_16bits
+	if _, err = r.ReadBits(16); err != nil {
+		return
+	}
+	if self.ProfileTierLevel, err = parseProfileTierLevel(r, self.MaxSubLayersMinus1); err != nil {
+		return
+	}
+	return
+}
+
+type SPSInfo struct {
+	VPSId              uint
+	MaxSubLayersMinus1 uint
+	TemporalIdNesting  uint
+	ProfileTierLevel
+
+	Id                     uint
+	ChromaFormatIdc        uint
+	PicWidthInLumaSamples  uint
+	PicHeightInLumaSamples uint
+
+	CropLeft   uint
+	CropRight  uint
+	CropTop    uint
+	CropBottom uint
+
+	BitDepthLumaMinus8   uint
+	BitDepthChromaMinus8 uint
+
+	Width  uint
+	Height uint
+}
+
+func ParseSPS(data []byte) (self SPSInfo, err error) {
+	if len(data) < 2 {
+		err = fmt.Errorf("h265parser: sps too short")
+		return
+	}
+	r := &bits.GolombBitReader{R: bytes.NewReader(nalToRBSP(data[2:]))}
+
+	if self.VPSId, err = r.ReadBits(4); err != nil {
+		return
+	}
+	if self.MaxSubLayersMinus1, err = r.ReadBits(3); err != nil {
+		return
+	}
+	if self.TemporalIdNesting, err = r.ReadBit(); err != nil {
+		return
+	}
+	if self.ProfileTierLevel, err = parseProfileTierLevel(r, self.MaxSubLayersMinus1); err != nil {
+		return
+	}
+
+	// sps_seq_parameter_set_id
+	if self.Id, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+
+	if self.ChromaFormatIdc, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if self.ChromaFormatIdc == 3 {
+		// separate_colour_plane_flag
+		if _, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+
+	if self.PicWidthInLumaSamples, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if self.PicHeightInLumaSamples, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+
+	var conformance_window_flag uint
+	if conformance_window_flag, err = r.ReadBit(); err != nil {
+		return
+	}
+	if conformance_window_flag != 0 {
+		if self.CropLeft, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		if self.CropRight, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		if self.CropTop, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+		if self.CropBottom, err = r.ReadExponentialGolombCode(); err != nil {
+			return
+		}
+	}
+
+	if self.BitDepthLumaMinus8, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if self.BitDepthChromaMinus8, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+
+	subWidthC, subHeightC := uint(1), uint(1)
+	switch self.ChromaFormatIdc {
+	case 1:
+		subWidthC, subHeightC = 2, 2
+	case 2:
+		subWidthC = 2
+	}
+	self.Width = self.PicWidthInLumaSamples - subWidthC*(self.CropLeft+self.CropRight)
+	self.Height = self.PicHeightInLumaSamples - subHeightC*(self.CropTop+self.CropBottom)
+
+	return
+}
+
+type PPSInfo struct {
+	Id    uint
+	SPSId uint
+}
+
+func ParsePPS(data []byte) (self PPSInfo, err error) {
+	if len(data) < 2 {
+		err = fmt.Errorf("h265parser: pps too short")
+		return
+	}
+	r := &bits.GolombBitReader{R: bytes.NewReader(nalToRBSP(data[2:]))}
+
+	if self.Id, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	if self.SPSId, err = r.ReadExponentialGolombCode(); err != nil {
+		return
+	}
+	return
+}
+
+type CodecData struct {
+	Record     []byte
+	RecordInfo HEVCDecoderConfRecord
+	SPSInfo    SPSInfo
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.H265
+}
+
+func (self CodecData) HEVCDecoderConfRecordBytes() []byte {
+	return self.Record
+}
+
+func (self CodecData) VPS() []byte {
+	return self.RecordInfo.VPS[0]
+}
+
+func (self CodecData) SPS() []byte {
+	return self.RecordInfo.SPS[0]
+}
+
+func (self CodecData) PPS() []byte {
+	return self.RecordInfo.PPS[0]
+}
+
+func (self CodecData) Width() int {
+	return int(self.SPSInfo.Width)
+}
+
+func (self CodecData) Height() int {
+	return int(self.SPSInfo.Height)
+}
+
+func NewCodecDataFromHEVCDecoderConfRecord(record []byte) (self CodecData, err error) {
+	self.Record = record
+	if _, err = (&self.RecordInfo).Unmarshal(record); err != nil {
+		return
+	}
+	if len(self.RecordInfo.VPS) == 0 {
+		err = fmt.Errorf("h265parser: no VPS found in HEVCDecoderConfRecord")
+		return
+	}
+	if len(self.RecordInfo.SPS) == 0 {
+		err = fmt.Errorf("h265parser: no SPS found in HEVCDecoderConfRecord")
+		return
+	}
+	if len(self.RecordInfo.PPS) == 0 {
+		err = fmt.Errorf("h265parser: no PPS found in HEVCDecoderConfRecord")
+		return
+	}
+	if self.SPSInfo, err = ParseSPS(self.RecordInfo.SPS[0]); err != nil {
+		err = fmt.Errorf("h265parser: parse SPS failed(%s)", err)
+		return
+	}
+	return
+}
+
+func NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps []byte) (self CodecData, err error) {
+	if self.SPSInfo, err = ParseSPS(sps); err != nil {
+		return
+	}
+	info := self.SPSInfo
+
+	recordinfo := HEVCDecoderConfRecord{}
+	recordinfo.GeneralProfileSpace = uint8(info.ProfileSpace)
+	recordinfo.GeneralTierFlag = uint8(info.TierFlag)
+	recordinfo.GeneralProfileIdc = uint8(info.ProfileIdc)
+	recordinfo.GeneralProfileCompatibilityFlags = info.ProfileCompatibilityFlags
+	recordinfo.GeneralConstraintIndicatorFlags = info.ConstraintIndicatorFlags
+	recordinfo.GeneralLevelIdc = uint8(info.LevelIdc)
+	recordinfo.ChromaFormat = uint8(info.ChromaFormatIdc)
+	recordinfo.BitDepthLumaMinus8 = uint8(info.BitDepthLumaMinus8)
+	recordinfo.BitDepthChromaMinus8 = uint8(info.BitDepthChromaMinus8)
+	recordinfo.NumTemporalLayers = uint8(info.MaxSubLayersMinus1 + 1)
+	recordinfo.TemporalIdNested = uint8(info.TemporalIdNesting)
+	recordinfo.LengthSizeMinusOne = 3
+	recordinfo.VPS = [][]byte{vps}
+	recordinfo.SPS = [][]byte{sps}
+	recordinfo.PPS = [][]byte{pps}
+
+	buf := make([]byte, recordinfo.Len())
+	recordinfo.Marshal(buf)
+
+	self.RecordInfo = recordinfo
+	self.Record = buf
+	return
+}
+
+/*
+	aligned(8) class HEVCDecoderConfigurationRecord {
+		unsigned int(8) configurationVersion = 1;
+		unsigned int(2) general_profile_space;
+		unsigned int(1) general_tier_flag;
+		unsigned int(5) general_profile_idc;
+		unsigned int(32) general_profile_compatibility_flags;
+		unsigned int(48) general_constraint_indicator_flags;
+		unsigned int(8) general_level_idc;
+		bit(4) reserved = '1111'b;
+		unsigned int(12) min_spatial_segmentation_idc;
+		bit(6) reserved = '111111'b;
+		unsigned int(2) parallelismType;
+		bit(6) reserved = '111111'b;
+		unsigned int(2) chromaFormat;
+		bit(5) reserved = '11111'b;
+		unsigned int(3) bitDepthLumaMinus8;
+		bit(5) reserved = '11111'b;
+		unsigned int(3) bitDepthChromaMinus8;
+		bit(16) avgFrameRate;
+		bit(2) constantFrameRate;
+		bit(3) numTemporalLayers;
+		bit(1) temporalIdNested;
+		unsigned int(2) lengthSizeMinusOne;
+		unsigned int(8) numOfArrays;
+		for (j=0; j < numOfArrays; j++) {
+			bit(1) array_completeness;
+			unsigned int(1) reserved = 0;
+			unsigned int(6) NAL_unit_type;
+			unsigned int(16) numNalus;
+			for (i=0; i< numNalus; i++) {
+				unsigned int(16) nalUnitLength;
+				bit(8*nalUnitLength) nalUnit;
+			}
+		}
+	}
+*/
+type HEVCDecoderConfRecord struct {
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  uint8
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  uint64
+	GeneralLevelIdc                  uint8
+	MinSpatialSegmentationIdc        uint16
+	ParallelismType                  uint8
+	ChromaFormat                     uint8
+	BitDepthLumaMinus8               uint8
+	BitDepthChromaMinus8             uint8
+	AvgFrameRate                     uint16
+	ConstantFrameRate                uint8
+	NumTemporalLayers                uint8
+	TemporalIdNested                 uint8
+	LengthSizeMinusOne               uint8
+	VPS                              [][]byte
+	SPS                              [][]byte
+	PPS                              [][]byte
+}
+
+var ErrDecconfInvalid = fmt.Errorf("h265parser: HEVCDecoderConfRecord invalid")
+
+const hevcDecoderConfRecordHeaderLength = 23
+
+func (self *HEVCDecoderConfRecord) Unmarshal(b []byte) (n int, err error) {
+	if len(b) < hevcDecoderConfRecordHeaderLength {
+		err = ErrDecconfInvalid
+		return
+	}
+
+	self.GeneralProfileSpace = b[1] >> 6
+	self.GeneralTierFlag = (b[1] >> 5) & 0x1
+	self.GeneralProfileIdc = b[1] & 0x1f
+	self.GeneralProfileCompatibilityFlags = pio.U32BE(b[2:])
+	self.GeneralConstraintIndicatorFlags = pio.U48BE(b[6:])
+	self.GeneralLevelIdc = b[12]
+	self.MinSpatialSegmentationIdc = pio.U16BE(b[13:]) & 0xfff
+	self.ParallelismType = b[15] & 0x3
+	self.ChromaFormat = b[16] & 0x3
+	self.BitDepthLumaMinus8 = b[17] & 0x7
+	self.BitDepthChromaMinus8 = b[18] & 0x7
+	self.AvgFrameRate = pio.U16BE(b[19:])
+	self.ConstantFrameRate = b[21] >> 6
+	self.NumTemporalLayers = (b[21] >> 3) & 0x7
+	self.TemporalIdNested = (b[21] >> 2) & 0x1
+	self.LengthSizeMinusOne = b[21] & 0x3
+	arraycount := int(b[22])
+	n += hevcDecoderConfRecordHeaderLength
+
+	for i := 0; i < arraycount; i++ {
+		if len(b) < n+3 {
+			err = ErrDecconfInvalid
+			return
+		}
+		typ := b[n] & 0x3f
+		nalucount := int(pio.U16BE(b[n+1:]))
+		n += 3
+
+		for j := 0; j < nalucount; j++ {
+			if len(b) < n+2 {
+				err = ErrDecconfInvalid
+				return
+			}
+			nalulen := int(pio.U16BE(b[n:]))
+			n += 2
+
+			if len(b) < n+nalulen {
+				err = ErrDecconfInvalid
+				return
+			}
+			nalu := b[n : n+nalulen]
+			switch typ {
+			case NALU_VPS:
+				self.VPS = append(self.VPS, nalu)
+			case NALU_SPS:
+				self.SPS = append(self.SPS, nalu)
+			case NALU_PPS:
+				self.PPS = append(self.PPS, nalu)
+			}
+			n += nalulen
+		}
+	}
+
+	return
+}
+
+func (self HEVCDecoderConfRecord) arrays() (arrays [][][]byte, types []uint8) {
+	for i, nalus := range [][][]byte{self.VPS, self.SPS, self.PPS} {
+		if len(nalus) > 0 {
+			arrays = append(arrays, nalus)
+			types = append(types, uint8(NALU_VPS+i))
+		}
+	}
+	return
+}
+
+func (self HEVCDecoderConfRecord) Len() (n int) {
+	n = hevcDecoderConfRecordHeaderLength
+	arrays, _ := self.arrays()
+	for _, nalus := range arrays {
+		n += 3
+		for _, nalu := range nalus {
+			n += 2 + len(nalu)
+		}
+	}
+	return
+}
+
+func (self HEVCDecoderConfRecord) Marshal(b []byte) (n int) {
+	b[0] = 1
+	b[1] = self.GeneralProfileSpace<<6 | (self.GeneralTierFlag&0x1)<<5 | self.GeneralProfileIdc&0x1f
+	pio.PutU32BE(b[2:], self.GeneralProfileCompatibilityFlags)
+	pio.PutU48BE(b[6:], self.GeneralConstraintIndicatorFlags)
+	b[12] = self.GeneralLevelIdc
+	pio.PutU16BE(b[13:], self.MinSpatialSegmentationIdc|0xf000)
+	b[15] = self.ParallelismType | 0xfc
+	b[16] = self.ChromaFormat | 0xfc
+	b[17] = self.BitDepthLumaMinus8 | 0xf8
+	b[18] = self.BitDepthChromaMinus8 | 0xf8
+	pio.PutU16BE(b[19:], self.AvgFrameRate)
+	b[21] = self.ConstantFrameRate<<6 | (self.NumTemporalLayers&0x7)<<3 | (self.TemporalIdNested&0x1)<<2 | self.LengthSizeMinusOne&0x3
+	arrays, types := self.arrays()
+	b[22] = uint8(len(arrays))
+	n += hevcDecoderConfRecordHeaderLength
+
+	for i, nalus := range arrays {
+		b[n] = 0x80 | types[i] // array_completeness
+		pio.PutU16BE(b[n+1:], uint16(len(nalus)))
+		n += 3
+		for _, nalu := range nalus {
+			pio.PutU16BE(b[n:], uint16(len(nalu)))
+			n += 2
+			copy(b[n:], nalu)
+			n += len(nalu)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,44 @@
+package h265parser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	vps, _ := hex.DecodeString("40010c01ffff016000000300900000030000030078959809")
+	sps, _ := hex.DecodeString("420101016000000300900000030000030078a003c08010e59659a4932bc05a70808000001f480000753004")
+	pps, _ := hex.DecodeString("4401c172b46240")
+
+	codec, err := NewCodecDataFromVPSAndSPSAndPPS(vps, sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Width() != 1920 || codec.Height() != 1080 {
+		t.Fatalf("size=%dx%d", codec.Width(), codec.Height())
+	}
+
+	codec2, err := NewCodecDataFromHEVCDecoderConfRecord(codec.HEVCDecoderConfRecordBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(codec2.VPS(), vps) || !bytes.Equal(codec2.SPS(), sps) || !bytes.Equal(codec2.PPS(), pps) {
+		t.Fatal("parameter sets mismatch")
+	}
+	if codec2.RecordInfo.GeneralLevelIdc != 120 {
+		t.Fatalf("level=%d", codec2.RecordInfo.GeneralLevelIdc)
+	}
+
+	annexbFrame, _ := hex.DecodeString("0000000140010c01000000014201010100000126010203")
+	nalus, typ := SplitNALUs(annexbFrame)
+	if typ != NALU_ANNEXB || len(nalus) != 3 {
+		t.Fatalf("typ=%d nalus=%d", typ, len(nalus))
+	}
+	if NALUType(nalus[0]) != NALU_VPS || NALUType(nalus[1]) != NALU_SPS || !IsKeyFrameNALU(nalus[2]) {
+		t.Fatal("nalu type mismatch")
+	}
+	if NALUType(nil) != NALU_INVALID || IsDataNALU(nil) || IsKeyFrameNALU(nil) {
+		t.Fatal("empty nalu")
+	}
+}
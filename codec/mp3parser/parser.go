@@ -0,0 +1,190 @@
+package mp3parser
+
+import (
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"time"
+)
+
+const (
+	MPEG1  = 1
+	MPEG2  = 2
+	MPEG25 = 3
+)
+
+const (
+	CHANNEL_STEREO       = 0
+	CHANNEL_JOINT_STEREO = 1
+	CHANNEL_DUAL         = 2
+	CHANNEL_MONO         = 3
+)
+
+const FrameHeaderLength = 4
+
+/*
+MPEG audio frame header (http://www.mp3-tech.org/programmer/frame_header.html)
+
+	AAAAAAAA AAABBCCD EEEEFFGH IIJJKLMM
+
+	A sync(11) all bits set
+	B version(2) 00=MPEG2.5 01=reserved 10=MPEG2 11=MPEG1
+	C layer(2) 01=Layer3 10=Layer2 11=Layer1
+	D protection(1)
+	E bitrate index(4)
+	F sample rate index(2)
+	G padding(1)
+	H private(1)
+	I channel mode(2)
+	J mode extension(2)
+	K copyright(1)
+	L original(1)
+	M emphasis(2)
+*/
+type FrameHeader struct {
+	Version     int
+	Layer       int
+	Bitrate     int // bits per second
+	SampleRate  int
+	Padding     bool
+	ChannelMode int
+}
+
+// kbps, index 0 is free format which is not supported
+var bitrateTable = [2][3][]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var sampleRateTable = [3][]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+var ErrFrameHeaderInvalid = fmt.Errorf("mp3parser: frame header invalid")
+
+func ParseFrameHeader(h []byte) (hdr FrameHeader, framelen int, samples int, err error) {
+	if len(h) < FrameHeaderLength || h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		err = ErrFrameHeaderInvalid
+		return
+	}
+
+	switch (h[1] >> 3) & 0x3 {
+	case 0:
+		hdr.Version = MPEG25
+	case 2:
+		hdr.Version = MPEG2
+	case 3:
+		hdr.Version = MPEG1
+	default:
+		err = ErrFrameHeaderInvalid
+		return
+	}
+
+	layer := (h[1] >> 1) & 0x3
+	if layer == 0 {
+		err = ErrFrameHeaderInvalid
+		return
+	}
+	hdr.Layer = 4 - int(layer)
+
+	bitrateIndex := h[2] >> 4
+	sampleRateIndex := (h[2] >> 2) & 0x3
+	if bitrateIndex == 0 || bitrateIndex == 0xf || sampleRateIndex == 3 {
+		err = ErrFrameHeaderInvalid
+		return
+	}
+
+	v := 0
+	if hdr.Version != MPEG1 {
+		v = 1
+	}
+	hdr.Bitrate = bitrateTable[v][hdr.Layer-1][bitrateIndex] * 1000
+	hdr.SampleRate = sampleRateTable[hdr.Version-1][sampleRateIndex]
+	hdr.Padding = h[2]&0x2 != 0
+	hdr.ChannelMode = int(h[3] >> 6)
+
+	samples = hdr.SamplesPerFrame()
+	padding := 0
+	if hdr.Padding {
+		padding = 1
+	}
+	if hdr.Layer == 1 {
+		framelen = (12*hdr.Bitrate/hdr.SampleRate + padding) * 4
+	} else {
+		framelen = samples/8*hdr.Bitrate/hdr.SampleRate + padding
+	}
+	return
+}
+
+func (self FrameHeader) SamplesPerFrame() int {
+	switch {
+	case self.Layer == 1:
+		return 384
+	case self.Layer == 3 && self.Version != MPEG1:
+		return 576
+	}
+	return 1152
+}
+
+func (self FrameHeader) ChannelLayout() av.ChannelLayout {
+	if self.ChannelMode == CHANNEL_MONO {
+		return av.CH_MONO
+	}
+	return av.CH_STEREO
+}
+
+type CodecData struct {
+	Header FrameHeader
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.MP3
+}
+
+func (self CodecData) SampleRate() int {
+	return self.Header.SampleRate
+}
+
+func (self CodecData) ChannelLayout() av.ChannelLayout {
+	return self.Header.ChannelLayout()
+}
+
+func (self CodecData) SampleFormat() av.SampleFormat {
+	return av.FLTP
+}
+
+func (self CodecData) PacketDuration(data []byte) (dur time.Duration, err error) {
+	hdr := self.Header
+	if _hdr, _, _, _err := ParseFrameHeader(data); _err == nil {
+		hdr = _hdr
+	}
+	dur = time.Duration(hdr.SamplesPerFrame()) * time.Second / time.Duration(hdr.SampleRate)
+	return
+}
+
+func NewCodecDataFromFrameHeader(hdr FrameHeader) (self CodecData, err error) {
+	if hdr.SampleRate == 0 {
+		err = fmt.Errorf("mp3parser: sample rate invalid")
+		return
+	}
+	self.Header = hdr
+	return
+}
+
+// Parse codec data from the first frame of packet.
+func NewCodecDataFromFrame(frame []byte) (self CodecData, err error) {
+	var hdr FrameHeader
+	if hdr, _, _, err = ParseFrameHeader(frame); err != nil {
+		return
+	}
+	return NewCodecDataFromFrameHeader(hdr)
+}
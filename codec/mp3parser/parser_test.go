@@ -0,0 +1,45 @@
+package mp3parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParser(t *testing.T) {
+	// MPEG1 Layer3 128kbps 44100Hz stereo
+	hdr, framelen, samples, err := ParseFrameHeader([]byte{0xff, 0xfb, 0x90, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Version != MPEG1 || hdr.Layer != 3 || hdr.Bitrate != 128000 || hdr.SampleRate != 44100 {
+		t.Fatalf("hdr=%+v", hdr)
+	}
+	if framelen != 417 || samples != 1152 {
+		t.Fatalf("framelen=%d samples=%d", framelen, samples)
+	}
+
+	// MPEG2 Layer3 64kbps 22050Hz mono padded
+	hdr, framelen, samples, err = ParseFrameHeader([]byte{0xff, 0xf3, 0x82, 0xc0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Version != MPEG2 || hdr.SampleRate != 22050 || hdr.ChannelLayout().Count() != 1 {
+		t.Fatalf("hdr=%+v", hdr)
+	}
+	if framelen != 209 || samples != 576 {
+		t.Fatalf("framelen=%d samples=%d", framelen, samples)
+	}
+
+	codec, err := NewCodecDataFromFrameHeader(hdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dur, _ := codec.PacketDuration(nil); dur != time.Duration(576)*time.Second/22050 {
+		t.Fatalf("dur=%v", dur)
+	}
+
+	// adts header must not be taken as mp3
+	if _, _, _, err = ParseFrameHeader([]byte{0xff, 0xf1, 0x50, 0x80}); err == nil {
+		t.Fatal("adts header parsed as mp3")
+	}
+}
@@ -0,0 +1,291 @@
+package opusparser
+
+import (
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/utils/bits/pio"
+	"time"
+)
+
+// Opus always decodes at 48kHz, InputSampleRate is informational only.
+const SampleRate = 48000
+
+/*
+OpusHead (https://tools.ietf.org/html/rfc7845#section-5.1)
+
+	 0                   1                   2                   3
+	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|      'O'      |      'p'      |      'u'      |      's'      |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|      'H'      |      'e'      |      'a'      |      'd'      |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|  Version = 1  | Channel Count |           Pre-skip            |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|                     Input Sample Rate (Hz)                    |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	|   Output Gain (Q7.8 in dB)    | Mapping Family|               |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+               :
+	|                                                               |
+	:               Optional Channel Mapping Table...               :
+	|                                                               |
+	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+All multi-byte fields are little endian. The dOps box in mp4
+(https://opus-codec.org/docs/opus_in_isobmff.html) carries the same fields
+without the magic, with Version = 0 and big endian byte order.
+*/
+type OpusHeader struct {
+	ChannelCount    int
+	PreSkip         uint16
+	InputSampleRate uint32
+	OutputGain      int16
+	MappingFamily   uint8
+	StreamCount     uint8
+	CoupledCount    uint8
+	ChannelMapping  []uint8
+}
+
+var ErrOpusHeadInvalid = fmt.Errorf("opusparser: OpusHead invalid")
+var ErrDOpsInvalid = fmt.Errorf("opusparser: dOps invalid")
+
+const opusHeadMagic = "OpusHead"
+
+func (self OpusHeader) mappingLen() int {
+	if self.MappingFamily == 0 {
+		return 0
+	}
+	return 2 + self.ChannelCount
+}
+
+func (self *OpusHeader) unmarshalMapping(b []byte) bool {
+	if self.MappingFamily == 0 {
+		return true
+	}
+	if len(b) < 2+self.ChannelCount {
+		return false
+	}
+	self.StreamCount = b[0]
+	self.CoupledCount = b[1]
+	self.ChannelMapping = b[2 : 2+self.ChannelCount]
+	return true
+}
+
+func (self OpusHeader) marshalMapping(b []byte) (n int) {
+	if self.MappingFamily == 0 {
+		return
+	}
+	b[0] = self.StreamCount
+	b[1] = self.CoupledCount
+	copy(b[2:2+self.ChannelCount], self.ChannelMapping)
+	return 2 + self.ChannelCount
+}
+
+func ParseOpusHead(b []byte) (self OpusHeader, err error) {
+	if len(b) < 19 || string(b[0:8]) != opusHeadMagic {
+		err = ErrOpusHeadInvalid
+		return
+	}
+	self.ChannelCount = int(b[9])
+	self.PreSkip = uint16(b[10]) | uint16(b[11])<<8
+	self.InputSampleRate = pio.U32LE(b[12:])
+	self.OutputGain = int16(uint16(b[16]) | uint16(b[17])<<8)
+	self.MappingFamily = b[18]
+	if !(&self).unmarshalMapping(b[19:]) {
+		err = ErrOpusHeadInvalid
+		return
+	}
+	return
+}
+
+func (self OpusHeader) OpusHeadLen() int {
+	return 19 + self.mappingLen()
+}
+
+func (self OpusHeader) MarshalOpusHead(b []byte) (n int) {
+	copy(b[0:8], opusHeadMagic)
+	b[8] = 1
+	b[9] = uint8(self.ChannelCount)
+	b[10] = uint8(self.PreSkip)
+	b[11] = uint8(self.PreSkip >> 8)
+	pio.PutU32LE(b[12:], self.InputSampleRate)
+	b[16] = uint8(self.OutputGain)
+	b[17] = uint8(uint16(self.OutputGain) >> 8)
+	b[18] = self.MappingFamily
+	n = 19
+	n += self.marshalMapping(b[n:])
+	return
+}
+
+func ParseDOps(b []byte) (self OpusHeader, err error) {
+	if len(b) < 11 {
+		err = ErrDOpsInvalid
+		return
+	}
+	self.ChannelCount = int(b[1])
+	self.PreSkip = pio.U16BE(b[2:])
+	self.InputSampleRate = pio.U32BE(b[4:])
+	self.OutputGain = pio.I16BE(b[8:])
+	self.MappingFamily = b[10]
+	if !(&self).unmarshalMapping(b[11:]) {
+		err = ErrDOpsInvalid
+		return
+	}
+	return
+}
+
+func (self OpusHeader) DOpsLen() int {
+	return 11 + self.mappingLen()
+}
+
+func (self OpusHeader) MarshalDOps(b []byte) (n int) {
+	b[0] = 0
+	b[1] = uint8(self.ChannelCount)
+	pio.PutU16BE(b[2:], self.PreSkip)
+	pio.PutU32BE(b[4:], self.InputSampleRate)
+	pio.PutI16BE(b[8:], self.OutputGain)
+	b[10] = self.MappingFamily
+	n = 11
+	n += self.marshalMapping(b[n:])
+	return
+}
+
+// frame size in 1/10 ms of each TOC config, see rfc6716 section 3.1
+var frameDurationTable = []int{
+	100, 200, 400, 600, // SILK NB
+	100, 200, 400, 600, // SILK MB
+	100, 200, 400, 600, // SILK WB
+	100, 200, // Hybrid SWB
+	100, 200, // Hybrid FB
+	25, 50, 100, 200, // CELT NB
+	25, 50, 100, 200, // CELT WB
+	25, 50, 100, 200, // CELT SWB
+	25, 50, 100, 200, // CELT FB
+}
+
+/*
+TOC byte of opus packet (https://tools.ietf.org/html/rfc6716#section-3.1)
+
+	 0
+	 0 1 2 3 4 5 6 7
+	+-+-+-+-+-+-+-+-+
+	| config  |s| c |
+	+-+-+-+-+-+-+-+-+
+*/
+func ParseTOC(packet []byte) (config int, stereo bool, frames int, err error) {
+	if len(packet) < 1 {
+		err = fmt.Errorf("opusparser: packet too short")
+		return
+	}
+	toc := packet[0]
+	config = int(toc >> 3)
+	stereo = toc&0x4 != 0
+	switch toc & 0x3 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			err = fmt.Errorf("opusparser: code 3 packet too short")
+			return
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+	return
+}
+
+func PacketDuration(packet []byte) (dur time.Duration, err error) {
+	var config, frames int
+	if config, _, frames, err = ParseTOC(packet); err != nil {
+		return
+	}
+	dur = time.Duration(frames*frameDurationTable[config]) * time.Millisecond / 10
+	return
+}
+
+var chanLayoutTable = []av.ChannelLayout{
+	0,
+	av.CH_MONO,
+	av.CH_STEREO,
+}
+
+type CodecData struct {
+	Header OpusHeader
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.OPUS
+}
+
+func (self CodecData) SampleRate() int {
+	return SampleRate
+}
+
+func (self CodecData) SampleFormat() av.SampleFormat {
+	return av.FLT
+}
+
+func (self CodecData) ChannelLayout() av.ChannelLayout {
+	if self.Header.ChannelCount < len(chanLayoutTable) {
+		return chanLayoutTable[self.Header.ChannelCount]
+	}
+	// rfc7845 section 5.1.1.2 vorbis channel order, only counts matter here
+	layout := av.CH_STEREO
+	for i := 2; i < self.Header.ChannelCount && i < 9; i++ {
+		layout |= av.ChannelLayout(1) << uint(i+1)
+	}
+	return layout
+}
+
+func (self CodecData) PacketDuration(data []byte) (time.Duration, error) {
+	return PacketDuration(data)
+}
+
+func (self CodecData) OpusHeadBytes() []byte {
+	b := make([]byte, self.Header.OpusHeadLen())
+	self.Header.MarshalOpusHead(b)
+	return b
+}
+
+func (self CodecData) DOpsBytes() []byte {
+	b := make([]byte, self.Header.DOpsLen())
+	self.Header.MarshalDOps(b)
+	return b
+}
+
+func NewCodecDataFromOpusHead(b []byte) (self CodecData, err error) {
+	if self.Header, err = ParseOpusHead(b); err != nil {
+		return
+	}
+	return
+}
+
+func NewCodecDataFromDOps(b []byte) (self CodecData, err error) {
+	if self.Header, err = ParseDOps(b); err != nil {
+		return
+	}
+	return
+}
+
+// For sources like rtp or mpegts that only signal the channel count.
+func NewCodecDataFromChannelCount(channels int) (self CodecData, err error) {
+	if channels < 1 || channels > 255 {
+		err = fmt.Errorf("opusparser: channel count=%d invalid", channels)
+		return
+	}
+	self.Header = OpusHeader{
+		ChannelCount:    channels,
+		PreSkip:         3840,
+		InputSampleRate: SampleRate,
+	}
+	if channels > 2 {
+		// vorbis channel mapping, one stream per channel
+		self.Header.MappingFamily = 1
+		self.Header.StreamCount = uint8(channels)
+		for i := 0; i < channels; i++ {
+			self.Header.ChannelMapping = append(self.Header.ChannelMapping, uint8(i))
+		}
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package opusparser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestParser(t *testing.T) {
+	head, _ := hex.DecodeString("4f707573486561640102380180bb00000000")
+	head = append(head, 0)
+
+	codec, err := NewCodecDataFromOpusHead(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Header.ChannelCount != 2 || codec.Header.PreSkip != 312 || codec.Header.InputSampleRate != 48000 {
+		t.Fatalf("header=%+v", codec.Header)
+	}
+	if !bytes.Equal(codec.OpusHeadBytes(), head) {
+		t.Fatal("OpusHead mismatch")
+	}
+
+	codec2, err := NewCodecDataFromDOps(codec.DOpsBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(codec2.OpusHeadBytes(), head) {
+		t.Fatal("dOps round trip mismatch")
+	}
+
+	for _, c := range []struct {
+		packet []byte
+		dur    time.Duration
+	}{
+		{[]byte{0xfc}, 20 * time.Millisecond},
+		{[]byte{0x78}, 20 * time.Millisecond},
+		{[]byte{0x01}, 20 * time.Millisecond},
+		{[]byte{0x83, 0x03}, 7500 * time.Microsecond},
+	} {
+		dur, err := codec.PacketDuration(c.packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dur != c.dur {
+			t.Fatalf("toc=%x dur=%v", c.packet[0], dur)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package vp8parser
+
+import (
+	"fmt"
+	"github.com/nareix/joy4/av"
+)
+
+/*
+VP8 frame tag (https://tools.ietf.org/html/rfc6386#section-9.1)
+
+	key_frame(1) 0 means key frame
+	version(3)
+	show_frame(1)
+	first_part_size(19)
+
+key frame only:
+
+	start_code(24)=0x9d012a
+	horizontal_scale(2) width(14)
+	vertical_scale(2) height(14)
+*/
+type KeyFrameInfo struct {
+	Version         uint
+	Width           uint
+	Height          uint
+	HorizontalScale uint
+	VerticalScale   uint
+}
+
+const KeyFrameHeaderLength = 10
+
+func IsKeyFrame(frame []byte) bool {
+	return len(frame) > 0 && frame[0]&0x1 == 0
+}
+
+func ParseKeyFrameHeader(frame []byte) (self KeyFrameInfo, err error) {
+	if len(frame) < KeyFrameHeaderLength {
+		err = fmt.Errorf("vp8parser: frame too short")
+		return
+	}
+	if !IsKeyFrame(frame) {
+		err = fmt.Errorf("vp8parser: not key frame")
+		return
+	}
+	if frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+		err = fmt.Errorf("vp8parser: key frame start code invalid")
+		return
+	}
+	self.Version = uint(frame[0]>>1) & 0x7
+	w := uint(frame[6]) | uint(frame[7])<<8
+	h := uint(frame[8]) | uint(frame[9])<<8
+	self.Width = w & 0x3fff
+	self.HorizontalScale = w >> 14
+	self.Height = h & 0x3fff
+	self.VerticalScale = h >> 14
+	return
+}
+
+type CodecData struct {
+	Info KeyFrameInfo
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.VP8
+}
+
+func (self CodecData) Width() int {
+	return int(self.Info.Width)
+}
+
+func (self CodecData) Height() int {
+	return int(self.Info.Height)
+}
+
+func NewCodecDataFromKeyFrame(frame []byte) (self CodecData, err error) {
+	if self.Info, err = ParseKeyFrameHeader(frame); err != nil {
+		return
+	}
+	return
+}
+
+func NewCodecDataFromKeyFrameInfo(info KeyFrameInfo) (self CodecData, err error) {
+	if info.Width == 0 || info.Height == 0 {
+		err = fmt.Errorf("vp8parser: size %dx%d invalid", info.Width, info.Height)
+		return
+	}
+	self.Info = info
+	return
+}
@@ -0,0 +1,19 @@
+package vp8parser
+
+import (
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	keyframe := []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01}
+	codec, err := NewCodecDataFromKeyFrame(keyframe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Width() != 640 || codec.Height() != 480 {
+		t.Fatalf("size=%dx%d", codec.Width(), codec.Height())
+	}
+	if IsKeyFrame([]byte{0x31, 0x02, 0x00}) {
+		t.Fatal("inter frame parsed as key frame")
+	}
+}
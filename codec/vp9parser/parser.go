@@ -0,0 +1,195 @@
+package vp9parser
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/utils/bits"
+)
+
+const (
+	KEY_FRAME     = 0
+	NON_KEY_FRAME = 1
+)
+
+const CS_RGB = 7
+
+/*
+VP9 uncompressed header, see VP9 bitstream spec 6.2
+
+	frame_marker(2)=2
+	profile_low_bit(1)
+	profile_high_bit(1)
+	if profile == 3 { reserved_zero(1) }
+	show_existing_frame(1)
+	if show_existing_frame { frame_to_show_map_idx(3) }
+	frame_type(1)
+	show_frame(1)
+	error_resilient_mode(1)
+	if frame_type == KEY_FRAME {
+		frame_sync_code(24)=0x498342
+		color_config()
+		frame_width_minus_1(16)
+		frame_height_minus_1(16)
+	}
+*/
+type KeyFrameInfo struct {
+	Profile      uint
+	BitDepth     uint
+	ColorSpace   uint
+	ColorRange   uint
+	SubsamplingX uint
+	SubsamplingY uint
+	Width        uint
+	Height       uint
+}
+
+func parseFrameType(r *bits.GolombBitReader) (profile uint, frameType uint, err error) {
+	var marker, low, high uint
+	if marker, err = r.ReadBits(2); err != nil {
+		return
+	}
+	if marker != 2 {
+		err = fmt.Errorf("vp9parser: frame marker invalid")
+		return
+	}
+	if low, err = r.ReadBit(); err != nil {
+		return
+	}
+	if high, err = r.ReadBit(); err != nil {
+		return
+	}
+	profile = high<<1 | low
+	if profile == 3 {
+		if _, err = r.ReadBit(); err != nil {
+			return
+		}
+	}
+	var showExistingFrame uint
+	if showExistingFrame, err = r.ReadBit(); err != nil {
+		return
+	}
+	if showExistingFrame != 0 {
+		frameType = NON_KEY_FRAME
+		return
+	}
+	if frameType, err = r.ReadBit(); err != nil {
+		return
+	}
+	return
+}
+
+func IsKeyFrame(frame []byte) bool {
+	r := &bits.GolombBitReader{R: bytes.NewReader(frame)}
+	_, frameType, err := parseFrameType(r)
+	return err == nil && frameType == KEY_FRAME
+}
+
+func ParseKeyFrameHeader(frame []byte) (self KeyFrameInfo, err error) {
+	r := &bits.GolombBitReader{R: bytes.NewReader(frame)}
+
+	var frameType uint
+	if self.Profile, frameType, err = parseFrameType(r); err != nil {
+		return
+	}
+	if frameType != KEY_FRAME {
+		err = fmt.Errorf("vp9parser: not key frame")
+		return
+	}
+	// show_frame, error_resilient_mode
+	if _, err = r.ReadBits(2); err != nil {
+		return
+	}
+	var syncCode uint
+	if syncCode, err = r.ReadBits(24); err != nil {
+		return
+	}
+	if syncCode != 0x498342 {
+		err = fmt.Errorf("vp9parser: frame sync code invalid")
+		return
+	}
+
+	self.BitDepth = 8
+	if self.Profile >= 2 {
+		var tenOrTwelveBit uint
+		if tenOrTwelveBit, err = r.ReadBit(); err != nil {
+			return
+		}
+		if tenOrTwelveBit != 0 {
+			self.BitDepth = 12
+		} else {
+			self.BitDepth = 10
+		}
+	}
+	if self.ColorSpace, err = r.ReadBits(3); err != nil {
+		return
+	}
+	if self.ColorSpace != CS_RGB {
+		if self.ColorRange, err = r.ReadBit(); err != nil {
+			return
+		}
+		if self.Profile == 1 || self.Profile == 3 {
+			if self.SubsamplingX, err = r.ReadBit(); err != nil {
+				return
+			}
+			if self.SubsamplingY, err = r.ReadBit(); err != nil {
+				return
+			}
+			if _, err = r.ReadBit(); err != nil {
+				return
+			}
+		} else {
+			self.SubsamplingX = 1
+			self.SubsamplingY = 1
+		}
+	} else {
+		self.ColorRange = 1
+		if self.Profile == 1 || self.Profile == 3 {
+			if _, err = r.ReadBit(); err != nil {
+				return
+			}
+		}
+	}
+
+	if self.Width, err = r.ReadBits(16); err != nil {
+		return
+	}
+	self.Width++
+	if self.Height, err = r.ReadBits(16); err != nil {
+		return
+	}
+	self.Height++
+	return
+}
+
+type CodecData struct {
+	Info KeyFrameInfo
+}
+
+func (self CodecData) Type() av.CodecType {
+	return av.VP9
+}
+
+func (self CodecData) Width() int {
+	return int(self.Info.Width)
+}
+
+func (self CodecData) Height() int {
+	return int(self.Info.Height)
+}
+
+func NewCodecDataFromKeyFrame(frame []byte) (self CodecData, err error) {
+	if self.Info, err = ParseKeyFrameHeader(frame); err != nil {
+		return
+	}
+	return
+}
+
+func NewCodecDataFromKeyFrameInfo(info KeyFrameInfo) (self CodecData, err error) {
+	if info.Width == 0 || info.Height == 0 {
+		err = fmt.Errorf("vp9parser: size %dx%d invalid", info.Width, info.Height)
+		return
+	}
+	self.Info = info
+	return
+}
@@ -0,0 +1,24 @@
+package vp9parser
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	keyframe, _ := hex.DecodeString("824983422027f01df0")
+	codec, err := NewCodecDataFromKeyFrame(keyframe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec.Width() != 640 || codec.Height() != 480 {
+		t.Fatalf("size=%dx%d", codec.Width(), codec.Height())
+	}
+	if codec.Info.Profile != 0 || codec.Info.BitDepth != 8 || codec.Info.SubsamplingX != 1 {
+		t.Fatalf("info=%+v", codec.Info)
+	}
+	// frame_type=NON_KEY_FRAME
+	if IsKeyFrame([]byte{0x86, 0x00}) {
+		t.Fatal("inter frame parsed as key frame")
+	}
+}
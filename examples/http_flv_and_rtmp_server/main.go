@@ -1,7 +1,7 @@
 package main
 
 import (
-	"sync"
+	"fmt"
 	"io"
 	"net/http"
 	"github.com/nareix/joy4/format"
@@ -37,60 +37,38 @@ func main() {
 	 */
 	server := &rtmp.Server{}
 
-	l := &sync.RWMutex{}
-	type Channel struct {
-		que *pubsub.Queue
-	}
-	channels := map[string]*Channel{}
+	// streams keyed by url path, duplicate publisher is rejected
+	hub := pubsub.NewHub()
 
 	// 处理播放逻辑
 	server.HandlePlay = func(conn *rtmp.Conn) {
-		l.RLock()
-		ch := channels[conn.URL.Path]
-		l.RUnlock()
-
-		if ch != nil {
-			cursor := ch.que.Latest()
-			// dst:conn, src:cursor
-			// 将整个queue的内容拷贝到conn中
-			avutil.CopyFile(conn, cursor)
+		sub, err := hub.Subscribe(conn.URL.Path, 0)
+		if err != nil {
+			return
 		}
+		defer sub.Close()
+		sub.SetByteCounter(conn)
+		// dst:conn, src:sub
+		// 将整个queue的内容拷贝到conn中
+		avutil.CopyFile(conn, sub)
 	}
 
 	// 处理推流逻辑
 	server.HandlePublish = func(conn *rtmp.Conn) {
-		streams, _ := conn.Streams()
-
-		l.Lock()
-		ch := channels[conn.URL.Path]
-		if ch == nil {
-			ch = &Channel{}
-			ch.que = pubsub.NewQueue()
-			ch.que.WriteHeader(streams)
-			channels[conn.URL.Path] = ch
-		} else {
-			ch = nil
-		}
-		l.Unlock()
-		if ch == nil {
+		pub, err := hub.Publish(conn.URL.Path)
+		if err != nil {
 			return
 		}
-
-		// ch.que: dst av.PacketWriter; conn: src av.PacketReader
-		avutil.CopyPackets(ch.que, conn)
-
-		l.Lock()
-		delete(channels, conn.URL.Path)
-		l.Unlock()
-		ch.que.Close()
+		defer pub.Close()
+		pub.SetByteCounter(conn)
+		// pub: dst av.Muxer; conn: src av.Demuxer
+		avutil.CopyFile(pub, conn)
 	}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		l.RLock()
-		ch := channels[r.URL.Path]
-		l.RUnlock()
-
-		if ch != nil {
+		sub, err := hub.Subscribe(r.URL.Path, 0)
+		if err == nil {
+			defer sub.Close()
 			w.Header().Set("Content-Type", "video/x-flv")
 			w.Header().Set("Transfer-Encoding", "chunked")		
 			w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -99,14 +77,26 @@ func main() {
 			flusher.Flush()
 
 			muxer := flv.NewMuxerWriteFlusher(writeFlusher{httpflusher: flusher, Writer: w})
-			cursor := ch.que.Latest()
 
-			avutil.CopyFile(muxer, cursor)
+			avutil.CopyFile(muxer, sub)
 		} else {
 			http.NotFound(w, r)
 		}
 	})
 
+	// health of all channels
+	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		for name, stats := range hub.Stats() {
+			dropped, _ := stats.Dropped()
+			fmt.Fprintf(w, "%s bitrate=%d buffered=%v subscribers=%d dropped=%d lastwrite=%v\n",
+				name, stats.Bitrate(), stats.BufferedDuration, stats.Subscribers, dropped, stats.LastWrite)
+			for i, stream := range stats.Streams {
+				fmt.Fprintf(w, "  #%d %s bitrate=%d fps=%.1f keyint=%v time=%v\n",
+					i, stream.Type, stream.Bitrate, stream.FrameRate, stream.KeyFrameInterval, stream.LastTime)
+			}
+		}
+	})
+
 	go http.ListenAndServe(":8089", nil)
 
 	server.ListenAndServe()
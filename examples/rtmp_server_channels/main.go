@@ -8,7 +8,6 @@ import (
 	"github.com/nareix/joy4/av/pubsub"
 	"github.com/nareix/joy4/format"
 	"github.com/nareix/joy4/format/rtmp"
-	"sync"
 	"time"
 )
 
@@ -75,30 +74,29 @@ func (self *FrameDropper) ModifyPacket(pkt *av.Packet, streams []av.CodecData, v
 func main() {
 	server := &rtmp.Server{}
 
-	l := &sync.RWMutex{}
-	type Channel struct {
-		que *pubsub.Queue
-	}
-	channels := map[string]*Channel{}
+	hub := pubsub.NewHub()
 
 	server.HandlePlay = func(conn *rtmp.Conn) {
-		l.RLock()
-		ch := channels[conn.URL.Path]
-		l.RUnlock()
-
-		if ch != nil {
-			cursor := ch.que.Latest()
-			query := conn.URL.Query()
-
-			// 获取delaygop参数
-			if q := query.Get("delaygop"); q != "" {
-				n := 0
-				fmt.Sscanf(q, "%d", &n)
-				cursor = ch.que.DelayedGopCount(n)
-			} else if q := query.Get("delaytime"); q != "" {  // 获取delaytime参数
-				dur, _ := time.ParseDuration(q)
-				cursor = ch.que.DelayedTime(dur)
+		query := conn.URL.Query()
+		newcursor := func(que *pubsub.Queue) *pubsub.QueueCursor {
+			return que.Latest()
+		}
+		// 获取delaygop参数
+		if q := query.Get("delaygop"); q != "" {
+			n := 0
+			fmt.Sscanf(q, "%d", &n)
+			newcursor = func(que *pubsub.Queue) *pubsub.QueueCursor {
+				return que.DelayedGopCount(n)
+			}
+		} else if q := query.Get("delaytime"); q != "" {  // 获取delaytime参数
+			dur, _ := time.ParseDuration(q)
+			newcursor = func(que *pubsub.Queue) *pubsub.QueueCursor {
+				return que.DelayedTime(dur)
 			}
+		}
+
+		if sub, err := hub.SubscribeWith(conn.URL.Path, 0, newcursor); err == nil {
+			defer sub.Close()
 
 			filters := pktque.Filters{}
 
@@ -128,7 +126,7 @@ func main() {
 
 			demuxer := &pktque.FilterDemuxer{
 				Filter:  filters,
-				Demuxer: cursor,
+				Demuxer: sub,
 			}
 
 			avutil.CopyFile(conn, demuxer)
@@ -140,32 +138,19 @@ func main() {
 
 	// 推流的逻辑依旧没有变化
 	server.HandlePublish = func(conn *rtmp.Conn) {
-		l.Lock()
-		ch := channels[conn.URL.Path]
-		if ch == nil {
-			ch = &Channel{}
-			ch.que = pubsub.NewQueue()
-			query := conn.URL.Query()
-			if q := query.Get("cachegop"); q != "" {
-				var n int
-				fmt.Sscanf(q, "%d", &n)
-				ch.que.SetMaxGopCount(n)
-			}
-			channels[conn.URL.Path] = ch
-		} else {
-			ch = nil
-		}
-		l.Unlock()
-		if ch == nil {
+		pub, err := hub.Publish(conn.URL.Path)
+		if err != nil {
 			return
 		}
+		defer pub.Close()
+		query := conn.URL.Query()
+		if q := query.Get("cachegop"); q != "" {
+			var n int
+			fmt.Sscanf(q, "%d", &n)
+			pub.SetMaxGopCount(n)
+		}
 
-		avutil.CopyFile(ch.que, conn)
-
-		l.Lock()
-		delete(channels, conn.URL.Path)
-		l.Unlock()
-		ch.que.Close()
+		avutil.CopyFile(pub, conn)
 	}
 
 	server.ListenAndServe()
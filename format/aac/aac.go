@@ -104,6 +104,37 @@ func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 	return
 }
 
+// Continuous ADTS frames give more confidence than a single header.
+func probeScore(b []byte) (score int, err error) {
+	n := 0
+	for len(b) >= aacparser.ADTSHeaderLength {
+		var framelen int
+		if _, _, framelen, _, err = aacparser.ParseADTSHeader(b); err != nil {
+			break
+		}
+		n++
+		if framelen > len(b) {
+			b = b[len(b):]
+			break
+		}
+		b = b[framelen:]
+	}
+	switch {
+	case n >= 2:
+		score = avutil.ProbeScoreDefault
+		err = nil
+	case n == 1 && len(b) < aacparser.ADTSHeaderLength:
+		// next frame beyond probe bytes
+		score = avutil.ProbeScoreMin
+		err = nil
+	case n == 1:
+		err = fmt.Errorf("aac: adts frame not continuous")
+	default:
+		err = fmt.Errorf("aac: adts header not found")
+	}
+	return
+}
+
 func Handler(h *avutil.RegisterHandler) {
 	h.Ext = ".aac"
 
@@ -120,5 +151,7 @@ func Handler(h *avutil.RegisterHandler) {
 		return err == nil
 	}
 
+	h.ProbeScore = probeScore
+
 	h.CodecTypes = []av.CodecType{av.AAC}
 }
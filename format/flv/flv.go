@@ -2,6 +2,7 @@ package flv
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"github.com/nareix/joy4/utils/bits/pio"
 	"github.com/nareix/joy4/av"
@@ -10,8 +11,10 @@ import (
 	"github.com/nareix/joy4/codec/aacparser"
 	"github.com/nareix/joy4/codec/fake"
 	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/codec/mp3parser"
 	"github.com/nareix/joy4/format/flv/flvio"
 	"io"
+	"time"
 )
 
 var MaxProbePacketCount = 20
@@ -47,6 +50,9 @@ func NewMetadataByStreams(streams []av.CodecData) (metadata flvio.AMFMap, err er
 			case av.SPEEX:
 				metadata["audiocodecid"] = flvio.SOUND_SPEEX
 
+			case av.MP3:
+				metadata["audiocodecid"] = flvio.SOUND_MP3
+
 			default:
 				err = fmt.Errorf("flv: metadata: unsupported audio codecType=%v", stream.Type())
 				return
@@ -62,10 +68,21 @@ func NewMetadataByStreams(streams []av.CodecData) (metadata flvio.AMFMap, err er
 type Prober struct {
 	HasAudio, HasVideo             bool
 	GotAudio, GotVideo             bool
+	DataStream                     bool // demux script data tags as AMF0 stream, after audio and video
+	GotData                        bool
 	VideoStreamIdx, AudioStreamIdx int
+	DataStreamIdx                  int
 	PushedCount                    int
 	Streams                        []av.CodecData
 	CachedPkts                     []av.Packet
+
+	// encoder wallclock from last onFI and its tag time
+	wallclock     time.Time
+	wallclockTime time.Duration
+
+	// sequence header changed after probing, indexed by stream
+	// and attached to next packet of the stream
+	changedCodecData []av.CodecData
 }
 
 func (self *Prober) CacheTag(_tag flvio.Tag, timestamp int32) {
@@ -73,6 +90,112 @@ func (self *Prober) CacheTag(_tag flvio.Tag, timestamp int32) {
 	self.CachedPkts = append(self.CachedPkts, pkt)
 }
 
+// Name of script data tag, e.g: onMetaData, onCuePoint, onTextData.
+func scriptDataName(b []byte) (name string, n int) {
+	val, n, err := flvio.ParseAMF0Val(b)
+	if err != nil {
+		return
+	}
+	name, _ = val.(string)
+	return
+}
+
+// onMetaData written by flvtool/yamdi tells if cue points follow.
+func metadataHasCuePoints(b []byte) bool {
+	val, _, err := flvio.ParseAMF0Val(b)
+	if err != nil {
+		return false
+	}
+	metadata, _ := val.(flvio.AMFMap)
+	if has, _ := metadata["hasCuePoints"].(bool); has {
+		return true
+	}
+	_, ok := metadata["cuePoints"]
+	return ok
+}
+
+// onFI inserted by encoders like FMLE carries system date and time,
+// e.g: {sd: "18-10-2026", st: "12:30:15.040"}
+func parseOnFI(b []byte) (tm time.Time, ok bool) {
+	val, _, err := flvio.ParseAMF0Val(b)
+	if err != nil {
+		return
+	}
+	fi, _ := val.(flvio.AMFMap)
+	sd, _ := fi["sd"].(string)
+	st, _ := fi["st"].(string)
+	if tm, err = time.Parse("02-01-2006 15:04:05.000", sd+" "+st); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func (self *Prober) addDataStream() {
+	if self.DataStream && !self.GotData {
+		self.DataStreamIdx = len(self.Streams)
+		self.Streams = append(self.Streams, codec.NewAMF0CodecData())
+		self.GotData = true
+	}
+}
+
+// Audio or video stream is inserted before data stream, so that indexes of
+// them don't depend on order of tags.
+func (self *Prober) addStream(stream av.CodecData) (idx int) {
+	if !self.GotData {
+		idx = len(self.Streams)
+		self.Streams = append(self.Streams, stream)
+		return
+	}
+	idx = self.DataStreamIdx
+	self.Streams = append(self.Streams[:idx:idx], stream, self.Streams[idx])
+	self.DataStreamIdx++
+	for i := range self.CachedPkts {
+		if self.CachedPkts[i].Idx == int8(idx) {
+			self.CachedPkts[i].Idx = int8(self.DataStreamIdx)
+		}
+	}
+	return
+}
+
+func (self *Prober) changeCodecData(idx int, stream av.CodecData) {
+	self.Streams = av.ApplyCodecDataChange(self.Streams, av.Packet{Idx: int8(idx), CodecData: stream})
+	if self.changedCodecData == nil {
+		self.changedCodecData = make([]av.CodecData, len(self.Streams))
+	}
+	self.changedCodecData[idx] = stream
+}
+
+// New sequence header sent by publisher after probing, e.g: resolution changed.
+// Resent ones with same content are ignored.
+func (self *Prober) handleSeqHdr(tag flvio.Tag) {
+	switch tag.Type {
+	case flvio.TAG_VIDEO:
+		if !self.GotVideo {
+			return
+		}
+		old, _ := self.Streams[self.VideoStreamIdx].(h264parser.CodecData)
+		if bytes.Equal(old.AVCDecoderConfRecordBytes(), tag.Data) {
+			return
+		}
+		if stream, err := h264parser.NewCodecDataFromAVCDecoderConfRecord(tag.Data); err == nil {
+			self.changeCodecData(self.VideoStreamIdx, stream)
+		}
+
+	case flvio.TAG_AUDIO:
+		if !self.GotAudio {
+			return
+		}
+		old, _ := self.Streams[self.AudioStreamIdx].(aacparser.CodecData)
+		if bytes.Equal(old.MPEG4AudioConfigBytes(), tag.Data) {
+			return
+		}
+		if stream, err := aacparser.NewCodecDataFromMPEG4AudioConfigBytes(tag.Data); err == nil {
+			self.changeCodecData(self.AudioStreamIdx, stream)
+		}
+	}
+}
+
 func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 	self.PushedCount++
 
@@ -91,8 +214,7 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 					err = fmt.Errorf("flv: h264 seqhdr invalid")
 					return
 				}
-				self.VideoStreamIdx = len(self.Streams)
-				self.Streams = append(self.Streams, stream)
+				self.VideoStreamIdx = self.addStream(stream)
 				self.GotVideo = true
 			}
 
@@ -111,8 +233,7 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 						err = fmt.Errorf("flv: aac seqhdr invalid")
 						return
 					}
-					self.AudioStreamIdx = len(self.Streams)
-					self.Streams = append(self.Streams, stream)
+					self.AudioStreamIdx = self.addStream(stream)
 					self.GotAudio = true
 				}
 
@@ -123,12 +244,33 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 		case flvio.SOUND_SPEEX:
 			if !self.GotAudio {
 				stream := codec.NewSpeexCodecData(16000, tag.ChannelLayout())
-				self.AudioStreamIdx = len(self.Streams)
-				self.Streams = append(self.Streams, stream)
+				self.AudioStreamIdx = self.addStream(stream)
 				self.GotAudio = true
 				self.CacheTag(tag, timestamp)
 			}
 
+		case flvio.SOUND_MP3, flvio.SOUND_MP3_8KHZ:
+			if !self.GotAudio {
+				var stream mp3parser.CodecData
+				if stream, err = mp3parser.NewCodecDataFromFrame(tag.Data); err != nil {
+					// frame header not found in first tag, trust flv tag header
+					hdr := mp3parser.FrameHeader{
+						Version:    mp3parser.MPEG1,
+						Layer:      3,
+						SampleRate: tag.SampleRate(),
+					}
+					if tag.SoundType == flvio.SOUND_MONO {
+						hdr.ChannelMode = mp3parser.CHANNEL_MONO
+					}
+					if stream, err = mp3parser.NewCodecDataFromFrameHeader(hdr); err != nil {
+						return
+					}
+				}
+				self.AudioStreamIdx = self.addStream(stream)
+				self.GotAudio = true
+			}
+			self.CacheTag(tag, timestamp)
+
 		case flvio.SOUND_NELLYMOSER:
 			if !self.GotAudio {
 				stream := fake.CodecData{
@@ -137,13 +279,28 @@ func (self *Prober) PushTag(tag flvio.Tag, timestamp int32) (err error) {
 					SampleFormat_:  av.S16,
 					ChannelLayout_: tag.ChannelLayout(),
 				}
-				self.AudioStreamIdx = len(self.Streams)
-				self.Streams = append(self.Streams, stream)
+				self.AudioStreamIdx = self.addStream(stream)
 				self.GotAudio = true
 				self.CacheTag(tag, timestamp)
 			}
 
 		}
+
+	case flvio.TAG_SCRIPTDATA:
+		// With DataStream set, data stream is only created when cue points
+		// are seen or announced while probing, script tags after that are
+		// dropped without it.
+		name, n := scriptDataName(tag.Data)
+		if name == "onMetaData" {
+			if metadataHasCuePoints(tag.Data[n:]) {
+				self.addDataStream()
+			}
+		} else if name != "" {
+			self.addDataStream()
+			if self.GotData {
+				self.CacheTag(tag, timestamp)
+			}
+		}
 	}
 
 	return
@@ -167,6 +324,9 @@ func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 	case flvio.TAG_VIDEO:
 		pkt.Idx = int8(self.VideoStreamIdx)
 		switch tag.AVCPacketType {
+		case flvio.AVC_SEQHDR:
+			self.handleSeqHdr(tag)
+
 		case flvio.AVC_NALU:
 			ok = true
 			pkt.Data = tag.Data
@@ -179,6 +339,9 @@ func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 		switch tag.SoundFormat {
 		case flvio.SOUND_AAC:
 			switch tag.AACPacketType {
+			case flvio.AAC_SEQHDR:
+				self.handleSeqHdr(tag)
+
 			case flvio.AAC_RAW:
 				ok = true
 				pkt.Data = tag.Data
@@ -191,10 +354,38 @@ func (self *Prober) TagToPacket(tag flvio.Tag, timestamp int32) (pkt av.Packet,
 		case flvio.SOUND_NELLYMOSER:
 			ok = true
 			pkt.Data = tag.Data
+
+		case flvio.SOUND_MP3, flvio.SOUND_MP3_8KHZ:
+			ok = true
+			pkt.Data = tag.Data
+		}
+
+	case flvio.TAG_SCRIPTDATA:
+		pkt.Idx = int8(self.DataStreamIdx)
+		name, n := scriptDataName(tag.Data)
+		if name == "onFI" {
+			if tm, _ok := parseOnFI(tag.Data[n:]); _ok {
+				self.wallclock = tm
+				self.wallclockTime = flvio.TsToTime(timestamp)
+			}
+		}
+		if self.GotData && name != "" && name != "onMetaData" {
+			ok = true
+			pkt.Data = tag.Data
 		}
 	}
 
 	pkt.Time = flvio.TsToTime(timestamp)
+	if tag.Filter {
+		pkt.AddSideData(av.SIDE_DATA_ENCRYPTION, nil)
+	}
+	if !self.wallclock.IsZero() {
+		pkt.SetWallclock(self.wallclock.Add(pkt.Time - self.wallclockTime))
+	}
+	if ok && int(pkt.Idx) < len(self.changedCodecData) {
+		pkt.CodecData = self.changedCodecData[pkt.Idx]
+		self.changedCodecData[pkt.Idx] = nil
+	}
 	return
 }
 
@@ -224,7 +415,11 @@ func CodecDataToTag(stream av.CodecData) (_tag flvio.Tag, ok bool, err error) {
 
 	case av.NELLYMOSER:
 	case av.SPEEX:
+	case av.MP3:
+	case av.AMF0:
 
+	case av.ID3, av.TX3G:
+		// not carried by flv, packets are dropped by Muxer
 	case av.AAC:
 		aac := stream.(aacparser.CodecData)
 		tag := flvio.Tag{
@@ -263,7 +458,7 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 			Type:            flvio.TAG_VIDEO,
 			AVCPacketType:   flvio.AVC_NALU,
 			CodecID:         flvio.VIDEO_H264,
-			Data:            pkt.Data,
+			Data:            h264parser.PrependNALUsToAVCC(pkt.SideDataList(av.SIDE_DATA_SEI), pkt.Data),
 			CompositionTime: flvio.TimeToTs(pkt.CompositionTime),
 		}
 		if pkt.IsKeyFrame {
@@ -307,8 +502,42 @@ func PacketToTag(pkt av.Packet, stream av.CodecData) (tag flvio.Tag, timestamp i
 			SoundFormat: flvio.SOUND_NELLYMOSER,
 			Data:        pkt.Data,
 		}
+
+	case av.AMF0:
+		tag = flvio.Tag{
+			Type: flvio.TAG_SCRIPTDATA,
+			Data: pkt.Data,
+		}
+
+	case av.MP3:
+		tag = flvio.Tag{
+			Type:        flvio.TAG_AUDIO,
+			SoundFormat: flvio.SOUND_MP3,
+			SoundSize:   flvio.SOUND_16BIT,
+			Data:        pkt.Data,
+		}
+		astream := stream.(av.AudioCodecData)
+		switch astream.SampleRate() {
+		case 8000:
+			tag.SoundFormat = flvio.SOUND_MP3_8KHZ
+		case 11025:
+			tag.SoundRate = flvio.SOUND_11Khz
+		case 22050:
+			tag.SoundRate = flvio.SOUND_22Khz
+		default:
+			tag.SoundRate = flvio.SOUND_44Khz
+		}
+		switch astream.ChannelLayout().Count() {
+		case 1:
+			tag.SoundType = flvio.SOUND_MONO
+		default:
+			tag.SoundType = flvio.SOUND_STEREO
+		}
 	}
 
+	if _, ok := pkt.GetSideData(av.SIDE_DATA_ENCRYPTION); ok {
+		tag.Filter = true
+	}
 	timestamp = flvio.TimeToTs(pkt.Time)
 	return
 }
@@ -335,7 +564,7 @@ func NewMuxer(w io.Writer) *Muxer {
 	return NewMuxerWriteFlusher(bufio.NewWriterSize(w, pio.RecommendBufioSize))
 }
 
-var CodecTypes = []av.CodecType{av.H264, av.AAC, av.SPEEX}
+var CodecTypes = []av.CodecType{av.H264, av.AAC, av.SPEEX, av.MP3, av.AMF0}
 
 func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	var flags uint8
@@ -352,6 +581,16 @@ func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 		return
 	}
 
+	for _, stream := range streams {
+		if stream.Type() == av.AMF0 {
+			// announce cue points so that Prober creates the data stream
+			if err = self.writeCuePointsMetadata(); err != nil {
+				return
+			}
+			break
+		}
+	}
+
 	for _, stream := range streams {
 		var tag flvio.Tag
 		var ok bool
@@ -369,7 +608,36 @@ func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	return
 }
 
+func (self *Muxer) writeCuePointsMetadata() (err error) {
+	metadata := flvio.AMFMap{"hasCuePoints": true}
+	b := make([]byte, flvio.LenAMF0Val("onMetaData")+flvio.LenAMF0Val(metadata))
+	n := flvio.FillAMF0Val(b, "onMetaData")
+	flvio.FillAMF0Val(b[n:], metadata)
+	tag := flvio.Tag{
+		Type: flvio.TAG_SCRIPTDATA,
+		Data: b,
+	}
+	if err = flvio.WriteTag(self.bufw, tag, 0, self.b); err != nil {
+		return
+	}
+	return
+}
+
+// Data streams other than AMF0 script data are not carried, e.g: ID3 from ts.
+func IsCarried(typ av.CodecType) bool {
+	return !typ.IsData() || typ == av.AMF0
+}
+
 func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
+	if !IsCarried(self.streams[pkt.Idx].Type()) {
+		return
+	}
+	if pkt.CodecData != nil {
+		if err = self.writeCodecDataChange(pkt); err != nil {
+			return
+		}
+	}
+
 	stream := self.streams[pkt.Idx]
 	tag, timestamp := PacketToTag(pkt, stream)
 
@@ -379,6 +647,27 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 	return
 }
 
+// New sequence header tag is written before the packet using it.
+func (self *Muxer) writeCodecDataChange(pkt av.Packet) (err error) {
+	if pkt.CodecData.Type() != self.streams[pkt.Idx].Type() {
+		err = fmt.Errorf("flv: stream#%d codec type change to %v not supported", pkt.Idx, pkt.CodecData.Type())
+		return
+	}
+	self.streams = av.ApplyCodecDataChange(self.streams, pkt)
+
+	var tag flvio.Tag
+	var ok bool
+	if tag, ok, err = CodecDataToTag(pkt.CodecData); err != nil {
+		return
+	}
+	if ok {
+		if err = flvio.WriteTag(self.bufw, tag, flvio.TimeToTs(pkt.Time), self.b); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (self *Muxer) WriteTrailer() (err error) {
 	if err = self.bufw.Flush(); err != nil {
 		return
@@ -387,6 +676,8 @@ func (self *Muxer) WriteTrailer() (err error) {
 }
 
 type Demuxer struct {
+	DataStream bool // see Prober.DataStream
+
 	prober *Prober
 	bufr   *bufio.Reader
 	b      []byte
@@ -422,6 +713,7 @@ func (self *Demuxer) prepare() (err error) {
 			if flags&flvio.FILE_HAS_VIDEO != 0 {
 				self.prober.HasVideo = true
 			}
+			self.prober.DataStream = self.DataStream
 			self.stage++
 
 		case 1:
@@ -475,11 +767,26 @@ func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 	return
 }
 
+func probeScore(b []byte) (score int, err error) {
+	if len(b) < 4 || string(b[0:3]) != "FLV" {
+		err = fmt.Errorf("flv: signature not found")
+		return
+	}
+	if b[3] == 1 {
+		score = avutil.ProbeScoreMax
+	} else {
+		score = avutil.ProbeScoreDefault
+	}
+	return
+}
+
 func Handler(h *avutil.RegisterHandler) {
 	h.Probe = func(b []byte) bool {
 		return b[0] == 'F' && b[1] == 'L' && b[2] == 'V'
 	}
 
+	h.ProbeScore = probeScore
+
 	h.Ext = ".flv"
 
 	h.ReaderDemuxer = func(r io.Reader) av.Demuxer {
@@ -0,0 +1,253 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec"
+	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/format/flv/flvio"
+	"github.com/nareix/joy4/format/mp4"
+	"github.com/nareix/joy4/format/ts"
+)
+
+func testStreams(t *testing.T) []av.CodecData {
+	sps, _ := hex.DecodeString("67640028acd940780227e5c05a808080a0000003002000000781e3062cb0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	video, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AOT_AAC_LC,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []av.CodecData{video, audio, codec.NewAMF0CodecData()}
+}
+
+func testCuePoint(name string) []byte {
+	data := flvio.AMFMap{"name": name, "type": "event"}
+	b := make([]byte, flvio.LenAMF0Val("onCuePoint")+flvio.LenAMF0Val(data))
+	n := flvio.FillAMF0Val(b, "onCuePoint")
+	flvio.FillAMF0Val(b[n:], data)
+	return b
+}
+
+// 2s of 25fps video with 1s gop and audio, cue point every second.
+func testFlv(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err := muxer.WriteHeader(testStreams(t)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		tm := time.Duration(i) * time.Second / 25
+		video := av.Packet{Idx: 0, Time: tm, Data: []byte{0, 0, 0, 2, 0x41, 0x9a}}
+		if i%25 == 0 {
+			video.IsKeyFrame = true
+			video.Data = []byte{0, 0, 0, 2, 0x65, 0x88}
+			if err := muxer.WritePacket(av.Packet{Idx: 2, Time: tm, Data: testCuePoint("cue")}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := muxer.WritePacket(video); err != nil {
+			t.Fatal(err)
+		}
+		if err := muxer.WritePacket(av.Packet{Idx: 1, Time: tm, Data: []byte{0x21, 0x10, 0x04}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Packet count of each stream until io.EOF.
+func countPackets(t *testing.T, demuxer av.Demuxer) (streams []av.CodecData, counts []int) {
+	var err error
+	if streams, err = demuxer.Streams(); err != nil {
+		t.Fatal(err)
+	}
+	counts = make([]int, len(streams))
+	for {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		counts[pkt.Idx]++
+	}
+	return
+}
+
+func TestDemuxerDataStream(t *testing.T) {
+	b := testFlv(t)
+
+	streams, counts := countPackets(t, NewDemuxer(bytes.NewReader(b)))
+	if len(streams) != 2 || counts[0] != 50 || counts[1] != 50 {
+		t.Fatalf("default got %d streams %v packets", len(streams), counts)
+	}
+
+	demuxer := NewDemuxer(bytes.NewReader(b))
+	demuxer.DataStream = true
+	streams, counts = countPackets(t, demuxer)
+	// announced by onMetaData before sequence headers, still after A/V
+	if len(streams) != 3 || !streams[0].Type().IsVideo() || !streams[1].Type().IsAudio() || streams[2].Type() != av.AMF0 {
+		t.Fatalf("got %d streams", len(streams))
+	}
+	if counts[0] != 50 || counts[1] != 50 || counts[2] != 2 {
+		t.Fatalf("got %v packets", counts)
+	}
+}
+
+// Remux with cue points to formats not carrying AMF0, data packets dropped.
+func TestRemuxCuePoints(t *testing.T) {
+	b := testFlv(t)
+
+	tsbuf := &bytes.Buffer{}
+	demuxer := NewDemuxer(bytes.NewReader(b))
+	demuxer.DataStream = true
+	if err := avutil.CopyFile(ts.NewMuxer(tsbuf), demuxer); err != nil {
+		t.Fatal(err)
+	}
+	streams, counts := countPackets(t, ts.NewDemuxer(tsbuf))
+	if len(streams) != 2 || counts[0] != 50 || counts[1] != 50 {
+		t.Fatalf("ts got %d streams %v packets", len(streams), counts)
+	}
+
+	f, err := ioutil.TempFile("", "flv_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	demuxer = NewDemuxer(bytes.NewReader(b))
+	demuxer.DataStream = true
+	if err = avutil.CopyFile(mp4.NewMuxer(f), demuxer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	streams, counts = countPackets(t, mp4.NewDemuxer(f))
+	if len(streams) != 2 || counts[0] != 50 || counts[1] != 50 {
+		t.Fatalf("mp4 got %d streams %v packets", len(streams), counts)
+	}
+
+	// and kept by flv
+	flvbuf := &bytes.Buffer{}
+	demuxer = NewDemuxer(bytes.NewReader(b))
+	demuxer.DataStream = true
+	if err = avutil.CopyFile(NewMuxer(flvbuf), demuxer); err != nil {
+		t.Fatal(err)
+	}
+	demuxer = NewDemuxer(flvbuf)
+	demuxer.DataStream = true
+	if streams, counts = countPackets(t, demuxer); len(streams) != 3 || counts[2] != 2 {
+		t.Fatalf("flv got %d streams %v packets", len(streams), counts)
+	}
+}
+
+func TestEncryptionSideData(t *testing.T) {
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err := muxer.WriteHeader(testStreams(t)[:2]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		pkt := av.Packet{Idx: int8(i % 2), Time: time.Duration(i/2) * time.Second / 25, Data: []byte{0, 0, 0, 2, 0x65, 0x88}}
+		pkt.IsKeyFrame = pkt.Idx == 0
+		if i%3 == 0 {
+			pkt.AddSideData(av.SIDE_DATA_ENCRYPTION, nil)
+		}
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := NewDemuxer(buf)
+	for i := 0; ; i++ {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			if i != 10 {
+				t.Fatalf("got %d packets", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := pkt.GetSideData(av.SIDE_DATA_ENCRYPTION); ok != (i%3 == 0) {
+			t.Fatalf("packet#%d encrypted=%v", i, ok)
+		}
+	}
+}
+
+func TestCodecDataChange(t *testing.T) {
+	sps, _ := hex.DecodeString("6764001facd9405005bb011000000300100000030320f18319a0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	changed, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err = muxer.WriteHeader(testStreams(t)[:2]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		pkt := av.Packet{Idx: 0, Time: time.Duration(i) * time.Second / 25, Data: []byte{0, 0, 0, 2, 0x41, 0x9a}}
+		if i%25 == 0 {
+			pkt.IsKeyFrame = true
+			pkt.Data = []byte{0, 0, 0, 2, 0x65, 0x88}
+		}
+		if i == 25 {
+			pkt.CodecData = changed
+		}
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := NewDemuxer(buf)
+	for i := 0; ; i++ {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err == io.EOF {
+			if i != 50 {
+				t.Fatalf("got %d packets", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if i != 25 {
+			if pkt.CodecData != nil {
+				t.Fatalf("packet#%d codec data changed", i)
+			}
+			continue
+		}
+		codec, ok := pkt.CodecData.(h264parser.CodecData)
+		if !ok || codec.Width() != 1280 || codec.Height() != 720 {
+			t.Fatalf("packet#%d codec data %v", i, pkt.CodecData)
+		}
+	}
+}
@@ -33,6 +33,7 @@ const (
 	SOUND_MULAW                 = 8
 	SOUND_AAC                   = 10
 	SOUND_SPEEX                 = 11
+	SOUND_MP3_8KHZ              = 14
 
 	SOUND_5_5Khz = 0
 	SOUND_11Khz  = 1
@@ -63,6 +64,12 @@ const (
 type Tag struct {
 	Type uint8
 
+	/*
+		Filter: UB[1] in tag header
+		1 = packet is encrypted, Data starts with EncryptionTagHeader and FilterParams
+	*/
+	Filter bool
+
 	/*
 		SoundFormat: UB[4]
 		0 = Linear PCM, platform endian
@@ -160,6 +167,21 @@ func (self Tag) ChannelLayout() av.ChannelLayout {
 	}
 }
 
+func (self Tag) SampleRate() int {
+	if self.SoundFormat == SOUND_MP3_8KHZ {
+		return 8000
+	}
+	switch self.SoundRate {
+	case SOUND_5_5Khz:
+		return 5512
+	case SOUND_11Khz:
+		return 11025
+	case SOUND_22Khz:
+		return 22050
+	}
+	return 44100
+}
+
 func (self *Tag) audioParseHeader(b []byte) (n int, err error) {
 	if len(b) < n+1 {
 		err = fmt.Errorf("audiodata: parse invalid")
@@ -276,12 +298,15 @@ const (
 const TagHeaderLength = 11
 const TagTrailerLength = 4
 
+// Filter bit in tag type field.
+const TAG_FILTER = 0x20
+
 func ParseTagHeader(b []byte) (tag Tag, ts int32, datalen int, err error) {
-	tagtype := b[0]
+	tagtype := b[0] &^ TAG_FILTER
 
 	switch tagtype {
 	case TAG_AUDIO, TAG_VIDEO, TAG_SCRIPTDATA:
-		tag = Tag{Type: tagtype}
+		tag = Tag{Type: tagtype, Filter: b[0]&TAG_FILTER != 0}
 
 	default:
 		err = fmt.Errorf("flvio: ReadTag tagtype=%d invalid", tagtype)
@@ -351,7 +376,11 @@ func WriteTag(w io.Writer, tag Tag, ts int32, b []byte) (err error) {
 	n := tag.FillHeader(b[TagHeaderLength:])
 	datalen := len(data) + n
 
-	n += FillTagHeader(b, tag.Type, datalen, ts)
+	tagtype := tag.Type
+	if tag.Filter {
+		tagtype |= TAG_FILTER
+	}
+	n += FillTagHeader(b, tagtype, datalen, ts)
 
 	if _, err = w.Write(b[:n]); err != nil {
 		return
@@ -7,6 +7,9 @@ import (
 	"github.com/nareix/joy4/format/rtsp"
 	"github.com/nareix/joy4/format/flv"
 	"github.com/nareix/joy4/format/aac"
+	"github.com/nareix/joy4/format/mp3"
+	"github.com/nareix/joy4/format/ivf"
+	"github.com/nareix/joy4/format/httpin"
 	"github.com/nareix/joy4/av/avutil"
 )
 
@@ -17,5 +20,8 @@ func RegisterAll() {
 	avutil.DefaultHandlers.Add(rtsp.Handler)
 	avutil.DefaultHandlers.Add(flv.Handler)
 	avutil.DefaultHandlers.Add(aac.Handler)
+	avutil.DefaultHandlers.Add(mp3.Handler)
+	avutil.DefaultHandlers.Add(ivf.Handler)
+	avutil.DefaultHandlers.Add(httpin.Handler)
 }
 
@@ -0,0 +1,254 @@
+// Package httpin reads progressive and live media over http(s), e.g: HTTP-FLV, TS and MP4 files.
+package httpin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+)
+
+// Defaults of Demuxer and Reader created by Handler.
+var MaxReconnect = 0
+var ReconnectDelay = time.Second
+
+// Demuxer sniffs container from response body. Live streams without range
+// support are reconnected from start after read error, first packet after
+// that is marked as discontinuity and carries codec data of new connection.
+type Demuxer struct {
+	URL            string
+	Handlers       *avutil.Handlers // used for probing, avutil.DefaultHandlers if nil
+	MaxReconnect   int              // -1 means unlimited
+	ReconnectDelay time.Duration
+	ReconnectAtEOF bool // live server closing connection is treated as error
+
+	lock       sync.Mutex // r replaced by reconnect while interrupt may be called
+	r          *Reader
+	demuxer    av.Demuxer
+	streams    []av.CodecData
+	reconnects int
+
+	// after reconnect, attached to first packet of each stream
+	discontinuity bool
+	changed       []av.CodecData
+}
+
+func NewDemuxer(uri string) *Demuxer {
+	return &Demuxer{
+		URL:            uri,
+		MaxReconnect:   MaxReconnect,
+		ReconnectDelay: ReconnectDelay,
+	}
+}
+
+func Dial(uri string) (self *Demuxer, err error) {
+	return DialContext(context.Background(), uri)
+}
+
+func DialContext(ctx context.Context, uri string) (self *Demuxer, err error) {
+	self = NewDemuxer(uri)
+	if err = self.open(ctx); err != nil {
+		return
+	}
+	return
+}
+
+func (self *Demuxer) open(ctx context.Context) (err error) {
+	handlers := self.Handlers
+	if handlers == nil {
+		handlers = avutil.DefaultHandlers
+	}
+
+	var r *Reader
+	if r, err = OpenReader(ctx, self.URL); err != nil {
+		return
+	}
+	r.MaxRetry = self.MaxReconnect
+	if r.MaxRetry < 0 {
+		r.MaxRetry = int(^uint(0) >> 1)
+	}
+	r.RetryDelay = self.ReconnectDelay
+
+	var demuxer av.Demuxer
+	if err = avutil.DoContext(ctx, r.interrupt, r.resume, func() (err error) {
+		if r.Seekable() {
+			demuxer, err = handlers.OpenReadSeeker(r)
+		} else {
+			demuxer, err = handlers.OpenReader(r)
+		}
+		return
+	}); err != nil {
+		r.Close()
+		return
+	}
+
+	self.lock.Lock()
+	self.r = r
+	self.lock.Unlock()
+	self.demuxer = demuxer
+	return
+}
+
+// Interrupt and resume funcs for DoContext, applied to current Reader.
+func (self *Demuxer) interrupt() {
+	self.lock.Lock()
+	self.r.interrupt()
+	self.lock.Unlock()
+}
+
+func (self *Demuxer) resume() {
+	self.lock.Lock()
+	self.r.resume()
+	self.lock.Unlock()
+}
+
+func (self *Demuxer) canReconnect(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || err == context.Canceled {
+		// read cancelled on purpose
+		return false
+	}
+	if self.r.Seekable() {
+		// resumed by Reader
+		return false
+	}
+	if err == io.EOF && !self.ReconnectAtEOF {
+		return false
+	}
+	return self.MaxReconnect < 0 || self.reconnects < self.MaxReconnect
+}
+
+func (self *Demuxer) reconnect(ctx context.Context) (err error) {
+	self.reconnects++
+	self.r.Close()
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	case <-time.After(self.ReconnectDelay):
+	}
+	if err = self.open(ctx); err != nil {
+		return
+	}
+
+	var streams []av.CodecData
+	if streams, err = self.demuxer.Streams(); err != nil {
+		return
+	}
+	if self.streams != nil && len(streams) != len(self.streams) {
+		err = fmt.Errorf("httpin: %s: stream count changed after reconnect", self.URL)
+		return
+	}
+	self.streams = streams
+	self.changed = append([]av.CodecData(nil), streams...)
+	self.discontinuity = true
+	return
+}
+
+func (self *Demuxer) Streams() (streams []av.CodecData, err error) {
+	if self.streams == nil {
+		if self.streams, err = self.demuxer.Streams(); err != nil {
+			return
+		}
+	}
+	streams = self.streams
+	return
+}
+
+func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
+	return self.readPacket(context.Background())
+}
+
+// Reconnects are stopped and delays between them aborted when ctx is done.
+func (self *Demuxer) readPacket(ctx context.Context) (pkt av.Packet, err error) {
+	if _, err = self.Streams(); err != nil {
+		return
+	}
+	for {
+		if pkt, err = self.demuxer.ReadPacket(); err == nil {
+			break
+		}
+		if !self.canReconnect(ctx, err) {
+			return
+		}
+		if err = self.reconnect(ctx); err != nil {
+			if self.canReconnect(ctx, err) {
+				continue
+			}
+			return
+		}
+	}
+	self.reconnects = 0
+
+	if pkt.CodecData != nil {
+		self.streams = av.ApplyCodecDataChange(self.streams, pkt)
+	}
+	if self.discontinuity {
+		pkt.SetDiscontinuity()
+		self.discontinuity = false
+	}
+	if int(pkt.Idx) < len(self.changed) && self.changed[pkt.Idx] != nil {
+		if pkt.CodecData == nil {
+			pkt.CodecData = self.changed[pkt.Idx]
+		}
+		self.changed[pkt.Idx] = nil
+	}
+	return
+}
+
+func (self *Demuxer) StreamsContext(ctx context.Context) (streams []av.CodecData, err error) {
+	err = avutil.DoContext(ctx, self.interrupt, self.resume, func() (err error) {
+		streams, err = self.Streams()
+		return
+	})
+	return
+}
+
+func (self *Demuxer) ReadPacketContext(ctx context.Context) (pkt av.Packet, err error) {
+	err = avutil.DoContext(ctx, self.interrupt, self.resume, func() (err error) {
+		pkt, err = self.readPacket(ctx)
+		return
+	})
+	return
+}
+
+func (self *Demuxer) Close() (err error) {
+	return self.r.Close()
+}
+
+func isHttpUrl(uri string) bool {
+	return strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://")
+}
+
+func Handler(h *avutil.RegisterHandler) {
+	h.UrlDemuxer = func(uri string) (ok bool, demuxer av.DemuxCloser, err error) {
+		if !isHttpUrl(uri) {
+			return
+		}
+		ok = true
+		demuxer, err = Dial(uri)
+		return
+	}
+
+	h.UrlDemuxerContext = func(ctx context.Context, uri string) (ok bool, demuxer av.DemuxCloser, err error) {
+		if !isHttpUrl(uri) {
+			return
+		}
+		ok = true
+		demuxer, err = DialContext(ctx, uri)
+		return
+	}
+
+	h.UrlReader = func(uri string) (ok bool, r io.ReadCloser, err error) {
+		if !isHttpUrl(uri) {
+			return
+		}
+		ok = true
+		r, err = OpenReader(context.Background(), uri)
+		return
+	}
+}
@@ -0,0 +1,290 @@
+package httpin_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/format"
+	"github.com/nareix/joy4/format/flv"
+	"github.com/nareix/joy4/format/httpin"
+	"github.com/nareix/joy4/format/mp4"
+	"github.com/nareix/joy4/format/ts"
+)
+
+func init() {
+	format.RegisterAll()
+}
+
+const npkts = 20
+
+func writeFile(t *testing.T, muxer av.Muxer) {
+	codec, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AOT_AAC_LC,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = muxer.WriteHeader([]av.CodecData{codec}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < npkts; i++ {
+		pkt := av.Packet{
+			Time: time.Duration(i) * time.Second * 1024 / 44100,
+			Data: bytes.Repeat([]byte{byte(i)}, 100),
+		}
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readAll(t *testing.T, uri string) {
+	demuxer, err := avutil.Open(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer demuxer.Close()
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Type() != av.AAC {
+		t.Fatalf("%s: streams=%v", uri, streams)
+	}
+	n := 0
+	for {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err != nil {
+			break
+		}
+		if len(pkt.Data) != 100 || pkt.Data[0] != byte(n) {
+			t.Fatalf("%s: packet %d corrupted", uri, n)
+		}
+		n++
+	}
+	if err != io.EOF {
+		t.Fatalf("%s: %v", uri, err)
+	}
+	if n != npkts {
+		t.Fatalf("%s: got %d packets", uri, n)
+	}
+}
+
+// Live streams without Content-Length are sent with chunked transfer.
+func serveChunked(b []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for len(b) > 0 {
+			n := 1000
+			if n > len(b) {
+				n = len(b)
+			}
+			w.Write(b[:n])
+			w.(http.Flusher).Flush()
+			b = b[n:]
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	flvbuf := &bytes.Buffer{}
+	writeFile(t, flv.NewMuxer(flvbuf))
+	tsbuf := &bytes.Buffer{}
+	writeFile(t, ts.NewMuxer(tsbuf))
+
+	f, err := ioutil.TempFile("", "httpin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	writeFile(t, mp4.NewMuxer(f))
+	f.Close()
+	mp4data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.flv", serveChunked(flvbuf.Bytes()))
+	mux.HandleFunc("/live.ts", serveChunked(tsbuf.Bytes()))
+	mux.HandleFunc("/live", serveChunked(flvbuf.Bytes()))
+	mux.HandleFunc("/file.mp4", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.mp4", time.Time{}, bytes.NewReader(mp4data))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, path := range []string{"/live.flv", "/live.ts", "/live", "/file.mp4"} {
+		readAll(t, server.URL+path)
+	}
+}
+
+// Read all packets, then ReadPacketContext must return soon after ctx done
+// though reconnect is unlimited.
+func checkCancel(t *testing.T, demuxer *httpin.Demuxer, reconnect bool) {
+	if reconnect {
+		demuxer.MaxReconnect = -1
+		demuxer.ReconnectDelay = time.Millisecond * 10
+		demuxer.ReconnectAtEOF = true
+	}
+	defer demuxer.Close()
+	for i := 0; i < npkts; i++ {
+		if _, err := demuxer.ReadPacket(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := demuxer.ReadPacketContext(ctx)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("err=%v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("ReadPacketContext not returned after ctx done")
+	}
+}
+
+// Live stream sending all packets then stalling.
+func TestCancelStalled(t *testing.T) {
+	flvbuf := &bytes.Buffer{}
+	writeFile(t, flv.NewMuxer(flvbuf))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveChunked(flvbuf.Bytes())(w, r)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	demuxer, err := httpin.Dial(server.URL + "/live.flv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCancel(t, demuxer, true)
+}
+
+// Live stream ends and origin is down afterwards.
+func TestCancelReconnect(t *testing.T) {
+	flvbuf := &bytes.Buffer{}
+	writeFile(t, flv.NewMuxer(flvbuf))
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		serveChunked(flvbuf.Bytes())(w, r)
+	}))
+	defer server.Close()
+
+	demuxer, err := httpin.Dial(server.URL + "/live.flv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCancel(t, demuxer, true)
+	if atomic.LoadInt32(&requests) < 2 {
+		t.Fatal("not reconnected")
+	}
+}
+
+// Sends n bytes and flushes them, then blocks until request cancelled.
+type stallReadSeeker struct {
+	io.ReadSeeker
+	w http.ResponseWriter
+	r *http.Request
+	n int
+}
+
+func (self *stallReadSeeker) Read(p []byte) (n int, err error) {
+	if self.n == 0 {
+		self.w.(http.Flusher).Flush()
+		<-self.r.Context().Done()
+		err = self.r.Context().Err()
+		return
+	}
+	if len(p) > self.n {
+		p = p[:self.n]
+	}
+	n, err = self.ReadSeeker.Read(p)
+	self.n -= n
+	return
+}
+
+// Range request resumed by Reader stalls in the middle.
+func TestCancelRangeStalled(t *testing.T) {
+	f, err := ioutil.TempFile("", "httpin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	writeFile(t, mp4.NewMuxer(f))
+	f.Close()
+	mp4data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stall int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var content io.ReadSeeker = bytes.NewReader(mp4data)
+		if atomic.LoadInt32(&stall) != 0 {
+			content = &stallReadSeeker{ReadSeeker: content, w: w, r: r, n: 10}
+		}
+		http.ServeContent(w, r, "file.mp4", time.Time{}, content)
+	}))
+	defer server.Close()
+
+	// retries of Reader are set by Dial
+	defer func(n int, d time.Duration) {
+		httpin.MaxReconnect, httpin.ReconnectDelay = n, d
+	}(httpin.MaxReconnect, httpin.ReconnectDelay)
+	httpin.MaxReconnect, httpin.ReconnectDelay = -1, time.Millisecond*10
+	demuxer, err := httpin.Dial(server.URL + "/file.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = demuxer.Streams(); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&stall, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for err == nil {
+			_, err = demuxer.ReadPacketContext(ctx)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("err=%v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("ReadPacketContext not returned after ctx done")
+	}
+	demuxer.Close()
+}
@@ -0,0 +1,256 @@
+package httpin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nareix/joy4/av/avutil"
+)
+
+// Reader reads http(s) resource as a file. Seek and resume after read error
+// are done with Range requests if server supports them.
+type Reader struct {
+	URL        string
+	Client     *http.Client // http.DefaultClient if nil
+	Header     http.Header  // extra request headers
+	MaxRetry   int          // times to resume with Range request after read error
+	RetryDelay time.Duration
+
+	lock        sync.Mutex // interrupt may be called from other goroutine
+	cancel      context.CancelFunc
+	interrupted bool
+	interruptc  chan struct{} // closed by interrupt, renewed by resume
+	body        io.ReadCloser
+	pos         int64
+	size        int64 // -1 if unknown, e.g: chunked transfer
+	ranges      bool
+	retry       int
+}
+
+func NewReader(uri string) *Reader {
+	return &Reader{
+		URL:        uri,
+		MaxRetry:   MaxReconnect,
+		RetryDelay: ReconnectDelay,
+		size:       -1,
+		interruptc: make(chan struct{}),
+	}
+}
+
+// Send first request, ctx is used only while connecting.
+func OpenReader(ctx context.Context, uri string) (self *Reader, err error) {
+	self = NewReader(uri)
+	if err = self.connect(ctx); err != nil {
+		return
+	}
+	return
+}
+
+// Content-Range: bytes 0-1023/4096
+func parseContentRangeSize(s string) (size int64, ok bool) {
+	i := strings.LastIndex(s, "/")
+	if !strings.HasPrefix(s, "bytes ") || i == -1 {
+		return
+	}
+	var err error
+	if size, err = strconv.ParseInt(s[i+1:], 10, 64); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func (self *Reader) connect(ctx context.Context) (err error) {
+	reqctx, cancel := context.WithCancel(context.Background())
+	var req *http.Request
+	if req, err = http.NewRequest("GET", self.URL, nil); err != nil {
+		cancel()
+		return
+	}
+	req = req.WithContext(reqctx)
+	for k, v := range self.Header {
+		req.Header[k] = v
+	}
+	if self.pos > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", self.pos))
+	}
+
+	// request of Read is aborted by interrupt too
+	self.lock.Lock()
+	self.cancel = cancel
+	if self.interrupted {
+		cancel()
+	}
+	self.lock.Unlock()
+
+	client := self.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var resp *http.Response
+	if err = avutil.DoContext(ctx, cancel, func() {}, func() (err error) {
+		resp, err = client.Do(req)
+		return
+	}); err != nil {
+		cancel()
+		return
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if self.pos > 0 {
+			err = fmt.Errorf("httpin: %s: range request not supported", self.URL)
+		}
+		self.size = resp.ContentLength
+		self.ranges = resp.Header.Get("Accept-Ranges") == "bytes" && self.size >= 0
+
+	case http.StatusPartialContent:
+		if size, ok := parseContentRangeSize(resp.Header.Get("Content-Range")); ok {
+			self.size = size
+		}
+		self.ranges = true
+
+	default:
+		err = fmt.Errorf("httpin: %s: %s", self.URL, resp.Status)
+	}
+	if err != nil {
+		resp.Body.Close()
+		cancel()
+		return
+	}
+
+	self.body = resp.Body
+	return
+}
+
+func (self *Reader) closeBody() {
+	if self.body != nil {
+		self.lock.Lock()
+		self.cancel()
+		self.lock.Unlock()
+		self.body.Close()
+		self.body = nil
+	}
+}
+
+func (self *Reader) isInterrupted() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.interrupted
+}
+
+// Wait d before retry, returns false if interrupted.
+func (self *Reader) wait(d time.Duration) bool {
+	self.lock.Lock()
+	interruptc := self.interruptc
+	self.lock.Unlock()
+	select {
+	case <-interruptc:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (self *Reader) Read(p []byte) (n int, err error) {
+	if self.body == nil {
+		if err = self.connect(context.Background()); err != nil {
+			return
+		}
+	}
+
+	n, err = self.body.Read(p)
+	self.pos += int64(n)
+	if n > 0 {
+		self.retry = 0
+	}
+	if err == io.EOF && self.size >= 0 && self.pos < self.size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		self.closeBody()
+		// aborted by interrupt on purpose, not retried
+		if err == context.Canceled || self.isInterrupted() {
+			return
+		}
+		if self.ranges && self.retry < self.MaxRetry && self.wait(self.RetryDelay) {
+			// next Read resumes at pos
+			self.retry++
+			err = nil
+		}
+	}
+	return
+}
+
+func (self *Reader) Seek(offset int64, whence int) (pos int64, err error) {
+	switch whence {
+	case 0:
+		pos = offset
+	case 1:
+		pos = self.pos + offset
+	case 2:
+		if self.size < 0 {
+			err = fmt.Errorf("httpin: %s: size unknown", self.URL)
+			return
+		}
+		pos = self.size + offset
+	}
+	if pos < 0 {
+		err = fmt.Errorf("httpin: seek to negative position")
+		return
+	}
+	if pos == self.pos {
+		return
+	}
+	if !self.ranges {
+		err = fmt.Errorf("httpin: %s: seek not supported", self.URL)
+		return
+	}
+	self.closeBody()
+	self.pos = pos
+	return
+}
+
+// Server supports range requests and content length is known.
+func (self *Reader) Seekable() bool {
+	return self.ranges
+}
+
+// Content length, -1 if unknown.
+func (self *Reader) Size() int64 {
+	return self.size
+}
+
+// Abort current request and retry delay, blocking Read returns error and
+// later requests fail until resume.
+func (self *Reader) interrupt() {
+	self.lock.Lock()
+	if !self.interrupted {
+		self.interrupted = true
+		close(self.interruptc)
+	}
+	if self.cancel != nil {
+		self.cancel()
+	}
+	self.lock.Unlock()
+}
+
+func (self *Reader) resume() {
+	self.lock.Lock()
+	if self.interrupted {
+		self.interrupted = false
+		self.interruptc = make(chan struct{})
+	}
+	self.lock.Unlock()
+}
+
+func (self *Reader) Close() (err error) {
+	self.closeBody()
+	return
+}
@@ -0,0 +1,326 @@
+package ivf
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec/av1parser"
+	"github.com/nareix/joy4/codec/vp8parser"
+	"github.com/nareix/joy4/codec/vp9parser"
+	"github.com/nareix/joy4/utils/bits/pio"
+	"io"
+	"time"
+)
+
+/*
+IVF file header, all fields are little endian
+
+	signature(32)="DKIF"
+	version(16)=0
+	header_size(16)=32
+	fourcc(32)
+	width(16)
+	height(16)
+	timebase_denominator(32)
+	timebase_numerator(32)
+	frame_count(32)
+	unused(32)
+
+frame header
+
+	frame_size(32)
+	pts(64)
+*/
+const FileHeaderLength = 32
+const FrameHeaderLength = 12
+
+type FileHeader struct {
+	FourCC      [4]byte
+	Width       int
+	Height      int
+	TimeBaseDen uint32
+	TimeBaseNum uint32
+	FrameCount  uint32
+}
+
+func ParseFileHeader(b []byte) (self FileHeader, err error) {
+	if len(b) < FileHeaderLength || string(b[0:4]) != "DKIF" {
+		err = fmt.Errorf("ivf: file header invalid")
+		return
+	}
+	copy(self.FourCC[:], b[8:12])
+	self.Width = int(pio.U16LE(b[12:]))
+	self.Height = int(pio.U16LE(b[14:]))
+	self.TimeBaseDen = pio.U32LE(b[16:])
+	self.TimeBaseNum = pio.U32LE(b[20:])
+	self.FrameCount = pio.U32LE(b[24:])
+	if self.TimeBaseDen == 0 || self.TimeBaseNum == 0 {
+		err = fmt.Errorf("ivf: timebase invalid")
+		return
+	}
+	return
+}
+
+func FillFileHeader(b []byte, self FileHeader) (n int) {
+	copy(b[0:4], "DKIF")
+	pio.PutU16LE(b[4:], 0)
+	pio.PutU16LE(b[6:], FileHeaderLength)
+	copy(b[8:12], self.FourCC[:])
+	pio.PutU16LE(b[12:], uint16(self.Width))
+	pio.PutU16LE(b[14:], uint16(self.Height))
+	pio.PutU32LE(b[16:], self.TimeBaseDen)
+	pio.PutU32LE(b[20:], self.TimeBaseNum)
+	pio.PutU32LE(b[24:], self.FrameCount)
+	pio.PutU32LE(b[28:], 0)
+	n = FileHeaderLength
+	return
+}
+
+func codecTypeToFourCC(typ av.CodecType) (fourcc string, ok bool) {
+	switch typ {
+	case av.VP8:
+		return "VP80", true
+	case av.VP9:
+		return "VP90", true
+	case av.AV1:
+		return "AV01", true
+	}
+	return
+}
+
+func newCodecData(hdr FileHeader, frame []byte) (codec av.VideoCodecData, err error) {
+	switch string(hdr.FourCC[:]) {
+	case "VP80":
+		if vp8parser.IsKeyFrame(frame) {
+			return vp8parser.NewCodecDataFromKeyFrame(frame)
+		}
+		return vp8parser.NewCodecDataFromKeyFrameInfo(vp8parser.KeyFrameInfo{
+			Width:  uint(hdr.Width),
+			Height: uint(hdr.Height),
+		})
+
+	case "VP90":
+		if vp9parser.IsKeyFrame(frame) {
+			return vp9parser.NewCodecDataFromKeyFrame(frame)
+		}
+		return vp9parser.NewCodecDataFromKeyFrameInfo(vp9parser.KeyFrameInfo{
+			Width:    uint(hdr.Width),
+			Height:   uint(hdr.Height),
+			BitDepth: 8,
+		})
+
+	case "AV01":
+		var obus [][]byte
+		if obus, err = av1parser.SplitOBUs(frame); err != nil {
+			return
+		}
+		for _, obu := range obus {
+			if int(obu[0]>>3)&0xf == av1parser.OBU_SEQUENCE_HEADER {
+				return av1parser.NewCodecDataFromSequenceHeader(obu)
+			}
+		}
+		err = fmt.Errorf("ivf: av1 sequence header not found in first frame")
+		return
+	}
+
+	err = fmt.Errorf("ivf: fourcc=%q unsupported", hdr.FourCC[:])
+	return
+}
+
+type Muxer struct {
+	w          io.Writer
+	b          []byte
+	hdr        FileHeader
+	frameCount uint32
+}
+
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{
+		w: w,
+		b: make([]byte, FileHeaderLength),
+	}
+}
+
+func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
+	if len(streams) != 1 {
+		err = fmt.Errorf("ivf: must be only one video stream")
+		return
+	}
+	fourcc, ok := codecTypeToFourCC(streams[0].Type())
+	if !ok {
+		err = fmt.Errorf("ivf: codec type=%v is not supported", streams[0].Type())
+		return
+	}
+	stream := streams[0].(av.VideoCodecData)
+	copy(self.hdr.FourCC[:], fourcc)
+	self.hdr.Width = stream.Width()
+	self.hdr.Height = stream.Height()
+	// pts in milliseconds
+	self.hdr.TimeBaseDen = 1000
+	self.hdr.TimeBaseNum = 1
+
+	n := FillFileHeader(self.b, self.hdr)
+	if _, err = self.w.Write(self.b[:n]); err != nil {
+		return
+	}
+	return
+}
+
+func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
+	pio.PutU32LE(self.b[0:], uint32(len(pkt.Data)))
+	pio.PutU64LE(self.b[4:], uint64((pkt.Time+pkt.CompositionTime)/time.Millisecond))
+	if _, err = self.w.Write(self.b[:FrameHeaderLength]); err != nil {
+		return
+	}
+	if _, err = self.w.Write(pkt.Data); err != nil {
+		return
+	}
+	self.frameCount++
+	return
+}
+
+// Frame count in file header is filled only if writer is seekable.
+func (self *Muxer) WriteTrailer() (err error) {
+	ws, ok := self.w.(io.WriteSeeker)
+	if !ok {
+		return
+	}
+	var pos int64
+	if pos, err = ws.Seek(0, 1); err != nil {
+		return
+	}
+	if _, err = ws.Seek(24, 0); err != nil {
+		return
+	}
+	pio.PutU32LE(self.b, self.frameCount)
+	if _, err = ws.Write(self.b[:4]); err != nil {
+		return
+	}
+	if _, err = ws.Seek(pos, 0); err != nil {
+		return
+	}
+	return
+}
+
+type Demuxer struct {
+	r         *bufio.Reader
+	b         []byte
+	hdr       FileHeader
+	codecdata av.CodecData
+	pkts      []av.Packet
+}
+
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{
+		r: bufio.NewReader(r),
+		b: make([]byte, FileHeaderLength),
+	}
+}
+
+func (self *Demuxer) readFrame() (pkt av.Packet, err error) {
+	if _, err = io.ReadFull(self.r, self.b[:FrameHeaderLength]); err != nil {
+		return
+	}
+	size := pio.U32LE(self.b[0:])
+	pts := pio.U64LE(self.b[4:])
+	pkt.Data = make([]byte, size)
+	if _, err = io.ReadFull(self.r, pkt.Data); err != nil {
+		return
+	}
+	pkt.Time = timeBaseToTime(pts, self.hdr.TimeBaseNum, self.hdr.TimeBaseDen)
+	return
+}
+
+// Seconds and remainder converted apart, pts*time.Second overflows after 28h
+// of 90kHz timebase.
+func timeBaseToTime(pts uint64, num, den uint32) time.Duration {
+	ticks := pts * uint64(num)
+	return time.Duration(ticks/uint64(den))*time.Second + time.Duration(ticks%uint64(den))*time.Second/time.Duration(den)
+}
+
+func isKeyFrame(typ av.CodecType, frame []byte) bool {
+	switch typ {
+	case av.VP8:
+		return vp8parser.IsKeyFrame(frame)
+	case av.VP9:
+		return vp9parser.IsKeyFrame(frame)
+	case av.AV1:
+		return av1parser.IsKeyFrame(frame)
+	}
+	return false
+}
+
+func (self *Demuxer) probe() (err error) {
+	if self.codecdata != nil {
+		return
+	}
+	if _, err = io.ReadFull(self.r, self.b[:FileHeaderLength]); err != nil {
+		return
+	}
+	if self.hdr, err = ParseFileHeader(self.b); err != nil {
+		return
+	}
+
+	// codec data is parsed from the first frame, keep it for ReadPacket
+	var pkt av.Packet
+	if pkt, err = self.readFrame(); err != nil {
+		return
+	}
+	if self.codecdata, err = newCodecData(self.hdr, pkt.Data); err != nil {
+		return
+	}
+	pkt.IsKeyFrame = isKeyFrame(self.codecdata.Type(), pkt.Data)
+	self.pkts = append(self.pkts, pkt)
+	return
+}
+
+func (self *Demuxer) Streams() (streams []av.CodecData, err error) {
+	if err = self.probe(); err != nil {
+		return
+	}
+	streams = []av.CodecData{self.codecdata}
+	return
+}
+
+func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
+	if err = self.probe(); err != nil {
+		return
+	}
+	if len(self.pkts) > 0 {
+		pkt = self.pkts[0]
+		self.pkts = self.pkts[1:]
+		return
+	}
+	if pkt, err = self.readFrame(); err != nil {
+		return
+	}
+	pkt.IsKeyFrame = isKeyFrame(self.codecdata.Type(), pkt.Data)
+	return
+}
+
+func Handler(h *avutil.RegisterHandler) {
+	h.Ext = ".ivf"
+
+	h.ReaderDemuxer = func(r io.Reader) av.Demuxer {
+		return NewDemuxer(r)
+	}
+
+	h.WriterMuxer = func(w io.Writer) av.Muxer {
+		return NewMuxer(w)
+	}
+
+	h.Probe = func(b []byte) bool {
+		return len(b) >= 4 && string(b[0:4]) == "DKIF"
+	}
+
+	h.ProbeScore = func(b []byte) (score int, err error) {
+		if _, err = ParseFileHeader(b); err != nil {
+			return
+		}
+		score = avutil.ProbeScoreMax
+		return
+	}
+
+	h.CodecTypes = []av.CodecType{av.VP8, av.VP9, av.AV1}
+}
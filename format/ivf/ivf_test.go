@@ -0,0 +1,135 @@
+package ivf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec/vp8parser"
+	"github.com/nareix/joy4/utils/bits/pio"
+)
+
+// VP8 640x480.
+var testKeyFrame = []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01}
+var testInterFrame = []byte{0x31, 0x02, 0x00}
+
+func TestMuxDemux(t *testing.T) {
+	codec, err := vp8parser.NewCodecDataFromKeyFrame(testKeyFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err = muxer.WriteHeader([]av.CodecData{codec}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		pkt := av.Packet{Time: time.Duration(i) * time.Second / 30, Data: testInterFrame}
+		if i%5 == 0 {
+			pkt.IsKeyFrame = true
+			pkt.Data = testKeyFrame
+		}
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, err := ParseFileHeader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hdr.FourCC[:]) != "VP80" || hdr.Width != 640 || hdr.Height != 480 || hdr.TimeBaseNum != 1 || hdr.TimeBaseDen != 1000 {
+		t.Fatalf("header %+v", hdr)
+	}
+
+	demuxer := NewDemuxer(buf)
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, ok := streams[0].(av.VideoCodecData)
+	if len(streams) != 1 || !ok || video.Type() != av.VP8 || video.Width() != 640 || video.Height() != 480 {
+		t.Fatalf("streams %v", streams)
+	}
+	for i := 0; ; i++ {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err == io.EOF {
+			if i != 10 {
+				t.Fatalf("got %d packets", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		// pts in milliseconds
+		if pkt.Time != time.Duration(i)*time.Second/30/time.Millisecond*time.Millisecond {
+			t.Fatalf("packet#%d time=%v", i, pkt.Time)
+		}
+		if pkt.IsKeyFrame != (i%5 == 0) {
+			t.Fatalf("packet#%d key=%v", i, pkt.IsKeyFrame)
+		}
+	}
+}
+
+// File of frames with pts in timebase num/den.
+func testFile(num, den uint32, pts []uint64) []byte {
+	b := make([]byte, FileHeaderLength)
+	hdr := FileHeader{Width: 640, Height: 480, TimeBaseNum: num, TimeBaseDen: den}
+	copy(hdr.FourCC[:], "VP80")
+	FillFileHeader(b, hdr)
+	for _, ts := range pts {
+		fhdr := make([]byte, FrameHeaderLength)
+		pio.PutU32LE(fhdr[0:], uint32(len(testKeyFrame)))
+		pio.PutU64LE(fhdr[4:], ts)
+		b = append(append(b, fhdr...), testKeyFrame...)
+	}
+	return b
+}
+
+func TestTimeBase(t *testing.T) {
+	for _, c := range []struct {
+		num, den uint32
+		pts      uint64
+		tm       time.Duration
+	}{
+		{1, 30, 1, time.Second / 30},
+		{1, 30, 45, time.Second + time.Second/2},
+		{1001, 30000, 3, time.Second * 3003 / 30000},
+		{1, 90000, 48 * 3600 * 90000, time.Hour * 48},
+		{1, 90000, 48*3600*90000 + 3600, time.Hour*48 + time.Second/25},
+	} {
+		demuxer := NewDemuxer(bytes.NewReader(testFile(c.num, c.den, []uint64{0, c.pts})))
+		demuxer.ReadPacket()
+		pkt, err := demuxer.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Time != c.tm {
+			t.Fatalf("pts=%d timebase=%d/%d time=%v want %v", c.pts, c.num, c.den, pkt.Time, c.tm)
+		}
+	}
+}
+
+func TestProbeScore(t *testing.T) {
+	var h avutil.RegisterHandler
+	Handler(&h)
+
+	if score, err := h.ProbeScore(testFile(1, 30, nil)); score != avutil.ProbeScoreMax {
+		t.Fatalf("score=%d err=%v", score, err)
+	}
+	for _, b := range [][]byte{
+		[]byte("DKIF"),
+		testFile(0, 30, nil),
+		append([]byte("RIFF"), make([]byte, 28)...),
+	} {
+		if score, err := h.ProbeScore(b); score != 0 || err == nil {
+			t.Fatalf("%q score=%d err=%v", b[:4], score, err)
+		}
+	}
+}
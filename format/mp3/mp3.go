@@ -0,0 +1,209 @@
+package mp3
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec/mp3parser"
+	"io"
+	"time"
+)
+
+type Muxer struct {
+	w io.Writer
+}
+
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{
+		w: w,
+	}
+}
+
+func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
+	if len(streams) > 1 || streams[0].Type() != av.MP3 {
+		err = fmt.Errorf("mp3: must be only one mp3 stream")
+		return
+	}
+	return
+}
+
+// Packets carry the whole frame including header, so they are written as is.
+func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
+	if _, err = self.w.Write(pkt.Data); err != nil {
+		return
+	}
+	return
+}
+
+func (self *Muxer) WriteTrailer() (err error) {
+	return
+}
+
+// Max bytes to skip when searching for next frame sync.
+var MaxResyncLength = 64 * 1024
+
+type Demuxer struct {
+	r         *bufio.Reader
+	codecdata av.CodecData
+	skipped   bool
+
+	// time is counted in samples from base, rebased if sample rate changes,
+	// so that per frame durations are not rounded and summed up
+	basets     time.Duration
+	samples    int64
+	samplerate int
+}
+
+func NewDemuxer(r io.Reader) *Demuxer {
+	return &Demuxer{
+		r: bufio.NewReader(r),
+	}
+}
+
+// ID3v2 tag size, see http://id3.org/id3v2.4.0-structure
+func id3v2Length(b []byte) (n int, ok bool) {
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return
+	}
+	// syncsafe integer
+	n = int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f)
+	n += 10
+	if b[5]&0x10 != 0 {
+		n += 10 // footer
+	}
+	ok = true
+	return
+}
+
+func (self *Demuxer) skipID3v2() (err error) {
+	if self.skipped {
+		return
+	}
+	var b []byte
+	if b, err = self.r.Peek(10); err != nil {
+		return
+	}
+	if n, ok := id3v2Length(b); ok {
+		if _, err = self.r.Discard(n); err != nil {
+			return
+		}
+	}
+	self.skipped = true
+	return
+}
+
+func (self *Demuxer) readFrameHeader() (hdr mp3parser.FrameHeader, framelen int, samples int, err error) {
+	if err = self.skipID3v2(); err != nil {
+		return
+	}
+	for skip := 0; ; skip++ {
+		var b []byte
+		if b, err = self.r.Peek(mp3parser.FrameHeaderLength); err != nil {
+			return
+		}
+		if string(b[0:3]) == "TAG" {
+			// ID3v1 tag at the end of file
+			err = io.EOF
+			return
+		}
+		if hdr, framelen, samples, err = mp3parser.ParseFrameHeader(b); err == nil {
+			return
+		}
+		if skip >= MaxResyncLength {
+			err = fmt.Errorf("mp3: frame sync not found")
+			return
+		}
+		if _, err = self.r.Discard(1); err != nil {
+			return
+		}
+	}
+}
+
+func (self *Demuxer) Streams() (streams []av.CodecData, err error) {
+	if self.codecdata == nil {
+		var hdr mp3parser.FrameHeader
+		if hdr, _, _, err = self.readFrameHeader(); err != nil {
+			return
+		}
+		if self.codecdata, err = mp3parser.NewCodecDataFromFrameHeader(hdr); err != nil {
+			return
+		}
+	}
+	streams = []av.CodecData{self.codecdata}
+	return
+}
+
+func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
+	var hdr mp3parser.FrameHeader
+	var framelen, samples int
+	if hdr, framelen, samples, err = self.readFrameHeader(); err != nil {
+		return
+	}
+
+	pkt.Data = make([]byte, framelen)
+	if _, err = io.ReadFull(self.r, pkt.Data); err != nil {
+		return
+	}
+
+	if hdr.SampleRate != self.samplerate {
+		self.basets = self.time()
+		self.samples = 0
+		self.samplerate = hdr.SampleRate
+	}
+	pkt.Time = self.time()
+	self.samples += int64(samples)
+	return
+}
+
+func (self *Demuxer) time() time.Duration {
+	if self.samplerate == 0 {
+		return self.basets
+	}
+	rate := int64(self.samplerate)
+	return self.basets + time.Duration(self.samples/rate)*time.Second + time.Duration(self.samples%rate)*time.Second/time.Duration(rate)
+}
+
+func probeScore(b []byte) (score int, err error) {
+	if _, ok := id3v2Length(b); ok {
+		score = avutil.ProbeScoreDefault
+		return
+	}
+	// require two continuous frames to avoid false sync
+	var framelen int
+	if _, framelen, _, err = mp3parser.ParseFrameHeader(b); err != nil {
+		err = fmt.Errorf("mp3: id3 tag or frame header not found")
+		return
+	}
+	if framelen+mp3parser.FrameHeaderLength > len(b) {
+		score = avutil.ProbeScoreMin
+		return
+	}
+	if _, _, _, err = mp3parser.ParseFrameHeader(b[framelen:]); err != nil {
+		err = fmt.Errorf("mp3: frame not continuous")
+		return
+	}
+	score = avutil.ProbeScoreDefault
+	return
+}
+
+func Handler(h *avutil.RegisterHandler) {
+	h.Ext = ".mp3"
+
+	h.ReaderDemuxer = func(r io.Reader) av.Demuxer {
+		return NewDemuxer(r)
+	}
+
+	h.WriterMuxer = func(w io.Writer) av.Muxer {
+		return NewMuxer(w)
+	}
+
+	h.Probe = func(b []byte) bool {
+		score, _ := probeScore(b)
+		return score > 0
+	}
+
+	h.ProbeScore = probeScore
+
+	h.CodecTypes = []av.CodecType{av.MP3}
+}
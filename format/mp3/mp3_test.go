@@ -0,0 +1,102 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/avutil"
+	"github.com/nareix/joy4/codec/mp3parser"
+)
+
+// MPEG1 Layer3 128kbps 44100Hz stereo, 417 bytes.
+func testFrame(i int) []byte {
+	b := make([]byte, 417)
+	copy(b, []byte{0xff, 0xfb, 0x90, 0x00})
+	b[100] = byte(i)
+	return b
+}
+
+// ID3v2.4 tag with 20 bytes of frames.
+var testID3 = append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}, make([]byte, 20)...)
+
+func TestMuxDemux(t *testing.T) {
+	codec, err := mp3parser.NewCodecDataFromFrame(testFrame(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err = muxer.WriteHeader([]av.CodecData{codec}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		pkt := av.Packet{Time: time.Duration(i) * time.Second * 1152 / 44100, Data: testFrame(i)}
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	// id3 tag skipped, and garbage before first frame
+	in := append(append(append([]byte{}, testID3...), 0, 0x12, 0xff), buf.Bytes()...)
+	demuxer := NewDemuxer(bytes.NewReader(in))
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, ok := streams[0].(av.AudioCodecData)
+	if len(streams) != 1 || !ok || audio.Type() != av.MP3 || audio.SampleRate() != 44100 || audio.ChannelLayout().Count() != 2 {
+		t.Fatalf("streams %v", streams)
+	}
+	for i := 0; ; i++ {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err == io.EOF {
+			if i != 10 {
+				t.Fatalf("got %d packets", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pkt.Data, testFrame(i)) {
+			t.Fatalf("packet#%d data differs", i)
+		}
+		if pkt.Time != time.Duration(i)*time.Second*1152/44100 {
+			t.Fatalf("packet#%d time=%v", i, pkt.Time)
+		}
+		if dur, _ := audio.PacketDuration(pkt.Data); dur != time.Second*1152/44100 {
+			t.Fatalf("packet#%d duration=%v", i, dur)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	frames := append(testFrame(0), testFrame(1)...)
+	// frame header at start, but no frame after its length
+	falsesync := append(testFrame(0), make([]byte, 100)...)
+
+	for _, c := range []struct {
+		name  string
+		b     []byte
+		score int
+	}{
+		{"id3", testID3, avutil.ProbeScoreDefault},
+		{"two frames", frames, avutil.ProbeScoreDefault},
+		{"one frame header", testFrame(0)[:100], avutil.ProbeScoreMin},
+		{"false sync", falsesync, 0},
+		{"adts", []byte{0xff, 0xf1, 0x50, 0x80, 0, 0, 0, 0}, 0},
+	} {
+		score, err := probeScore(c.b)
+		if score != c.score {
+			t.Fatalf("%s: score=%d err=%v", c.name, score, err)
+		}
+		if score == 0 && err == nil {
+			t.Fatalf("%s: rejected without reason", c.name)
+		}
+	}
+}
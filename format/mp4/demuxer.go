@@ -7,8 +7,13 @@ import (
 	"time"
 
 	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec"
 	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/ac3parser"
+	"github.com/nareix/joy4/codec/av1parser"
 	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/codec/h265parser"
+	"github.com/nareix/joy4/codec/opusparser"
 	"github.com/nareix/joy4/format/mp4/mp4io"
 )
 
@@ -85,23 +90,89 @@ func (self *Demuxer) probe() (err error) {
 			return
 		}
 
-		if avc1 := atrack.GetAVC1Conf(); avc1 != nil {
-			if stream.CodecData, err = h264parser.NewCodecDataFromAVCDecoderConfRecord(avc1.Data); err != nil {
-				return
-			}
-			self.streams = append(self.streams, stream)
-		} else if esds := atrack.GetElemStreamDesc(); esds != nil {
-			if stream.CodecData, err = aacparser.NewCodecDataFromMPEG4AudioConfigBytes(esds.DecConfig); err != nil {
-				return
-			}
-			self.streams = append(self.streams, stream)
+		if stream.CodecData, err = newCodecData(atrack); err != nil {
+			return
 		}
+		if stream.CodecData == nil {
+			continue
+		}
+		if err = stream.readSampleDescs(); err != nil {
+			return
+		}
+		self.streams = append(self.streams, stream)
 	}
 
 	self.movieAtom = moov
 	return
 }
 
+// Codec data from sample description found in atom, nil if codec not supported.
+func newCodecData(atom mp4io.Atom) (stream av.CodecData, err error) {
+	if avc1, _ := mp4io.FindChildren(atom, mp4io.AVCC).(*mp4io.AVC1Conf); avc1 != nil {
+		return h264parser.NewCodecDataFromAVCDecoderConfRecord(avc1.Data)
+	} else if hvc1, _ := mp4io.FindChildren(atom, mp4io.HVCC).(*mp4io.HVC1Conf); hvc1 != nil {
+		return h265parser.NewCodecDataFromHEVCDecoderConfRecord(hvc1.Data)
+	} else if av1c, _ := mp4io.FindChildren(atom, mp4io.AV1C).(*mp4io.AV1Conf); av1c != nil {
+		return av1parser.NewCodecDataFromAV1CodecConfRecord(av1c.Data)
+	} else if dops, _ := mp4io.FindChildren(atom, mp4io.DOPS).(*mp4io.OpusConf); dops != nil {
+		return opusparser.NewCodecDataFromDOps(dops.Data)
+	} else if dac3, _ := mp4io.FindChildren(atom, mp4io.DAC3).(*mp4io.AC3Conf); dac3 != nil {
+		return ac3parser.NewCodecDataFromDac3(dac3.Data)
+	} else if dec3, _ := mp4io.FindChildren(atom, mp4io.DEC3).(*mp4io.EC3Conf); dec3 != nil {
+		return ac3parser.NewCodecDataFromDec3(dec3.Data)
+	} else if tx3g, _ := mp4io.FindChildren(atom, mp4io.TX3G).(*mp4io.TX3GDesc); tx3g != nil {
+		stream = codec.NewTX3GCodecData(tx3g.Data)
+		return
+	} else if esds, _ := mp4io.FindChildren(atom, mp4io.ESDS).(*mp4io.ElemStreamDesc); esds != nil {
+		return aacparser.NewCodecDataFromMPEG4AudioConfigBytes(esds.DecConfig)
+	}
+	return
+}
+
+// Read all sample description entries if more than one is used,
+// packets of chunks using another entry carry its codec data.
+func (self *Stream) readSampleDescs() (err error) {
+	entries := self.sample.SampleToChunk.Entries
+	multi := false
+	for _, entry := range entries {
+		if entry.SampleDescId != entries[0].SampleDescId {
+			multi = true
+		}
+	}
+	if !multi {
+		return
+	}
+
+	offset, size := self.sample.SampleDesc.Pos()
+	b := make([]byte, size)
+	if err = self.demuxer.readat(int64(offset), b); err != nil {
+		return
+	}
+	var descs []mp4io.Atom
+	if descs, err = mp4io.ParseSampleDescEntries(b, offset); err != nil {
+		return
+	}
+	for _, desc := range descs {
+		var codec av.CodecData
+		if codec, err = newCodecData(desc); err != nil {
+			return
+		}
+		self.sampleDescs = append(self.sampleDescs, codec)
+	}
+	if codec := self.sampleDesc(entries[0].SampleDescId); codec != nil {
+		self.CodecData = codec
+	}
+	self.sampleDescId = entries[0].SampleDescId
+	return
+}
+
+func (self *Stream) sampleDesc(id uint32) av.CodecData {
+	if id >= 1 && int(id) <= len(self.sampleDescs) {
+		return self.sampleDescs[id-1]
+	}
+	return nil
+}
+
 func (self *Stream) setSampleIndex(index int) (err error) {
 	found := false
 	start := 0
@@ -309,11 +380,19 @@ func (self *Demuxer) ReadPacket() (pkt av.Packet, err error) {
 	var chosen *Stream
 	var chosenidx int
 	for i, stream := range self.streams {
+		// sparse streams like subtitles may end before others
+		if !stream.isSampleValid() {
+			continue
+		}
 		if chosen == nil || stream.tsToTime(stream.dts) < chosen.tsToTime(chosen.dts) {
 			chosen = stream
 			chosenidx = i
 		}
 	}
+	if chosen == nil {
+		err = io.EOF
+		return
+	}
 	if false {
 		fmt.Printf("ReadPacket: chosen index=%v time=%v\n", chosen.idx, chosen.tsToTime(chosen.dts))
 	}
@@ -389,6 +468,15 @@ func (self *Stream) readPacket() (pkt av.Packet, err error) {
 		pkt.CompositionTime = self.tsToTime(cts)
 	}
 
+	if len(self.sampleDescs) > 0 {
+		id := self.sample.SampleToChunk.Entries[self.chunkGroupIndex].SampleDescId
+		if codec := self.sampleDesc(id); codec != nil && id != self.sampleDescId {
+			self.sampleDescId = id
+			self.CodecData = codec
+			pkt.CodecData = codec
+		}
+	}
+
 	self.incSampleIndex()
 
 	return
@@ -1,24 +1,42 @@
 package mp4
 
 import (
+	"fmt"
 	"io"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/av/avutil"
 )
 
-var CodecTypes = []av.CodecType{av.H264, av.AAC}
+var CodecTypes = []av.CodecType{av.H264, av.H265, av.AV1, av.AAC, av.OPUS, av.AC3, av.EAC3, av.TX3G}
+
+// ftyp should be the first box, others are seen in files from older muxers.
+func probeScore(b []byte) (score int, err error) {
+	if len(b) < 8 {
+		err = fmt.Errorf("mp4: box header incomplete")
+		return
+	}
+	switch string(b[4:8]) {
+	case "ftyp":
+		score = avutil.ProbeScoreMax
+	case "moov","free","mdat","moof":
+		score = avutil.ProbeScoreDefault
+	default:
+		err = fmt.Errorf("mp4: first box type=%q unknown", b[4:8])
+	}
+	return
+}
 
 func Handler(h *avutil.RegisterHandler) {
 	h.Ext = ".mp4"
 
 	h.Probe = func(b []byte) bool {
-		switch string(b[4:8]) {
-		case "moov","ftyp","free","mdat","moof":
-			return true
-		}
-		return false
+		score, _ := probeScore(b)
+		return score > 0
 	}
 
+	h.ProbeScore = probeScore
+	h.NeedSeek = true
+
 	h.ReaderDemuxer = func(r io.Reader) av.Demuxer {
 		return NewDemuxer(r.(io.ReadSeeker))
 	}
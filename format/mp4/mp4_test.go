@@ -0,0 +1,91 @@
+package mp4
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec/h264parser"
+)
+
+func testCodecData(t *testing.T, sps string) h264parser.CodecData {
+	b, _ := hex.DecodeString(sps)
+	pps, _ := hex.DecodeString("68ebecb22c")
+	codec, err := h264parser.NewCodecDataFromSPSAndPPS(b, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codec
+}
+
+// New stsd entry is written for changed codec data and read back as
+// Packet.CodecData of the first sample using it.
+func TestCodecDataChange(t *testing.T) {
+	video := testCodecData(t, "67640028acd940780227e5c05a808080a0000003002000000781e3062cb0")
+	changed := testCodecData(t, "6764001facd9405005bb011000000300100000030320f18319a0")
+
+	f, err := ioutil.TempFile("", "mp4_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	muxer := NewMuxer(f)
+	if err = muxer.WriteHeader([]av.CodecData{video}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		pkt := av.Packet{Idx: 0, Time: time.Duration(i) * time.Second / 25, Data: []byte{0, 0, 0, 2, 0x41, 0x9a}}
+		if i%25 == 0 {
+			pkt.IsKeyFrame = true
+			pkt.Data = []byte{0, 0, 0, 2, 0x65, 0x88}
+		}
+		if i == 25 {
+			pkt.CodecData = changed
+		}
+		if err = muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	demuxer := NewDemuxer(f)
+	streams, err := demuxer.Streams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codec := streams[0].(h264parser.CodecData); codec.Width() != 1920 {
+		t.Fatalf("stream width=%d", codec.Width())
+	}
+	for i := 0; ; i++ {
+		var pkt av.Packet
+		if pkt, err = demuxer.ReadPacket(); err == io.EOF {
+			if i != 50 {
+				t.Fatalf("got %d packets", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if i != 25 {
+			if pkt.CodecData != nil {
+				t.Fatalf("packet#%d codec data changed", i)
+			}
+			continue
+		}
+		codec, ok := pkt.CodecData.(h264parser.CodecData)
+		if !ok || codec.Width() != 1280 || codec.Height() != 720 {
+			t.Fatalf("packet#%d codec data %v", i, pkt.CodecData)
+		}
+	}
+}
@@ -201,6 +201,84 @@ func (self SoundMediaInfo) Tag() Tag {
 	return SMHD
 }
 
+const HVCC = Tag(0x68766343)
+
+func (self HVC1Conf) Tag() Tag {
+	return HVCC
+}
+
+const HVC1 = Tag(0x68766331)
+
+func (self HVC1Desc) Tag() Tag {
+	return HVC1
+}
+
+const HEV1 = Tag(0x68657631)
+
+func (self HEV1Desc) Tag() Tag {
+	return HEV1
+}
+
+const DOPS = Tag(0x644f7073)
+
+func (self OpusConf) Tag() Tag {
+	return DOPS
+}
+
+const OPUS = Tag(0x4f707573)
+
+func (self OpusDesc) Tag() Tag {
+	return OPUS
+}
+
+const AV1C = Tag(0x61763143)
+
+func (self AV1Conf) Tag() Tag {
+	return AV1C
+}
+
+const AV01 = Tag(0x61763031)
+
+func (self AV1Desc) Tag() Tag {
+	return AV01
+}
+
+const DEC3 = Tag(0x64656333)
+
+func (self EC3Conf) Tag() Tag {
+	return DEC3
+}
+
+const AC_3 = Tag(0x61632d33)
+
+func (self AC3Desc) Tag() Tag {
+	return AC_3
+}
+
+const EC_3 = Tag(0x65632d33)
+
+func (self EC3Desc) Tag() Tag {
+	return EC_3
+}
+
+const DAC3 = Tag(0x64616333)
+
+func (self AC3Conf) Tag() Tag {
+	return DAC3
+}
+
+const TX3G = Tag(0x74783367)
+
+func (self TX3GDesc) Tag() Tag {
+	return TX3G
+}
+
+const NMHD = Tag(0x6e6d6864)
+
+func (self NullMediaInfo) Tag() Tag {
+	return NMHD
+}
+
 const MDAT = Tag(0x6d646174)
 
 type Movie struct {
@@ -1050,6 +1128,7 @@ func (self MediaHeader) Children() (r []Atom) {
 type MediaInfo struct {
 	Sound		*SoundMediaInfo
 	Video		*VideoMediaInfo
+	Null		*NullMediaInfo
 	Data		*DataInfo
 	Sample		*SampleTable
 	Unknowns	[]Atom
@@ -1069,6 +1148,9 @@ func (self MediaInfo) marshal(b []byte) (n int) {
 	if self.Video != nil {
 		n += self.Video.Marshal(b[n:])
 	}
+	if self.Null != nil {
+		n += self.Null.Marshal(b[n:])
+	}
 	if self.Data != nil {
 		n += self.Data.Marshal(b[n:])
 	}
@@ -1088,6 +1170,9 @@ func (self MediaInfo) Len() (n int) {
 	if self.Video != nil {
 		n += self.Video.Len()
 	}
+	if self.Null != nil {
+		n += self.Null.Len()
+	}
 	if self.Data != nil {
 		n += self.Data.Len()
 	}
@@ -1128,6 +1213,15 @@ func (self *MediaInfo) Unmarshal(b []byte, offset int) (n int, err error) {
 				}
 				self.Video = atom
 			}
+		case NMHD:
+			{
+				atom := &NullMediaInfo{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("nmhd", n+offset, err)
+					return
+				}
+				self.Null = atom
+			}
 		case DINF:
 			{
 				atom := &DataInfo{}
@@ -1167,6 +1261,9 @@ func (self MediaInfo) Children() (r []Atom) {
 	if self.Video != nil {
 		r = append(r, self.Video)
 	}
+	if self.Null != nil {
+		r = append(r, self.Null)
+	}
 	if self.Data != nil {
 		r = append(r, self.Data)
 	}
@@ -1509,6 +1606,52 @@ func (self VideoMediaInfo) Children() (r []Atom) {
 	return
 }
 
+type NullMediaInfo struct {
+	Version	uint8
+	Flags	uint32
+	AtomPos
+}
+
+func (self NullMediaInfo) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(NMHD))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self NullMediaInfo) marshal(b []byte) (n int) {
+	pio.PutU8(b[n:], self.Version)
+	n += 1
+	pio.PutU24BE(b[n:], self.Flags)
+	n += 3
+	return
+}
+func (self NullMediaInfo) Len() (n int) {
+	n += 8
+	n += 1
+	n += 3
+	return
+}
+func (self *NullMediaInfo) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	if len(b) < n+1 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.U8(b[n:])
+	n += 1
+	if len(b) < n+3 {
+		err = parseErr("Flags", n+offset, err)
+		return
+	}
+	self.Flags = pio.U24BE(b[n:])
+	n += 3
+	return
+}
+func (self NullMediaInfo) Children() (r []Atom) {
+	return
+}
+
 type SampleTable struct {
 	SampleDesc		*SampleDesc
 	TimeToSample		*TimeToSample
@@ -1683,6 +1826,13 @@ type SampleDesc struct {
 	Version		uint8
 	AVC1Desc	*AVC1Desc
 	MP4ADesc	*MP4ADesc
+	HVC1Desc	*HVC1Desc
+	HEV1Desc	*HEV1Desc
+	OpusDesc	*OpusDesc
+	AV1Desc		*AV1Desc
+	AC3Desc		*AC3Desc
+	EC3Desc		*EC3Desc
+	TX3GDesc	*TX3GDesc
 	Unknowns	[]Atom
 	AtomPos
 }
@@ -1704,6 +1854,27 @@ func (self SampleDesc) marshal(b []byte) (n int) {
 	if self.MP4ADesc != nil {
 		_childrenNR++
 	}
+	if self.HVC1Desc != nil {
+		_childrenNR++
+	}
+	if self.HEV1Desc != nil {
+		_childrenNR++
+	}
+	if self.OpusDesc != nil {
+		_childrenNR++
+	}
+	if self.AV1Desc != nil {
+		_childrenNR++
+	}
+	if self.AC3Desc != nil {
+		_childrenNR++
+	}
+	if self.EC3Desc != nil {
+		_childrenNR++
+	}
+	if self.TX3GDesc != nil {
+		_childrenNR++
+	}
 	_childrenNR += len(self.Unknowns)
 	pio.PutI32BE(b[n:], int32(_childrenNR))
 	n += 4
@@ -1713,6 +1884,27 @@ func (self SampleDesc) marshal(b []byte) (n int) {
 	if self.MP4ADesc != nil {
 		n += self.MP4ADesc.Marshal(b[n:])
 	}
+	if self.HVC1Desc != nil {
+		n += self.HVC1Desc.Marshal(b[n:])
+	}
+	if self.HEV1Desc != nil {
+		n += self.HEV1Desc.Marshal(b[n:])
+	}
+	if self.OpusDesc != nil {
+		n += self.OpusDesc.Marshal(b[n:])
+	}
+	if self.AV1Desc != nil {
+		n += self.AV1Desc.Marshal(b[n:])
+	}
+	if self.AC3Desc != nil {
+		n += self.AC3Desc.Marshal(b[n:])
+	}
+	if self.EC3Desc != nil {
+		n += self.EC3Desc.Marshal(b[n:])
+	}
+	if self.TX3GDesc != nil {
+		n += self.TX3GDesc.Marshal(b[n:])
+	}
 	for _, atom := range self.Unknowns {
 		n += atom.Marshal(b[n:])
 	}
@@ -1729,6 +1921,27 @@ func (self SampleDesc) Len() (n int) {
 	if self.MP4ADesc != nil {
 		n += self.MP4ADesc.Len()
 	}
+	if self.HVC1Desc != nil {
+		n += self.HVC1Desc.Len()
+	}
+	if self.HEV1Desc != nil {
+		n += self.HEV1Desc.Len()
+	}
+	if self.OpusDesc != nil {
+		n += self.OpusDesc.Len()
+	}
+	if self.AV1Desc != nil {
+		n += self.AV1Desc.Len()
+	}
+	if self.AC3Desc != nil {
+		n += self.AC3Desc.Len()
+	}
+	if self.EC3Desc != nil {
+		n += self.EC3Desc.Len()
+	}
+	if self.TX3GDesc != nil {
+		n += self.TX3GDesc.Len()
+	}
 	for _, atom := range self.Unknowns {
 		n += atom.Len()
 	}
@@ -1771,6 +1984,69 @@ func (self *SampleDesc) Unmarshal(b []byte, offset int) (n int, err error) {
 				}
 				self.MP4ADesc = atom
 			}
+		case HVC1:
+			{
+				atom := &HVC1Desc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("hvc1", n+offset, err)
+					return
+				}
+				self.HVC1Desc = atom
+			}
+		case HEV1:
+			{
+				atom := &HEV1Desc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("hev1", n+offset, err)
+					return
+				}
+				self.HEV1Desc = atom
+			}
+		case OPUS:
+			{
+				atom := &OpusDesc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("Opus", n+offset, err)
+					return
+				}
+				self.OpusDesc = atom
+			}
+		case AV01:
+			{
+				atom := &AV1Desc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("av01", n+offset, err)
+					return
+				}
+				self.AV1Desc = atom
+			}
+		case AC_3:
+			{
+				atom := &AC3Desc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("ac-3", n+offset, err)
+					return
+				}
+				self.AC3Desc = atom
+			}
+		case EC_3:
+			{
+				atom := &EC3Desc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("ec-3", n+offset, err)
+					return
+				}
+				self.EC3Desc = atom
+			}
+		case TX3G:
+			{
+				atom := &TX3GDesc{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("tx3g", n+offset, err)
+					return
+				}
+				self.TX3GDesc = atom
+			}
 		default:
 			{
 				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
@@ -1792,6 +2068,27 @@ func (self SampleDesc) Children() (r []Atom) {
 	if self.MP4ADesc != nil {
 		r = append(r, self.MP4ADesc)
 	}
+	if self.HVC1Desc != nil {
+		r = append(r, self.HVC1Desc)
+	}
+	if self.HEV1Desc != nil {
+		r = append(r, self.HEV1Desc)
+	}
+	if self.OpusDesc != nil {
+		r = append(r, self.OpusDesc)
+	}
+	if self.AV1Desc != nil {
+		r = append(r, self.AV1Desc)
+	}
+	if self.AC3Desc != nil {
+		r = append(r, self.AC3Desc)
+	}
+	if self.EC3Desc != nil {
+		r = append(r, self.EC3Desc)
+	}
+	if self.TX3GDesc != nil {
+		r = append(r, self.TX3GDesc)
+	}
 	r = append(r, self.Unknowns...)
 	return
 }
@@ -1955,63 +2252,45 @@ func (self MP4ADesc) Children() (r []Atom) {
 	return
 }
 
-type AVC1Desc struct {
+type OpusDesc struct {
 	DataRefIdx		int16
 	Version			int16
-	Revision		int16
+	RevisionLevel		int16
 	Vendor			int32
-	TemporalQuality		int32
-	SpatialQuality		int32
-	Width			int16
-	Height			int16
-	HorizontalResolution	float64
-	VorizontalResolution	float64
-	FrameCount		int16
-	CompressorName		[32]byte
-	Depth			int16
-	ColorTableId		int16
-	Conf			*AVC1Conf
+	NumberOfChannels	int16
+	SampleSize		int16
+	CompressionId		int16
+	SampleRate		float64
+	Conf			*OpusConf
 	Unknowns		[]Atom
 	AtomPos
 }
 
-func (self AVC1Desc) Marshal(b []byte) (n int) {
-	pio.PutU32BE(b[4:], uint32(AVC1))
+func (self OpusDesc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(OPUS))
 	n += self.marshal(b[8:])+8
 	pio.PutU32BE(b[0:], uint32(n))
 	return
 }
-func (self AVC1Desc) marshal(b []byte) (n int) {
+func (self OpusDesc) marshal(b []byte) (n int) {
 	n += 6
 	pio.PutI16BE(b[n:], self.DataRefIdx)
 	n += 2
 	pio.PutI16BE(b[n:], self.Version)
 	n += 2
-	pio.PutI16BE(b[n:], self.Revision)
+	pio.PutI16BE(b[n:], self.RevisionLevel)
 	n += 2
 	pio.PutI32BE(b[n:], self.Vendor)
 	n += 4
-	pio.PutI32BE(b[n:], self.TemporalQuality)
-	n += 4
-	pio.PutI32BE(b[n:], self.SpatialQuality)
-	n += 4
-	pio.PutI16BE(b[n:], self.Width)
-	n += 2
-	pio.PutI16BE(b[n:], self.Height)
+	pio.PutI16BE(b[n:], self.NumberOfChannels)
 	n += 2
-	PutFixed32(b[n:], self.HorizontalResolution)
-	n += 4
-	PutFixed32(b[n:], self.VorizontalResolution)
-	n += 4
-	n += 4
-	pio.PutI16BE(b[n:], self.FrameCount)
+	pio.PutI16BE(b[n:], self.SampleSize)
 	n += 2
-	copy(b[n:], self.CompressorName[:])
-	n += len(self.CompressorName[:])
-	pio.PutI16BE(b[n:], self.Depth)
+	pio.PutI16BE(b[n:], self.CompressionId)
 	n += 2
-	pio.PutI16BE(b[n:], self.ColorTableId)
 	n += 2
+	PutFixed32(b[n:], self.SampleRate)
+	n += 4
 	if self.Conf != nil {
 		n += self.Conf.Marshal(b[n:])
 	}
@@ -2020,24 +2299,18 @@ func (self AVC1Desc) marshal(b []byte) (n int) {
 	}
 	return
 }
-func (self AVC1Desc) Len() (n int) {
+func (self OpusDesc) Len() (n int) {
 	n += 8
 	n += 6
 	n += 2
 	n += 2
 	n += 2
 	n += 4
-	n += 4
-	n += 4
 	n += 2
 	n += 2
-	n += 4
-	n += 4
-	n += 4
-	n += 2
-	n += len(self.CompressorName[:])
 	n += 2
 	n += 2
+	n += 4
 	if self.Conf != nil {
 		n += self.Conf.Len()
 	}
@@ -2046,7 +2319,7 @@ func (self AVC1Desc) Len() (n int) {
 	}
 	return
 }
-func (self *AVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+func (self *OpusDesc) Unmarshal(b []byte, offset int) (n int, err error) {
 	(&self.AtomPos).setPos(offset, len(b))
 	n += 8
 	n += 6
@@ -2063,10 +2336,10 @@ func (self *AVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
 	self.Version = pio.I16BE(b[n:])
 	n += 2
 	if len(b) < n+2 {
-		err = parseErr("Revision", n+offset, err)
+		err = parseErr("RevisionLevel", n+offset, err)
 		return
 	}
-	self.Revision = pio.I16BE(b[n:])
+	self.RevisionLevel = pio.I16BE(b[n:])
 	n += 2
 	if len(b) < n+4 {
 		err = parseErr("Vendor", n+offset, err)
@@ -2074,50 +2347,1162 @@ func (self *AVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
 	}
 	self.Vendor = pio.I32BE(b[n:])
 	n += 4
-	if len(b) < n+4 {
-		err = parseErr("TemporalQuality", n+offset, err)
-		return
-	}
-	self.TemporalQuality = pio.I32BE(b[n:])
-	n += 4
-	if len(b) < n+4 {
-		err = parseErr("SpatialQuality", n+offset, err)
-		return
-	}
-	self.SpatialQuality = pio.I32BE(b[n:])
-	n += 4
 	if len(b) < n+2 {
-		err = parseErr("Width", n+offset, err)
+		err = parseErr("NumberOfChannels", n+offset, err)
 		return
 	}
-	self.Width = pio.I16BE(b[n:])
+	self.NumberOfChannels = pio.I16BE(b[n:])
 	n += 2
 	if len(b) < n+2 {
-		err = parseErr("Height", n+offset, err)
+		err = parseErr("SampleSize", n+offset, err)
 		return
 	}
-	self.Height = pio.I16BE(b[n:])
+	self.SampleSize = pio.I16BE(b[n:])
 	n += 2
-	if len(b) < n+4 {
-		err = parseErr("HorizontalResolution", n+offset, err)
+	if len(b) < n+2 {
+		err = parseErr("CompressionId", n+offset, err)
 		return
 	}
-	self.HorizontalResolution = GetFixed32(b[n:])
-	n += 4
+	self.CompressionId = pio.I16BE(b[n:])
+	n += 2
+	n += 2
 	if len(b) < n+4 {
-		err = parseErr("VorizontalResolution", n+offset, err)
+		err = parseErr("SampleRate", n+offset, err)
 		return
 	}
-	self.VorizontalResolution = GetFixed32(b[n:])
-	n += 4
+	self.SampleRate = GetFixed32(b[n:])
 	n += 4
-	if len(b) < n+2 {
-		err = parseErr("FrameCount", n+offset, err)
-		return
-	}
-	self.FrameCount = pio.I16BE(b[n:])
-	n += 2
-	if len(b) < n+len(self.CompressorName) {
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case DOPS:
+			{
+				atom := &OpusConf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("dOps", n+offset, err)
+					return
+				}
+				self.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				self.Unknowns = append(self.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+func (self OpusDesc) Children() (r []Atom) {
+	if self.Conf != nil {
+		r = append(r, self.Conf)
+	}
+	r = append(r, self.Unknowns...)
+	return
+}
+
+type OpusConf struct {
+	Data	[]byte
+	AtomPos
+}
+
+func (self OpusConf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(DOPS))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self OpusConf) marshal(b []byte) (n int) {
+	copy(b[n:], self.Data[:])
+	n += len(self.Data[:])
+	return
+}
+func (self OpusConf) Len() (n int) {
+	n += 8
+	n += len(self.Data[:])
+	return
+}
+func (self *OpusConf) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	self.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+func (self OpusConf) Children() (r []Atom) {
+	return
+}
+
+type AC3Desc struct {
+	DataRefIdx		int16
+	Version			int16
+	RevisionLevel		int16
+	Vendor			int32
+	NumberOfChannels	int16
+	SampleSize		int16
+	CompressionId		int16
+	SampleRate		float64
+	Conf			*AC3Conf
+	Unknowns		[]Atom
+	AtomPos
+}
+
+func (self AC3Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(AC_3))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self AC3Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], self.Version)
+	n += 2
+	pio.PutI16BE(b[n:], self.RevisionLevel)
+	n += 2
+	pio.PutI32BE(b[n:], self.Vendor)
+	n += 4
+	pio.PutI16BE(b[n:], self.NumberOfChannels)
+	n += 2
+	pio.PutI16BE(b[n:], self.SampleSize)
+	n += 2
+	pio.PutI16BE(b[n:], self.CompressionId)
+	n += 2
+	n += 2
+	PutFixed32(b[n:], self.SampleRate)
+	n += 4
+	if self.Conf != nil {
+		n += self.Conf.Marshal(b[n:])
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+func (self AC3Desc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 2
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	if self.Conf != nil {
+		n += self.Conf.Len()
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+func (self *AC3Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("RevisionLevel", n+offset, err)
+		return
+	}
+	self.RevisionLevel = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	self.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("NumberOfChannels", n+offset, err)
+		return
+	}
+	self.NumberOfChannels = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("SampleSize", n+offset, err)
+		return
+	}
+	self.SampleSize = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("CompressionId", n+offset, err)
+		return
+	}
+	self.CompressionId = pio.I16BE(b[n:])
+	n += 2
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("SampleRate", n+offset, err)
+		return
+	}
+	self.SampleRate = GetFixed32(b[n:])
+	n += 4
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case DAC3:
+			{
+				atom := &AC3Conf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("dac3", n+offset, err)
+					return
+				}
+				self.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				self.Unknowns = append(self.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+func (self AC3Desc) Children() (r []Atom) {
+	if self.Conf != nil {
+		r = append(r, self.Conf)
+	}
+	r = append(r, self.Unknowns...)
+	return
+}
+
+type AC3Conf struct {
+	Data	[]byte
+	AtomPos
+}
+
+func (self AC3Conf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(DAC3))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self AC3Conf) marshal(b []byte) (n int) {
+	copy(b[n:], self.Data[:])
+	n += len(self.Data[:])
+	return
+}
+func (self AC3Conf) Len() (n int) {
+	n += 8
+	n += len(self.Data[:])
+	return
+}
+func (self *AC3Conf) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	self.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+func (self AC3Conf) Children() (r []Atom) {
+	return
+}
+
+type EC3Desc struct {
+	DataRefIdx		int16
+	Version			int16
+	RevisionLevel		int16
+	Vendor			int32
+	NumberOfChannels	int16
+	SampleSize		int16
+	CompressionId		int16
+	SampleRate		float64
+	Conf			*EC3Conf
+	Unknowns		[]Atom
+	AtomPos
+}
+
+func (self EC3Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(EC_3))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self EC3Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], self.Version)
+	n += 2
+	pio.PutI16BE(b[n:], self.RevisionLevel)
+	n += 2
+	pio.PutI32BE(b[n:], self.Vendor)
+	n += 4
+	pio.PutI16BE(b[n:], self.NumberOfChannels)
+	n += 2
+	pio.PutI16BE(b[n:], self.SampleSize)
+	n += 2
+	pio.PutI16BE(b[n:], self.CompressionId)
+	n += 2
+	n += 2
+	PutFixed32(b[n:], self.SampleRate)
+	n += 4
+	if self.Conf != nil {
+		n += self.Conf.Marshal(b[n:])
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+func (self EC3Desc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 2
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	if self.Conf != nil {
+		n += self.Conf.Len()
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+func (self *EC3Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("RevisionLevel", n+offset, err)
+		return
+	}
+	self.RevisionLevel = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	self.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("NumberOfChannels", n+offset, err)
+		return
+	}
+	self.NumberOfChannels = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("SampleSize", n+offset, err)
+		return
+	}
+	self.SampleSize = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("CompressionId", n+offset, err)
+		return
+	}
+	self.CompressionId = pio.I16BE(b[n:])
+	n += 2
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("SampleRate", n+offset, err)
+		return
+	}
+	self.SampleRate = GetFixed32(b[n:])
+	n += 4
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case DEC3:
+			{
+				atom := &EC3Conf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("dec3", n+offset, err)
+					return
+				}
+				self.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				self.Unknowns = append(self.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+func (self EC3Desc) Children() (r []Atom) {
+	if self.Conf != nil {
+		r = append(r, self.Conf)
+	}
+	r = append(r, self.Unknowns...)
+	return
+}
+
+type EC3Conf struct {
+	Data	[]byte
+	AtomPos
+}
+
+func (self EC3Conf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(DEC3))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self EC3Conf) marshal(b []byte) (n int) {
+	copy(b[n:], self.Data[:])
+	n += len(self.Data[:])
+	return
+}
+func (self EC3Conf) Len() (n int) {
+	n += 8
+	n += len(self.Data[:])
+	return
+}
+func (self *EC3Conf) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	self.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+func (self EC3Conf) Children() (r []Atom) {
+	return
+}
+
+type TX3GDesc struct {
+	DataRefIdx	int16
+	Data		[]byte
+	AtomPos
+}
+
+func (self TX3GDesc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(TX3G))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self TX3GDesc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	copy(b[n:], self.Data[:])
+	n += len(self.Data[:])
+	return
+}
+func (self TX3GDesc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += len(self.Data[:])
+	return
+}
+func (self *TX3GDesc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	self.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+func (self TX3GDesc) Children() (r []Atom) {
+	return
+}
+
+type AVC1Desc struct {
+	DataRefIdx		int16
+	Version			int16
+	Revision		int16
+	Vendor			int32
+	TemporalQuality		int32
+	SpatialQuality		int32
+	Width			int16
+	Height			int16
+	HorizontalResolution	float64
+	VorizontalResolution	float64
+	FrameCount		int16
+	CompressorName		[32]byte
+	Depth			int16
+	ColorTableId		int16
+	Conf			*AVC1Conf
+	Unknowns		[]Atom
+	AtomPos
+}
+
+func (self AVC1Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(AVC1))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self AVC1Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], self.Version)
+	n += 2
+	pio.PutI16BE(b[n:], self.Revision)
+	n += 2
+	pio.PutI32BE(b[n:], self.Vendor)
+	n += 4
+	pio.PutI32BE(b[n:], self.TemporalQuality)
+	n += 4
+	pio.PutI32BE(b[n:], self.SpatialQuality)
+	n += 4
+	pio.PutI16BE(b[n:], self.Width)
+	n += 2
+	pio.PutI16BE(b[n:], self.Height)
+	n += 2
+	PutFixed32(b[n:], self.HorizontalResolution)
+	n += 4
+	PutFixed32(b[n:], self.VorizontalResolution)
+	n += 4
+	n += 4
+	pio.PutI16BE(b[n:], self.FrameCount)
+	n += 2
+	copy(b[n:], self.CompressorName[:])
+	n += len(self.CompressorName[:])
+	pio.PutI16BE(b[n:], self.Depth)
+	n += 2
+	pio.PutI16BE(b[n:], self.ColorTableId)
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Marshal(b[n:])
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+func (self AVC1Desc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += len(self.CompressorName[:])
+	n += 2
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Len()
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+func (self *AVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Revision", n+offset, err)
+		return
+	}
+	self.Revision = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	self.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("TemporalQuality", n+offset, err)
+		return
+	}
+	self.TemporalQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("SpatialQuality", n+offset, err)
+		return
+	}
+	self.SpatialQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("Width", n+offset, err)
+		return
+	}
+	self.Width = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Height", n+offset, err)
+		return
+	}
+	self.Height = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("HorizontalResolution", n+offset, err)
+		return
+	}
+	self.HorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("VorizontalResolution", n+offset, err)
+		return
+	}
+	self.VorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("FrameCount", n+offset, err)
+		return
+	}
+	self.FrameCount = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+len(self.CompressorName) {
+		err = parseErr("CompressorName", n+offset, err)
+		return
+	}
+	copy(self.CompressorName[:], b[n:])
+	n += len(self.CompressorName)
+	if len(b) < n+2 {
+		err = parseErr("Depth", n+offset, err)
+		return
+	}
+	self.Depth = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("ColorTableId", n+offset, err)
+		return
+	}
+	self.ColorTableId = pio.I16BE(b[n:])
+	n += 2
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case AVCC:
+			{
+				atom := &AVC1Conf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("avcC", n+offset, err)
+					return
+				}
+				self.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				self.Unknowns = append(self.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+func (self AVC1Desc) Children() (r []Atom) {
+	if self.Conf != nil {
+		r = append(r, self.Conf)
+	}
+	r = append(r, self.Unknowns...)
+	return
+}
+
+type AVC1Conf struct {
+	Data	[]byte
+	AtomPos
+}
+
+func (self AVC1Conf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(AVCC))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self AVC1Conf) marshal(b []byte) (n int) {
+	copy(b[n:], self.Data[:])
+	n += len(self.Data[:])
+	return
+}
+func (self AVC1Conf) Len() (n int) {
+	n += 8
+	n += len(self.Data[:])
+	return
+}
+func (self *AVC1Conf) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	self.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+func (self AVC1Conf) Children() (r []Atom) {
+	return
+}
+
+type HVC1Desc struct {
+	DataRefIdx		int16
+	Version			int16
+	Revision		int16
+	Vendor			int32
+	TemporalQuality		int32
+	SpatialQuality		int32
+	Width			int16
+	Height			int16
+	HorizontalResolution	float64
+	VorizontalResolution	float64
+	FrameCount		int16
+	CompressorName		[32]byte
+	Depth			int16
+	ColorTableId		int16
+	Conf			*HVC1Conf
+	Unknowns		[]Atom
+	AtomPos
+}
+
+func (self HVC1Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(HVC1))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self HVC1Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], self.Version)
+	n += 2
+	pio.PutI16BE(b[n:], self.Revision)
+	n += 2
+	pio.PutI32BE(b[n:], self.Vendor)
+	n += 4
+	pio.PutI32BE(b[n:], self.TemporalQuality)
+	n += 4
+	pio.PutI32BE(b[n:], self.SpatialQuality)
+	n += 4
+	pio.PutI16BE(b[n:], self.Width)
+	n += 2
+	pio.PutI16BE(b[n:], self.Height)
+	n += 2
+	PutFixed32(b[n:], self.HorizontalResolution)
+	n += 4
+	PutFixed32(b[n:], self.VorizontalResolution)
+	n += 4
+	n += 4
+	pio.PutI16BE(b[n:], self.FrameCount)
+	n += 2
+	copy(b[n:], self.CompressorName[:])
+	n += len(self.CompressorName[:])
+	pio.PutI16BE(b[n:], self.Depth)
+	n += 2
+	pio.PutI16BE(b[n:], self.ColorTableId)
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Marshal(b[n:])
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+func (self HVC1Desc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += len(self.CompressorName[:])
+	n += 2
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Len()
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+func (self *HVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Revision", n+offset, err)
+		return
+	}
+	self.Revision = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	self.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("TemporalQuality", n+offset, err)
+		return
+	}
+	self.TemporalQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("SpatialQuality", n+offset, err)
+		return
+	}
+	self.SpatialQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("Width", n+offset, err)
+		return
+	}
+	self.Width = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Height", n+offset, err)
+		return
+	}
+	self.Height = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("HorizontalResolution", n+offset, err)
+		return
+	}
+	self.HorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("VorizontalResolution", n+offset, err)
+		return
+	}
+	self.VorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("FrameCount", n+offset, err)
+		return
+	}
+	self.FrameCount = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+len(self.CompressorName) {
+		err = parseErr("CompressorName", n+offset, err)
+		return
+	}
+	copy(self.CompressorName[:], b[n:])
+	n += len(self.CompressorName)
+	if len(b) < n+2 {
+		err = parseErr("Depth", n+offset, err)
+		return
+	}
+	self.Depth = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("ColorTableId", n+offset, err)
+		return
+	}
+	self.ColorTableId = pio.I16BE(b[n:])
+	n += 2
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case HVCC:
+			{
+				atom := &HVC1Conf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("hvcC", n+offset, err)
+					return
+				}
+				self.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				self.Unknowns = append(self.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+func (self HVC1Desc) Children() (r []Atom) {
+	if self.Conf != nil {
+		r = append(r, self.Conf)
+	}
+	r = append(r, self.Unknowns...)
+	return
+}
+
+type HEV1Desc struct {
+	DataRefIdx		int16
+	Version			int16
+	Revision		int16
+	Vendor			int32
+	TemporalQuality		int32
+	SpatialQuality		int32
+	Width			int16
+	Height			int16
+	HorizontalResolution	float64
+	VorizontalResolution	float64
+	FrameCount		int16
+	CompressorName		[32]byte
+	Depth			int16
+	ColorTableId		int16
+	Conf			*HVC1Conf
+	Unknowns		[]Atom
+	AtomPos
+}
+
+func (self HEV1Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(HEV1))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self HEV1Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], self.Version)
+	n += 2
+	pio.PutI16BE(b[n:], self.Revision)
+	n += 2
+	pio.PutI32BE(b[n:], self.Vendor)
+	n += 4
+	pio.PutI32BE(b[n:], self.TemporalQuality)
+	n += 4
+	pio.PutI32BE(b[n:], self.SpatialQuality)
+	n += 4
+	pio.PutI16BE(b[n:], self.Width)
+	n += 2
+	pio.PutI16BE(b[n:], self.Height)
+	n += 2
+	PutFixed32(b[n:], self.HorizontalResolution)
+	n += 4
+	PutFixed32(b[n:], self.VorizontalResolution)
+	n += 4
+	n += 4
+	pio.PutI16BE(b[n:], self.FrameCount)
+	n += 2
+	copy(b[n:], self.CompressorName[:])
+	n += len(self.CompressorName[:])
+	pio.PutI16BE(b[n:], self.Depth)
+	n += 2
+	pio.PutI16BE(b[n:], self.ColorTableId)
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Marshal(b[n:])
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+func (self HEV1Desc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += len(self.CompressorName[:])
+	n += 2
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Len()
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+func (self *HEV1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Revision", n+offset, err)
+		return
+	}
+	self.Revision = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	self.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("TemporalQuality", n+offset, err)
+		return
+	}
+	self.TemporalQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("SpatialQuality", n+offset, err)
+		return
+	}
+	self.SpatialQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("Width", n+offset, err)
+		return
+	}
+	self.Width = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Height", n+offset, err)
+		return
+	}
+	self.Height = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("HorizontalResolution", n+offset, err)
+		return
+	}
+	self.HorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("VorizontalResolution", n+offset, err)
+		return
+	}
+	self.VorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("FrameCount", n+offset, err)
+		return
+	}
+	self.FrameCount = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+len(self.CompressorName) {
 		err = parseErr("CompressorName", n+offset, err)
 		return
 	}
@@ -2143,11 +3528,11 @@ func (self *AVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
 			return
 		}
 		switch tag {
-		case AVCC:
+		case HVCC:
 			{
-				atom := &AVC1Conf{}
+				atom := &HVC1Conf{}
 				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
-					err = parseErr("avcC", n+offset, err)
+					err = parseErr("hvcC", n+offset, err)
 					return
 				}
 				self.Conf = atom
@@ -2166,7 +3551,7 @@ func (self *AVC1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
 	}
 	return
 }
-func (self AVC1Desc) Children() (r []Atom) {
+func (self HEV1Desc) Children() (r []Atom) {
 	if self.Conf != nil {
 		r = append(r, self.Conf)
 	}
@@ -2174,35 +3559,286 @@ func (self AVC1Desc) Children() (r []Atom) {
 	return
 }
 
-type AVC1Conf struct {
+type HVC1Conf struct {
 	Data	[]byte
 	AtomPos
 }
 
-func (self AVC1Conf) Marshal(b []byte) (n int) {
-	pio.PutU32BE(b[4:], uint32(AVCC))
+func (self HVC1Conf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(HVCC))
 	n += self.marshal(b[8:])+8
 	pio.PutU32BE(b[0:], uint32(n))
 	return
 }
-func (self AVC1Conf) marshal(b []byte) (n int) {
+func (self HVC1Conf) marshal(b []byte) (n int) {
 	copy(b[n:], self.Data[:])
 	n += len(self.Data[:])
 	return
 }
-func (self AVC1Conf) Len() (n int) {
+func (self HVC1Conf) Len() (n int) {
 	n += 8
 	n += len(self.Data[:])
 	return
 }
-func (self *AVC1Conf) Unmarshal(b []byte, offset int) (n int, err error) {
+func (self *HVC1Conf) Unmarshal(b []byte, offset int) (n int, err error) {
 	(&self.AtomPos).setPos(offset, len(b))
 	n += 8
 	self.Data = b[n:]
 	n += len(b[n:])
 	return
 }
-func (self AVC1Conf) Children() (r []Atom) {
+func (self HVC1Conf) Children() (r []Atom) {
+	return
+}
+
+type AV1Desc struct {
+	DataRefIdx		int16
+	Version			int16
+	Revision		int16
+	Vendor			int32
+	TemporalQuality		int32
+	SpatialQuality		int32
+	Width			int16
+	Height			int16
+	HorizontalResolution	float64
+	VorizontalResolution	float64
+	FrameCount		int16
+	CompressorName		[32]byte
+	Depth			int16
+	ColorTableId		int16
+	Conf			*AV1Conf
+	Unknowns		[]Atom
+	AtomPos
+}
+
+func (self AV1Desc) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(AV01))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self AV1Desc) marshal(b []byte) (n int) {
+	n += 6
+	pio.PutI16BE(b[n:], self.DataRefIdx)
+	n += 2
+	pio.PutI16BE(b[n:], self.Version)
+	n += 2
+	pio.PutI16BE(b[n:], self.Revision)
+	n += 2
+	pio.PutI32BE(b[n:], self.Vendor)
+	n += 4
+	pio.PutI32BE(b[n:], self.TemporalQuality)
+	n += 4
+	pio.PutI32BE(b[n:], self.SpatialQuality)
+	n += 4
+	pio.PutI16BE(b[n:], self.Width)
+	n += 2
+	pio.PutI16BE(b[n:], self.Height)
+	n += 2
+	PutFixed32(b[n:], self.HorizontalResolution)
+	n += 4
+	PutFixed32(b[n:], self.VorizontalResolution)
+	n += 4
+	n += 4
+	pio.PutI16BE(b[n:], self.FrameCount)
+	n += 2
+	copy(b[n:], self.CompressorName[:])
+	n += len(self.CompressorName[:])
+	pio.PutI16BE(b[n:], self.Depth)
+	n += 2
+	pio.PutI16BE(b[n:], self.ColorTableId)
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Marshal(b[n:])
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Marshal(b[n:])
+	}
+	return
+}
+func (self AV1Desc) Len() (n int) {
+	n += 8
+	n += 6
+	n += 2
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += 2
+	n += 4
+	n += 4
+	n += 4
+	n += 2
+	n += len(self.CompressorName[:])
+	n += 2
+	n += 2
+	if self.Conf != nil {
+		n += self.Conf.Len()
+	}
+	for _, atom := range self.Unknowns {
+		n += atom.Len()
+	}
+	return
+}
+func (self *AV1Desc) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	n += 6
+	if len(b) < n+2 {
+		err = parseErr("DataRefIdx", n+offset, err)
+		return
+	}
+	self.DataRefIdx = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Version", n+offset, err)
+		return
+	}
+	self.Version = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Revision", n+offset, err)
+		return
+	}
+	self.Revision = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("Vendor", n+offset, err)
+		return
+	}
+	self.Vendor = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("TemporalQuality", n+offset, err)
+		return
+	}
+	self.TemporalQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("SpatialQuality", n+offset, err)
+		return
+	}
+	self.SpatialQuality = pio.I32BE(b[n:])
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("Width", n+offset, err)
+		return
+	}
+	self.Width = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("Height", n+offset, err)
+		return
+	}
+	self.Height = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+4 {
+		err = parseErr("HorizontalResolution", n+offset, err)
+		return
+	}
+	self.HorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	if len(b) < n+4 {
+		err = parseErr("VorizontalResolution", n+offset, err)
+		return
+	}
+	self.VorizontalResolution = GetFixed32(b[n:])
+	n += 4
+	n += 4
+	if len(b) < n+2 {
+		err = parseErr("FrameCount", n+offset, err)
+		return
+	}
+	self.FrameCount = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+len(self.CompressorName) {
+		err = parseErr("CompressorName", n+offset, err)
+		return
+	}
+	copy(self.CompressorName[:], b[n:])
+	n += len(self.CompressorName)
+	if len(b) < n+2 {
+		err = parseErr("Depth", n+offset, err)
+		return
+	}
+	self.Depth = pio.I16BE(b[n:])
+	n += 2
+	if len(b) < n+2 {
+		err = parseErr("ColorTableId", n+offset, err)
+		return
+	}
+	self.ColorTableId = pio.I16BE(b[n:])
+	n += 2
+	for n+8 < len(b) {
+		tag := Tag(pio.U32BE(b[n+4:]))
+		size := int(pio.U32BE(b[n:]))
+		if len(b) < n+size {
+			err = parseErr("TagSizeInvalid", n+offset, err)
+			return
+		}
+		switch tag {
+		case AV1C:
+			{
+				atom := &AV1Conf{}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("av1C", n+offset, err)
+					return
+				}
+				self.Conf = atom
+			}
+		default:
+			{
+				atom := &Dummy{Tag_: tag, Data: b[n:n+size]}
+				if _, err = atom.Unmarshal(b[n:n+size], offset+n); err != nil {
+					err = parseErr("", n+offset, err)
+					return
+				}
+				self.Unknowns = append(self.Unknowns, atom)
+			}
+		}
+		n += size
+	}
+	return
+}
+func (self AV1Desc) Children() (r []Atom) {
+	if self.Conf != nil {
+		r = append(r, self.Conf)
+	}
+	r = append(r, self.Unknowns...)
+	return
+}
+
+type AV1Conf struct {
+	Data	[]byte
+	AtomPos
+}
+
+func (self AV1Conf) Marshal(b []byte) (n int) {
+	pio.PutU32BE(b[4:], uint32(AV1C))
+	n += self.marshal(b[8:])+8
+	pio.PutU32BE(b[0:], uint32(n))
+	return
+}
+func (self AV1Conf) marshal(b []byte) (n int) {
+	copy(b[n:], self.Data[:])
+	n += len(self.Data[:])
+	return
+}
+func (self AV1Conf) Len() (n int) {
+	n += 8
+	n += len(self.Data[:])
+	return
+}
+func (self *AV1Conf) Unmarshal(b []byte, offset int) (n int, err error) {
+	(&self.AtomPos).setPos(offset, len(b))
+	n += 8
+	self.Data = b[n:]
+	n += len(b[n:])
+	return
+}
+func (self AV1Conf) Children() (r []Atom) {
 	return
 }
 
@@ -361,13 +361,24 @@ func getstructputgetlenfn(origfn *ast.FuncDecl, origname string) (decls []ast.De
 	return
 }
 
+// tags which are not valid in function names, eg. ac_3_AC3Desc => "ac-3"
+var escapedtags = map[string]string{
+	"ac_3": "ac-3",
+	"ec_3": "ec-3",
+}
+
+// "ac-3" => AC_3
+func tagconst(tag string) string {
+	return strings.ToUpper(strings.Replace(tag, "-", "_", -1))
+}
+
 func cc4decls(name string) (decls []ast.Decl) {
 	constdecl := &ast.GenDecl{
 		Tok: token.CONST,
 		Specs: []ast.Spec{
 			&ast.ValueSpec{
 				Names: []*ast.Ident{
-					ast.NewIdent(strings.ToUpper(name)),
+					ast.NewIdent(tagconst(name)),
 				},
 				Values: []ast.Expr{
 					&ast.CallExpr{
@@ -606,7 +617,7 @@ func getatommarshalfn(origfn *ast.FuncDecl,
 
 		for i, atom := range atomnames {
 			cases = append(cases, &ast.CaseClause{
-				List: []ast.Expr{ast.NewIdent(strings.ToUpper(struct2tag(atomtypes[i])))},
+				List: []ast.Expr{ast.NewIdent(tagconst(struct2tag(atomtypes[i])))},
 				Body: []ast.Stmt{&ast.BlockStmt{
 					List: append(unmarshalatom(atomtypes[i], ""), simpleassign(token.ASSIGN, "self."+atom, "atom")),
 				}},
@@ -616,7 +627,7 @@ func getatommarshalfn(origfn *ast.FuncDecl,
 		for i, atom := range atomarrnames {
 			selfatom := "self."+atom
 			cases = append(cases, &ast.CaseClause{
-				List: []ast.Expr{ast.NewIdent(strings.ToUpper(struct2tag(atomarrtypes[i])))},
+				List: []ast.Expr{ast.NewIdent(tagconst(struct2tag(atomarrtypes[i])))},
 				Body: []ast.Stmt{&ast.BlockStmt{
 					List: append(unmarshalatom(atomarrtypes[i], ""),
 						simpleassign(token.ASSIGN, selfatom, "append("+selfatom+", atom)")),
@@ -649,7 +660,7 @@ func getatommarshalfn(origfn *ast.FuncDecl,
 	}
 
 	marshalwrapstmts := func() (stmts []ast.Stmt) {
-		stmts = append(stmts, putxx("uint32", "4", strings.ToUpper(origtag), true)...)
+		stmts = append(stmts, putxx("uint32", "4", tagconst(origtag), true)...)
 		stmts = append(stmts, addns("self.marshal(b[8:])+8")...)
 		stmts = append(stmts, putxx("uint32", "0", "n", true)...)
 		stmts = append(stmts, &ast.ReturnStmt{})
@@ -984,7 +995,11 @@ func genatoms(filename, outfilename string) {
 	splittagname := func(fnname string) (ok bool, tag, name string) {
 		if len(fnname) > 5 && fnname[4] == '_' {
 			tag = fnname[0:4]
-			tag = strings.Replace(tag, "_", " ", 1)
+			if escaped, ok := escapedtags[tag]; ok {
+				tag = escaped
+			} else {
+				tag = strings.Replace(tag, "_", " ", 1)
+			}
 			name = fnname[5:]
 			ok = true
 		} else {
@@ -1007,7 +1022,7 @@ func genatoms(filename, outfilename string) {
 			&ast.Field{Type: ast.NewIdent("Tag")},
 		}, []ast.Stmt{
 			&ast.ReturnStmt{
-				Results: []ast.Expr{ast.NewIdent(strings.ToUpper(tag))}}})
+				Results: []ast.Expr{ast.NewIdent(tagconst(tag))}}})
 	}
 
 	for k, v := range tagnamemap {
@@ -80,6 +80,7 @@ func mdhd_MediaHeader() {
 func minf_MediaInfo() {
 	atom(Sound, SoundMediaInfo)
 	atom(Video, VideoMediaInfo)
+	atom(Null, NullMediaInfo)
 	atom(Data, DataInfo)
 	atom(Sample, SampleTable)
 	_unknowns()
@@ -116,6 +117,11 @@ func vmhd_VideoMediaInfo() {
 	array(Opcolor, int16, 3)
 }
 
+func nmhd_NullMediaInfo() {
+	uint8(Version)
+	uint24(Flags)
+}
+
 func stbl_SampleTable() {
 	atom(SampleDesc, SampleDesc)
 	atom(TimeToSample, TimeToSample)
@@ -132,6 +138,13 @@ func stsd_SampleDesc() {
 	int32(_childrenNR)
 	atom(AVC1Desc, AVC1Desc)
 	atom(MP4ADesc, MP4ADesc)
+	atom(HVC1Desc, HVC1Desc)
+	atom(HEV1Desc, HEV1Desc)
+	atom(OpusDesc, OpusDesc)
+	atom(AV1Desc, AV1Desc)
+	atom(AC3Desc, AC3Desc)
+	atom(EC3Desc, EC3Desc)
+	atom(TX3GDesc, TX3GDesc)
 	_unknowns()
 }
 
@@ -150,6 +163,69 @@ func mp4a_MP4ADesc() {
 	_unknowns()
 }
 
+func Opus_OpusDesc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(RevisionLevel)
+	int32(Vendor)
+	int16(NumberOfChannels)
+	int16(SampleSize)
+	int16(CompressionId)
+	_skip(2)
+	fixed32(SampleRate)
+	atom(Conf, OpusConf)
+	_unknowns()
+}
+
+func dOps_OpusConf() {
+	bytesleft(Data)
+}
+
+func ac_3_AC3Desc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(RevisionLevel)
+	int32(Vendor)
+	int16(NumberOfChannels)
+	int16(SampleSize)
+	int16(CompressionId)
+	_skip(2)
+	fixed32(SampleRate)
+	atom(Conf, AC3Conf)
+	_unknowns()
+}
+
+func dac3_AC3Conf() {
+	bytesleft(Data)
+}
+
+func ec_3_EC3Desc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(RevisionLevel)
+	int32(Vendor)
+	int16(NumberOfChannels)
+	int16(SampleSize)
+	int16(CompressionId)
+	_skip(2)
+	fixed32(SampleRate)
+	atom(Conf, EC3Conf)
+	_unknowns()
+}
+
+func dec3_EC3Conf() {
+	bytesleft(Data)
+}
+
+func tx3g_TX3GDesc() {
+	_skip(6)
+	int16(DataRefIdx)
+	bytesleft(Data)
+}
+
 func avc1_AVC1Desc() {
 	_skip(6)
 	int16(DataRefIdx)
@@ -175,6 +251,77 @@ func avcC_AVC1Conf() {
 	bytesleft(Data)
 }
 
+func hvc1_HVC1Desc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(Revision)
+	int32(Vendor)
+	int32(TemporalQuality)
+	int32(SpatialQuality)
+	int16(Width)
+	int16(Height)
+	fixed32(HorizontalResolution)
+	fixed32(VorizontalResolution)
+	_skip(4)
+	int16(FrameCount)
+	bytes(CompressorName, 32)
+	int16(Depth)
+	int16(ColorTableId)
+	atom(Conf, HVC1Conf)
+	_unknowns()
+}
+
+func hev1_HEV1Desc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(Revision)
+	int32(Vendor)
+	int32(TemporalQuality)
+	int32(SpatialQuality)
+	int16(Width)
+	int16(Height)
+	fixed32(HorizontalResolution)
+	fixed32(VorizontalResolution)
+	_skip(4)
+	int16(FrameCount)
+	bytes(CompressorName, 32)
+	int16(Depth)
+	int16(ColorTableId)
+	atom(Conf, HVC1Conf)
+	_unknowns()
+}
+
+func hvcC_HVC1Conf() {
+	bytesleft(Data)
+}
+
+func av01_AV1Desc() {
+	_skip(6)
+	int16(DataRefIdx)
+	int16(Version)
+	int16(Revision)
+	int32(Vendor)
+	int32(TemporalQuality)
+	int32(SpatialQuality)
+	int16(Width)
+	int16(Height)
+	fixed32(HorizontalResolution)
+	fixed32(VorizontalResolution)
+	_skip(4)
+	int16(FrameCount)
+	bytes(CompressorName, 32)
+	int16(Depth)
+	int16(ColorTableId)
+	atom(Conf, AV1Conf)
+	_unknowns()
+}
+
+func av1C_AV1Conf() {
+	bytesleft(Data)
+}
+
 func stts_TimeToSample() {
 	uint8(Version)
 	uint24(Flags)
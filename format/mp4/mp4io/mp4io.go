@@ -495,9 +495,74 @@ func (self *Track) GetAVC1Conf() (conf *AVC1Conf) {
 	return
 }
 
+func (self *Track) GetHVC1Conf() (conf *HVC1Conf) {
+	atom := FindChildren(self, HVCC)
+	conf, _ = atom.(*HVC1Conf)
+	return
+}
+
+func (self *Track) GetAV1Conf() (conf *AV1Conf) {
+	atom := FindChildren(self, AV1C)
+	conf, _ = atom.(*AV1Conf)
+	return
+}
+
+func (self *Track) GetOpusConf() (conf *OpusConf) {
+	atom := FindChildren(self, DOPS)
+	conf, _ = atom.(*OpusConf)
+	return
+}
+
+func (self *Track) GetAC3Conf() (conf *AC3Conf) {
+	atom := FindChildren(self, DAC3)
+	conf, _ = atom.(*AC3Conf)
+	return
+}
+
+func (self *Track) GetEC3Conf() (conf *EC3Conf) {
+	atom := FindChildren(self, DEC3)
+	conf, _ = atom.(*EC3Conf)
+	return
+}
+
+func (self *Track) GetTX3GDesc() (desc *TX3GDesc) {
+	atom := FindChildren(self, TX3G)
+	desc, _ = atom.(*TX3GDesc)
+	return
+}
+
 func (self *Track) GetElemStreamDesc() (esds *ElemStreamDesc) {
 	atom := FindChildren(self, ESDS)
 	esds, _ = atom.(*ElemStreamDesc)
 	return
 }
 
+// Sample description entries in order from raw 'stsd' atom b, since
+// SampleDesc keeps only the last entry of each type.
+func ParseSampleDescEntries(b []byte, offset int) (entries []Atom, err error) {
+	const hdrlen = 16 // size(32) tag(32) version(8) flags(24) count(32)
+	if len(b) < hdrlen {
+		err = parseErr("stsd", offset, err)
+		return
+	}
+	for n := hdrlen; n+8 <= len(b); {
+		size := int(pio.U32BE(b[n:]))
+		if size < 8 || n+size > len(b) {
+			err = parseErr("TagSizeInvalid", offset+n, err)
+			return
+		}
+		one := make([]byte, hdrlen+size)
+		copy(one, b[:hdrlen])
+		pio.PutU32BE(one[0:], uint32(len(one)))
+		pio.PutU32BE(one[12:], 1)
+		copy(one[hdrlen:], b[n:n+size])
+		desc := &SampleDesc{}
+		if _, err = desc.Unmarshal(one, offset+n-hdrlen); err != nil {
+			return
+		}
+		entries = append(entries, desc.Children()...)
+		n += size
+	}
+	return
+}
+
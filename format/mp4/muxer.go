@@ -5,7 +5,11 @@ import (
 	"time"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/ac3parser"
+	"github.com/nareix/joy4/codec/av1parser"
 	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/codec/h265parser"
+	"github.com/nareix/joy4/codec/opusparser"
 	"github.com/nareix/joy4/format/mp4/mp4io"
 	"github.com/nareix/joy4/utils/bits/pio"
 	"io"
@@ -17,6 +21,7 @@ type Muxer struct {
 	bufw       *bufio.Writer
 	wpos       int64
 	streams    []*Stream
+	pktstreams []*Stream // by packet Idx, nil for streams not carried
 }
 
 func NewMuxer(w io.WriteSeeker) *Muxer {
@@ -28,7 +33,7 @@ func NewMuxer(w io.WriteSeeker) *Muxer {
 
 func (self *Muxer) newStream(codec av.CodecData) (err error) {
 	switch codec.Type() {
-	case av.H264, av.AAC:
+	case av.H264, av.H265, av.AV1, av.AAC, av.OPUS, av.AC3, av.EAC3, av.TX3G:
 
 	default:
 		err = fmt.Errorf("mp4: codec type=%v is not supported", codec.Type())
@@ -79,48 +84,87 @@ func (self *Muxer) newStream(codec av.CodecData) (err error) {
 	}
 
 	switch codec.Type() {
-	case av.H264:
+	case av.H264, av.H265, av.AV1:
 		stream.sample.SyncSample = &mp4io.SyncSample{}
 	}
 
 	stream.timeScale = 90000
+	stream.idx = len(self.streams)
 	stream.muxer = self
 	self.streams = append(self.streams, stream)
 
 	return
 }
 
-func (self *Stream) fillTrackAtom() (err error) {
-	self.trackAtom.Media.Header.TimeScale = int32(self.timeScale)
-	self.trackAtom.Media.Header.Duration = int32(self.duration)
+/*
+tx3g sample description used when codec data has none (3GPP TS 26.245 section 5.16)
+
+	displayFlags(32)=0
+	horizontal-justification(8)=1 centered
+	vertical-justification(8)=-1 bottom
+	background-color-rgba(32)=0
+	BoxRecord(64)=0
+	StyleRecord: startChar(16)=0 endChar(16)=0 font-ID(16)=1 face-style-flags(8)=0 font-size(8)=18 text-color-rgba(32)=white
+	FontTableBox: ftab entry-count(16)=1 font-ID(16)=1 font-name-length(8)=5 "Serif"
+*/
+var defaultTX3GDesc = []byte{
+	0, 0, 0, 0,
+	0x01, 0xff,
+	0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 1, 0, 18, 0xff, 0xff, 0xff, 0xff,
+	0, 0, 0, 18, 'f', 't', 'a', 'b', 0, 1, 0, 1, 5, 'S', 'e', 'r', 'i', 'f',
+}
 
-	if self.Type() == av.H264 {
-		codec := self.CodecData.(h264parser.CodecData)
-		width, height := codec.Width(), codec.Height()
-		self.sample.SampleDesc.AVC1Desc = &mp4io.AVC1Desc{
+// Fill sample description entry of codec, used for the first one and for
+// entries added by codec data change.
+func fillSampleDesc(desc *mp4io.SampleDesc, codec av.CodecData) (err error) {
+	switch codec.Type() {
+	case av.H264:
+		codec := codec.(h264parser.CodecData)
+		desc.AVC1Desc = &mp4io.AVC1Desc{
 			DataRefIdx:           1,
 			HorizontalResolution: 72,
 			VorizontalResolution: 72,
-			Width:                int16(width),
-			Height:               int16(height),
+			Width:                int16(codec.Width()),
+			Height:               int16(codec.Height()),
 			FrameCount:           1,
 			Depth:                24,
 			ColorTableId:         -1,
 			Conf:                 &mp4io.AVC1Conf{Data: codec.AVCDecoderConfRecordBytes()},
 		}
-		self.trackAtom.Media.Handler = &mp4io.HandlerRefer{
-			SubType: [4]byte{'v','i','d','e'},
-			Name:    []byte("Video Media Handler"),
+
+	case av.H265:
+		codec := codec.(h265parser.CodecData)
+		desc.HVC1Desc = &mp4io.HVC1Desc{
+			DataRefIdx:           1,
+			HorizontalResolution: 72,
+			VorizontalResolution: 72,
+			Width:                int16(codec.Width()),
+			Height:               int16(codec.Height()),
+			FrameCount:           1,
+			Depth:                24,
+			ColorTableId:         -1,
+			Conf:                 &mp4io.HVC1Conf{Data: codec.HEVCDecoderConfRecordBytes()},
 		}
-		self.trackAtom.Media.Info.Video = &mp4io.VideoMediaInfo{
-			Flags: 0x000001,
+
+	case av.AV1:
+		codec := codec.(av1parser.CodecData)
+		desc.AV1Desc = &mp4io.AV1Desc{
+			DataRefIdx:           1,
+			HorizontalResolution: 72,
+			VorizontalResolution: 72,
+			Width:                int16(codec.Width()),
+			Height:               int16(codec.Height()),
+			FrameCount:           1,
+			Depth:                24,
+			ColorTableId:         -1,
+			Conf:                 &mp4io.AV1Conf{Data: codec.AV1CodecConfRecordBytes()},
 		}
-		self.trackAtom.Header.TrackWidth = float64(width)
-		self.trackAtom.Header.TrackHeight = float64(height)
 
-	} else if self.Type() == av.AAC {
-		codec := self.CodecData.(aacparser.CodecData)
-		self.sample.SampleDesc.MP4ADesc = &mp4io.MP4ADesc{
+	case av.AAC:
+		codec := codec.(aacparser.CodecData)
+		desc.MP4ADesc = &mp4io.MP4ADesc{
 			DataRefIdx:       1,
 			NumberOfChannels: int16(codec.ChannelLayout().Count()),
 			SampleSize:       int16(codec.SampleFormat().BytesPerSample()),
@@ -129,6 +173,89 @@ func (self *Stream) fillTrackAtom() (err error) {
 				DecConfig: codec.MPEG4AudioConfigBytes(),
 			},
 		}
+
+	case av.OPUS:
+		codec := codec.(opusparser.CodecData)
+		desc.OpusDesc = &mp4io.OpusDesc{
+			DataRefIdx:       1,
+			NumberOfChannels: int16(codec.Header.ChannelCount),
+			SampleSize:       16,
+			SampleRate:       float64(codec.SampleRate()),
+			Conf: &mp4io.OpusConf{
+				Data: codec.DOpsBytes(),
+			},
+		}
+
+	case av.AC3:
+		codec := codec.(ac3parser.CodecData)
+		desc.AC3Desc = &mp4io.AC3Desc{
+			DataRefIdx:       1,
+			NumberOfChannels: int16(codec.Header.ChannelCount()),
+			SampleSize:       16,
+			SampleRate:       float64(codec.SampleRate()),
+			Conf: &mp4io.AC3Conf{
+				Data: codec.Dac3Bytes(),
+			},
+		}
+
+	case av.EAC3:
+		codec := codec.(ac3parser.CodecData)
+		desc.EC3Desc = &mp4io.EC3Desc{
+			DataRefIdx:       1,
+			NumberOfChannels: int16(codec.Header.ChannelCount()),
+			SampleSize:       16,
+			SampleRate:       float64(codec.SampleRate()),
+			Conf: &mp4io.EC3Conf{
+				Data: codec.Dec3Bytes(),
+			},
+		}
+
+	case av.TX3G:
+		data := codec.(av.DataCodecData).Extradata()
+		if len(data) == 0 {
+			data = defaultTX3GDesc
+		}
+		desc.TX3GDesc = &mp4io.TX3GDesc{
+			DataRefIdx: 1,
+			Data:       data,
+		}
+
+	default:
+		err = fmt.Errorf("mp4: codec type=%d invalid", codec.Type())
+	}
+	return
+}
+
+func (self *Stream) fillTrackAtom() (err error) {
+	self.trackAtom.Media.Header.TimeScale = int32(self.timeScale)
+	self.trackAtom.Media.Header.Duration = int32(self.duration)
+
+	if err = fillSampleDesc(self.sample.SampleDesc, self.CodecData); err != nil {
+		return
+	}
+	// entries after the first one are kept in order as unknowns
+	for _, codec := range self.changedCodecData {
+		desc := &mp4io.SampleDesc{}
+		if err = fillSampleDesc(desc, codec); err != nil {
+			return
+		}
+		self.sample.SampleDesc.Unknowns = append(self.sample.SampleDesc.Unknowns, desc.Children()...)
+	}
+
+	switch {
+	case self.Type().IsVideo():
+		codec := self.CodecData.(av.VideoCodecData)
+		self.trackAtom.Media.Handler = &mp4io.HandlerRefer{
+			SubType: [4]byte{'v','i','d','e'},
+			Name:    []byte("Video Media Handler"),
+		}
+		self.trackAtom.Media.Info.Video = &mp4io.VideoMediaInfo{
+			Flags: 0x000001,
+		}
+		self.trackAtom.Header.TrackWidth = float64(codec.Width())
+		self.trackAtom.Header.TrackHeight = float64(codec.Height())
+
+	case self.Type().IsAudio():
 		self.trackAtom.Header.Volume = 1
 		self.trackAtom.Header.AlternateGroup = 1
 		self.trackAtom.Media.Handler = &mp4io.HandlerRefer{
@@ -137,19 +264,49 @@ func (self *Stream) fillTrackAtom() (err error) {
 		}
 		self.trackAtom.Media.Info.Sound = &mp4io.SoundMediaInfo{}
 
-	} else {
-		err = fmt.Errorf("mp4: codec type=%d invalid", self.Type())
+	case self.Type() == av.TX3G:
+		self.trackAtom.Media.Handler = &mp4io.HandlerRefer{
+			SubType: [4]byte{'t','e','x','t'},
+			Name:    []byte("Text Handler"),
+		}
+		self.trackAtom.Media.Info.Null = &mp4io.NullMediaInfo{}
 	}
 
 	return
 }
 
+// Codec data change adds a sample description entry used from next chunk on.
+func (self *Stream) changeCodecData(codec av.CodecData) (err error) {
+	if codec.Type().IsVideo() != self.Type().IsVideo() || codec.Type().IsAudio() != self.Type().IsAudio() {
+		err = fmt.Errorf("mp4: stream#%d codec type change to %v not supported", self.idx, codec.Type())
+		return
+	}
+	if self.sampleIndex == 0 {
+		self.CodecData = codec
+		return
+	}
+	self.changedCodecData = append(self.changedCodecData, codec)
+	table := self.sample.SampleToChunk
+	table.Entries = append(table.Entries, mp4io.SampleToChunkEntry{
+		FirstChunk:      uint32(len(self.sample.ChunkOffset.Entries) + 1),
+		SampleDescId:    uint32(len(self.changedCodecData) + 1),
+		SamplesPerChunk: 1,
+	})
+	return
+}
+
 func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	self.streams = []*Stream{}
-	for _, stream := range streams {
+	self.pktstreams = make([]*Stream, len(streams))
+	for i, stream := range streams {
+		if typ := stream.Type(); typ.IsData() && typ != av.TX3G {
+			// timed metadata not carried by mp4, its packets are dropped
+			continue
+		}
 		if err = self.newStream(stream); err != nil {
 			return
 		}
+		self.pktstreams[i] = self.streams[len(self.streams)-1]
 	}
 
 	taghdr := make([]byte, 8)
@@ -168,12 +325,23 @@ func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 }
 
 func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
-	stream := self.streams[pkt.Idx]
+	stream := self.pktstreams[pkt.Idx]
+	if stream == nil {
+		return
+	}
+	switch stream.Type() {
+	case av.H264, av.H265:
+		// SEI split out by demuxer goes back into the sample
+		pkt.Data = h264parser.PrependNALUsToAVCC(pkt.SideDataList(av.SIDE_DATA_SEI), pkt.Data)
+	}
 	if stream.lastpkt != nil {
 		if err = stream.writePacket(*stream.lastpkt, pkt.Time-stream.lastpkt.Time); err != nil {
 			return
 		}
+		stream.lastpkt.Release()
 	}
+	// kept until duration is known from next packet
+	pkt.Ref()
 	stream.lastpkt = &pkt
 	return
 }
@@ -184,6 +352,12 @@ func (self *Stream) writePacket(pkt av.Packet, rawdur time.Duration) (err error)
 		return
 	}
 
+	if pkt.CodecData != nil {
+		if err = self.changeCodecData(pkt.CodecData); err != nil {
+			return
+		}
+	}
+
 	if _, err = self.muxer.bufw.Write(pkt.Data); err != nil {
 		return
 	}
@@ -224,6 +398,7 @@ func (self *Muxer) WriteTrailer() (err error) {
 			if err = stream.writePacket(*stream.lastpkt, 0); err != nil {
 				return
 			}
+			stream.lastpkt.Release()
 			stream.lastpkt = nil
 		}
 	}
@@ -39,6 +39,12 @@ type Stream struct {
 
 	sttsEntry *mp4io.TimeToSampleEntry
 	cttsEntry *mp4io.CompositionOffsetEntry
+
+	// muxer: codec data of sample description entries after the first one
+	changedCodecData []av.CodecData
+	// demuxer: all entries if more than one is used and id of current one
+	sampleDescs  []av.CodecData
+	sampleDescId uint32
 }
 
 func timeToTs(tm time.Duration, timeScale int64) int64 {
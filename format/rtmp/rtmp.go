@@ -3,6 +3,7 @@ package rtmp
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -37,14 +38,25 @@ func Dial(uri string) (conn *Conn, err error) {
 }
 
 func DialTimeout(uri string, timeout time.Duration) (conn *Conn, err error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return DialContext(ctx, uri)
+}
+
+// Connect with ctx, handshake and reads later use StreamsContext and ReadPacketContext.
+func DialContext(ctx context.Context, uri string) (conn *Conn, err error) {
 	var u *url.URL
 	if u, err = ParseURL(uri); err != nil {
 		return
 	}
 
-	dailer := net.Dialer{Timeout: timeout}
+	dailer := net.Dialer{}
 	var netconn net.Conn
-	if netconn, err = dailer.Dial("tcp", u.Host); err != nil {
+	if netconn, err = dailer.DialContext(ctx, "tcp", u.Host); err != nil {
 		return
 	}
 
@@ -145,6 +157,7 @@ const (
 type Conn struct {
 	URL             *url.URL
 	OnPlayOrPublish func(string, flvio.AMFMap) error
+	BufferPool      *av.BufferPool // audio/video packet data from pool if set, see av.Buffer
 
 	prober  *flv.Prober
 	streams []av.CodecData
@@ -183,6 +196,7 @@ type Conn struct {
 	gotmsg      bool
 	timestamp   uint32
 	msgdata     []byte
+	msgbuffer   *av.Buffer // pooled msgdata
 	msgtypeid   uint8
 	datamsgvals []interface{}
 	avtag       flvio.Tag
@@ -233,11 +247,19 @@ type chunkStream struct {
 	msgdataleft uint32
 	msghdrtype  uint8
 	msgdata     []byte
+	msgbuffer   *av.Buffer
 }
 
-func (self *chunkStream) Start() {
+func (self *chunkStream) Start(pool *av.BufferPool) {
 	self.msgdataleft = self.msgdatalen
-	self.msgdata = make([]byte, self.msgdatalen)
+	// other messages may be kept after parsing, e.g: amf values
+	if pool != nil && (self.msgtypeid == msgtypeidVideoMsg || self.msgtypeid == msgtypeidAudioMsg) {
+		self.msgbuffer = pool.Get(int(self.msgdatalen))
+		self.msgdata = self.msgbuffer.Data
+	} else {
+		self.msgbuffer = nil
+		self.msgdata = make([]byte, self.msgdatalen)
+	}
 }
 
 const (
@@ -305,6 +327,8 @@ func (self *Conn) pollMsg() (err error) {
 	self.gotcommand = false
 	self.datamsgvals = nil
 	self.avtag = flvio.Tag{}
+	// not released, tags like sequence header may still be referenced
+	self.msgbuffer = nil
 	for {
 		if err = self.readChunk(); err != nil {
 			return
@@ -796,6 +820,11 @@ func (self *Conn) ReadPacket() (pkt av.Packet, err error) {
 
 		var ok bool
 		if pkt, ok = self.prober.TagToPacket(tag, int32(self.timestamp)); ok {
+			if pkt.CodecData != nil {
+				self.streams = self.prober.Streams
+			}
+			pkt.Buffer = self.msgbuffer
+			self.msgbuffer = nil
 			return
 		}
 	}
@@ -852,6 +881,31 @@ func (self *Conn) prepare(stage int, flags int) (err error) {
 	return
 }
 
+// Make blocking reads and writes return, used when context is done.
+func (self *Conn) interrupt() {
+	self.netconn.SetDeadline(time.Now())
+}
+
+func (self *Conn) resume() {
+	self.netconn.SetDeadline(time.Time{})
+}
+
+func (self *Conn) StreamsContext(ctx context.Context) (streams []av.CodecData, err error) {
+	err = avutil.DoContext(ctx, self.interrupt, self.resume, func() (err error) {
+		streams, err = self.Streams()
+		return
+	})
+	return
+}
+
+func (self *Conn) ReadPacketContext(ctx context.Context) (pkt av.Packet, err error) {
+	err = avutil.DoContext(ctx, self.interrupt, self.resume, func() (err error) {
+		pkt, err = self.ReadPacket()
+		return
+	})
+	return
+}
+
 func (self *Conn) Streams() (streams []av.CodecData, err error) {
 	if err = self.prepare(stageCodecDataDone, prepareReading); err != nil {
 		return
@@ -865,6 +919,15 @@ func (self *Conn) WritePacket(pkt av.Packet) (err error) {
 		return
 	}
 
+	if !flv.IsCarried(self.streams[pkt.Idx].Type()) {
+		return
+	}
+	if pkt.CodecData != nil {
+		if err = self.writeCodecDataChange(pkt); err != nil {
+			return
+		}
+	}
+
 	stream := self.streams[pkt.Idx]
 	tag, timestamp := flv.PacketToTag(pkt, stream)
 
@@ -879,6 +942,27 @@ func (self *Conn) WritePacket(pkt av.Packet) (err error) {
 	return
 }
 
+// Send new decoder config before the packet using it.
+func (self *Conn) writeCodecDataChange(pkt av.Packet) (err error) {
+	if pkt.CodecData.Type() != self.streams[pkt.Idx].Type() {
+		err = fmt.Errorf("rtmp: stream#%d codec type change to %v not supported", pkt.Idx, pkt.CodecData.Type())
+		return
+	}
+	self.streams = av.ApplyCodecDataChange(self.streams, pkt)
+
+	var tag flvio.Tag
+	var ok bool
+	if tag, ok, err = flv.CodecDataToTag(pkt.CodecData); err != nil {
+		return
+	}
+	if ok {
+		if err = self.writeAVTag(tag, flvio.TimeToTs(pkt.Time)); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (self *Conn) WriteTrailer() (err error) {
 	if err = self.flushWrite(); err != nil {
 		return
@@ -1006,6 +1090,11 @@ func (self *Conn) writeAVTag(tag flvio.Tag, ts int32) (err error) {
 		msgtypeid = msgtypeidVideoMsg
 		csid = 7
 		data = tag.Data
+
+	case flvio.TAG_SCRIPTDATA:
+		msgtypeid = msgtypeidDataMsgAMF0
+		csid = 5
+		data = tag.Data
 	}
 
 	actualChunkHeaderLength := chunkHeaderLength
@@ -1185,7 +1274,7 @@ func (self *Conn) readChunk() (err error) {
 			cs.hastimeext = false
 		}
 		cs.timenow = timestamp
-		cs.Start()
+		cs.Start(self.BufferPool)
 
 	case 1:
 		//  0                   1                   2                   3
@@ -1222,7 +1311,7 @@ func (self *Conn) readChunk() (err error) {
 		}
 		cs.timedelta = timestamp
 		cs.timenow += timestamp
-		cs.Start()
+		cs.Start(self.BufferPool)
 
 	case 2:
 		//  0                   1                   2
@@ -1255,7 +1344,7 @@ func (self *Conn) readChunk() (err error) {
 		}
 		cs.timedelta = timestamp
 		cs.timenow += timestamp
-		cs.Start()
+		cs.Start(self.BufferPool)
 
 	case 3:
 		if cs.msgdataleft == 0 {
@@ -1281,7 +1370,7 @@ func (self *Conn) readChunk() (err error) {
 				}
 				cs.timenow += timestamp
 			}
-			cs.Start()
+			cs.Start(self.BufferPool)
 		}
 
 	default:
@@ -1312,6 +1401,9 @@ func (self *Conn) readChunk() (err error) {
 			fmt.Print(hex.Dump(cs.msgdata))
 		}
 
+		self.msgbuffer = cs.msgbuffer
+		cs.msgbuffer = nil
+
 		// 收包处理(ChunkStream内部处理)
 		if err = self.handleMsg(cs.timenow, cs.msgsid, cs.msgtypeid, cs.msgdata); err != nil {
 			return
@@ -1669,6 +1761,15 @@ func Handler(h *avutil.RegisterHandler) {
 		return
 	}
 
+	h.UrlDemuxerContext = func(ctx context.Context, uri string) (ok bool, demuxer av.DemuxCloser, err error) {
+		if !strings.HasPrefix(uri, "rtmp://") {
+			return
+		}
+		ok = true
+		demuxer, err = DialContext(ctx, uri)
+		return
+	}
+
 	h.UrlMuxer = func(uri string) (ok bool, muxer av.MuxCloser, err error) {
 		if !strings.HasPrefix(uri, "rtmp://") {
 			return
@@ -0,0 +1,132 @@
+package rtmp
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/av/pubsub"
+	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/format/flv"
+)
+
+func benchStreams(b *testing.B) []av.CodecData {
+	sps, _ := hex.DecodeString("67640028acd940780227e5c05a808080a0000003002000000781e3062cb0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	video, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		b.Fatal(err)
+	}
+	audio, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AOT_AAC_LC,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return []av.CodecData{video, audio}
+}
+
+// 25fps video with 2s gop and one audio packet per frame, until conn closed.
+func benchPublish(conn *Conn, streams []av.CodecData) {
+	keyframe := make([]byte, 64*1024)
+	frame := make([]byte, 8*1024)
+	audio := make([]byte, 400)
+	if err := conn.WriteHeader(streams); err != nil {
+		return
+	}
+	for i := 0; ; i++ {
+		tm := time.Duration(i) * time.Second / 25
+		pkt := av.Packet{Idx: 0, Time: tm, Data: frame}
+		if i%50 == 0 {
+			pkt.IsKeyFrame = true
+			pkt.Data = keyframe
+		}
+		if err := conn.WritePacket(pkt); err != nil {
+			return
+		}
+		if err := conn.WritePacket(av.Packet{Idx: 1, Time: tm, Data: audio}); err != nil {
+			return
+		}
+	}
+}
+
+// RTMP ingest -> pubsub.Queue -> FLV egress
+func benchmarkIngest(b *testing.B, pool *av.BufferPool) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer listener.Close()
+
+	streams := benchStreams(b)
+	go func() {
+		conn, err := Dial("rtmp://" + listener.Addr().String() + "/live/bench")
+		if err != nil {
+			return
+		}
+		benchPublish(conn, streams)
+		conn.Close()
+	}()
+
+	netconn, err := listener.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer netconn.Close()
+	conn := NewConn(netconn)
+	conn.isserver = true
+	conn.BufferPool = pool
+	if err = conn.Prepare(); err != nil {
+		b.Fatal(err)
+	}
+	if streams, err = conn.Streams(); err != nil {
+		b.Fatal(err)
+	}
+
+	que := pubsub.NewQueue()
+	que.WriteHeader(streams)
+	done := make(chan bool)
+	go func() {
+		cursor := que.Latest()
+		muxer := flv.NewMuxer(ioutil.Discard)
+		muxer.WriteHeader(streams)
+		for {
+			pkt, err := cursor.ReadPacket()
+			if err != nil {
+				break
+			}
+			muxer.WritePacket(pkt)
+			pkt.Release()
+		}
+		done <- true
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pkt, err := conn.ReadPacket()
+		if err != nil {
+			b.Fatal(err)
+		}
+		que.WritePacket(pkt)
+		pkt.Release()
+	}
+	b.StopTimer()
+
+	que.Close()
+	<-done
+}
+
+func BenchmarkIngest(b *testing.B) {
+	benchmarkIngest(b, nil)
+}
+
+func BenchmarkIngestPooled(b *testing.B) {
+	benchmarkIngest(b, av.NewBufferPool())
+}
@@ -3,6 +3,7 @@ package rtsp
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/binary"
@@ -14,6 +15,8 @@ import (
 	"github.com/nareix/joy4/codec"
 	"github.com/nareix/joy4/codec/aacparser"
 	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/codec/h265parser"
+	"github.com/nareix/joy4/codec/opusparser"
 	"github.com/nareix/joy4/format/rtsp/sdp"
 	"io"
 	"net"
@@ -43,6 +46,7 @@ type Client struct {
 	Headers   []string
 
 	SkipErrRtpBlock bool
+	BufferPool      *av.BufferPool // h264/h265 packet data from pool if set, see av.Buffer
 
 	RtspTimeout          time.Duration
 	RtpTimeout           time.Duration
@@ -84,6 +88,17 @@ type Response struct {
 }
 
 func DialTimeout(uri string, timeout time.Duration) (self *Client, err error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return DialContext(ctx, uri)
+}
+
+// Connect with ctx, later requests and reads use StreamsContext and ReadPacketContext.
+func DialContext(ctx context.Context, uri string) (self *Client, err error) {
 	var URL *url.URL
 	if URL, err = url.Parse(uri); err != nil {
 		return
@@ -93,9 +108,9 @@ func DialTimeout(uri string, timeout time.Duration) (self *Client, err error) {
 		URL.Host = URL.Host + ":554"
 	}
 
-	dailer := net.Dialer{Timeout: timeout}
+	dailer := net.Dialer{}
 	var conn net.Conn
-	if conn, err = dailer.Dial("tcp", URL.Host); err != nil {
+	if conn, err = dailer.DialContext(ctx, "tcp", URL.Host); err != nil {
 		return
 	}
 
@@ -170,6 +185,14 @@ func (self *Client) prepare(stage int) (err error) {
 	return
 }
 
+func (self *Client) StreamsContext(ctx context.Context) (streams []av.CodecData, err error) {
+	err = avutil.DoContext(ctx, self.conn.interrupt, self.conn.resume, func() (err error) {
+		streams, err = self.Streams()
+		return
+	})
+	return
+}
+
 func (self *Client) Streams() (streams []av.CodecData, err error) {
 	if err = self.prepare(stageCodecDataDone); err != nil {
 		return
@@ -756,6 +779,25 @@ func (self *Stream) makeCodecData() (err error) {
 				return
 			}
 
+		case av.H265:
+			if len(self.vps) == 0 && len(self.sps) == 0 && len(self.pps) == 0 {
+				for _, nalu := range [][]byte{media.SpropVPS, media.SpropSPS, media.SpropPPS} {
+					if len(nalu) > 0 {
+						self.handleH265Payload(0, nalu)
+					}
+				}
+			}
+
+			if len(self.vps) > 0 && len(self.sps) > 0 && len(self.pps) > 0 {
+				if self.CodecData, err = h265parser.NewCodecDataFromVPSAndSPSAndPPS(self.vps, self.sps, self.pps); err != nil {
+					err = fmt.Errorf("rtsp: h265 vps/sps/pps invalid: %s", err)
+					return
+				}
+			} else {
+				err = fmt.Errorf("rtsp: missing h265 vps, sps or pps")
+				return
+			}
+
 		case av.AAC:
 			if len(media.Config) == 0 {
 				err = fmt.Errorf("rtsp: aac sdp config missing")
@@ -765,6 +807,17 @@ func (self *Stream) makeCodecData() (err error) {
 				err = fmt.Errorf("rtsp: aac sdp config invalid: %s", err)
 				return
 			}
+
+		case av.OPUS:
+			// rfc7587: rtpmap is always opus/48000/2, actual channels are signalled in-band
+			channels := media.ChannelCount
+			if channels == 0 {
+				channels = 2
+			}
+			if self.CodecData, err = opusparser.NewCodecDataFromChannelCount(channels); err != nil {
+				err = fmt.Errorf("rtsp: opus sdp invalid: %s", err)
+				return
+			}
 		}
 	} else {
 		switch media.PayloadType {
@@ -799,6 +852,22 @@ func (self *Stream) handleBuggyAnnexbH264Packet(timestamp uint32, packet []byte)
 	return
 }
 
+// Raw nalu to avcc in packet data, which is from client's BufferPool if set.
+func (self *Stream) setAVCCData(nalu []byte) {
+	// replaces nalu got before in same packet
+	self.pkt.Release()
+	var b []byte
+	if self.client != nil && self.client.BufferPool != nil {
+		self.pkt.Buffer = self.client.BufferPool.Get(4+len(nalu))
+		b = self.pkt.Buffer.Data
+	} else {
+		b = make([]byte, 4+len(nalu))
+	}
+	pio.PutU32BE(b[0:4], uint32(len(nalu)))
+	copy(b[4:], nalu)
+	self.pkt.Data = b
+}
+
 func (self *Stream) handleH264Payload(timestamp uint32, packet []byte) (err error) {
 	if len(packet) < 2 {
 		err = fmt.Errorf("rtp: h264 packet too short")
@@ -834,13 +903,12 @@ func (self *Stream) handleH264Payload(timestamp uint32, packet []byte) (err erro
 				self.pkt.IsKeyFrame = true
 			}
 			self.gotpkt = true
-			// raw nalu to avcc
-			b := make([]byte, 4+len(packet))
-			pio.PutU32BE(b[0:4], uint32(len(packet)))
-			copy(b[4:], packet)
-			self.pkt.Data = b
+			self.setAVCCData(packet)
 			self.timestamp = timestamp
 
+	case naluType == 6: // sei
+		self.pkt.AddSideData(av.SIDE_DATA_SEI, packet)
+
 	case naluType == 7: // sps
 		if self.client != nil && self.client.DebugRtp {
 			fmt.Println("rtsp: got sps")
@@ -988,6 +1056,141 @@ func (self *Stream) handleH264Payload(timestamp uint32, packet []byte) (err erro
 	return
 }
 
+func (self *Stream) handleH265ParamSet(packet []byte, param *[]byte, name string) {
+	if self.client != nil && self.client.DebugRtp {
+		fmt.Println("rtsp: got", name)
+	}
+	if len(*param) == 0 {
+		*param = packet
+		self.makeCodecData()
+	} else if bytes.Compare(*param, packet) != 0 {
+		if param == &self.sps {
+			self.spsChanged = true
+		} else if param == &self.pps {
+			self.ppsChanged = true
+		}
+		*param = packet
+		if self.client != nil && self.client.DebugRtp {
+			fmt.Println("rtsp:", name, "changed")
+		}
+	}
+}
+
+func (self *Stream) handleH265Payload(timestamp uint32, packet []byte) (err error) {
+	if len(packet) < 3 {
+		err = fmt.Errorf("rtp: h265 packet too short")
+		return
+	}
+
+	naluType := h265parser.NALUType(packet)
+
+	/*
+		https://tools.ietf.org/html/rfc7798
+		0-47     NAL unit  Single NAL unit packet             4.4.1
+		48       AP        Aggregation packet                 4.4.2
+		49       FU        Fragmentation unit                 4.4.3
+		50       PACI      PACI packet                        4.4.4
+	*/
+	switch {
+	case naluType < h265parser.NALU_VPS:
+		if h265parser.IsKeyFrameNALU(packet) {
+			self.pkt.IsKeyFrame = true
+		}
+		self.gotpkt = true
+		self.setAVCCData(packet)
+		self.timestamp = timestamp
+
+	case naluType == h265parser.NALU_SEI_PREFIX, naluType == h265parser.NALU_SEI_SUFFIX:
+		self.pkt.AddSideData(av.SIDE_DATA_SEI, packet)
+
+	case naluType == h265parser.NALU_VPS:
+		self.handleH265ParamSet(packet, &self.vps, "vps")
+
+	case naluType == h265parser.NALU_SPS:
+		self.handleH265ParamSet(packet, &self.sps, "sps")
+
+	case naluType == h265parser.NALU_PPS:
+		self.handleH265ParamSet(packet, &self.pps, "pps")
+
+	case naluType == h265parser.NALU_FU:
+		/*
+			0                   1                   2                   3
+			0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|    PayloadHdr (Type=49)       |   FU header   | DONL (cond)   |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-|
+			| DONL (cond)   |                                               |
+			|-+-+-+-+-+-+-+-+                                               |
+			|                         FU payload                            |
+			|                               +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|                               :...OPTIONAL RTP padding        |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+			+---------------+
+			|0|1|2|3|4|5|6|7|
+			+-+-+-+-+-+-+-+-+
+			|S|E|  FuType   |
+			+---------------+
+		*/
+		fuHeader := packet[2]
+		isStart := fuHeader&0x80 != 0
+		isEnd := fuHeader&0x40 != 0
+		if isStart {
+			self.fuStarted = true
+			self.fuBuffer = []byte{packet[0]&0x81 | (fuHeader&0x3f)<<1, packet[1]}
+		}
+		if self.fuStarted {
+			self.fuBuffer = append(self.fuBuffer, packet[3:]...)
+			if isEnd {
+				self.fuStarted = false
+				if err = self.handleH265Payload(timestamp, self.fuBuffer); err != nil {
+					return
+				}
+			}
+		}
+
+	case naluType == h265parser.NALU_AP:
+		/*
+			0                   1                   2                   3
+			0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|                          RTP Header                           |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|   PayloadHdr (Type=48)        |         NALU 1 Size           |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|          NALU 1 HDR           |                               |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+         NALU 1 Data           |
+			|                   . . .                                       |
+			|                                                               |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|  . . .        | NALU 2 Size                   | NALU 2 HDR    |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			| NALU 2 HDR    |                                               |
+			+-+-+-+-+-+-+-+-+              NALU 2 Data                      |
+			|                   . . .                                       |
+			|                               +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+			|                               :...OPTIONAL RTP padding        |
+			+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+		*/
+		packet = packet[2:]
+		for len(packet) >= 2 {
+			size := int(packet[0])<<8|int(packet[1])
+			if size+2 > len(packet) {
+				break
+			}
+			if err = self.handleH265Payload(timestamp, packet[2:size+2]); err != nil {
+				return
+			}
+			packet = packet[size+2:]
+		}
+		return
+
+	default: // SEI, AUD, PACI and others
+	}
+
+	return
+}
+
 func (self *Stream) handleRtpPacket(packet []byte) (err error) {
 	if self.isCodecDataChange() {
 		err = ErrCodecDataChange
@@ -1029,6 +1232,14 @@ func (self *Stream) handleRtpPacket(packet []byte) (err error) {
 	timestamp := binary.BigEndian.Uint32(packet[4:8])
 	payload := packet[payloadOffset:]
 
+	seq := binary.BigEndian.Uint16(packet[2:4])
+	if self.gotseq && seq != self.seq+1 {
+		// rtp packets lost or reordered
+		self.pkt.SetDiscontinuity()
+	}
+	self.seq = seq
+	self.gotseq = true
+
 	/*
 		PT 	Encoding Name 	Audio/Video (A/V) 	Clock Rate (Hz) 	Channels 	Reference
 		0	PCMU	A	8000	1	[RFC3551]
@@ -1079,6 +1290,11 @@ func (self *Stream) handleRtpPacket(packet []byte) (err error) {
 			return
 		}
 
+	case av.H265:
+		if err = self.handleH265Payload(timestamp, payload); err != nil {
+			return
+		}
+
 	case av.AAC:
 		if len(payload) < 4 {
 			err = fmt.Errorf("rtp: aac packet too short")
@@ -1098,6 +1314,30 @@ func (self *Stream) handleRtpPacket(packet []byte) (err error) {
 	return
 }
 
+/*
+RTCP sender report (https://tools.ietf.org/html/rfc3550#section-6.4.1)
+
+	V=2(2) P(1) RC(5) PT=SR=200(8) length(16)
+	SSRC of sender(32)
+	NTP timestamp, most significant word(32)
+	NTP timestamp, least significant word(32)
+	RTP timestamp(32)
+	...
+*/
+func (self *Stream) handleRtcpPacket(packet []byte) {
+	if len(packet) < 20 || packet[0]&0xc0 != 0x80 || packet[1] != 200 {
+		return
+	}
+	ntpsec := binary.BigEndian.Uint32(packet[8:12])
+	ntpfrac := binary.BigEndian.Uint32(packet[12:16])
+	// ntp epoch is 1900-01-01
+	sec := int64(ntpsec) - 2208988800
+	nsec := int64(uint64(ntpfrac) * uint64(time.Second) >> 32)
+	self.srNTP = time.Unix(sec, nsec)
+	self.srRTP = binary.BigEndian.Uint32(packet[16:20])
+	self.gotsr = true
+}
+
 func (self *Client) Play() (err error) {
 	req := Request{
 		Method: "PLAY",
@@ -1138,6 +1378,9 @@ func (self *Client) handleBlock(block []byte) (pkt av.Packet, ok bool, err error
 		if self.DebugRtp {
 			fmt.Println("rtsp: rtcp block len", len(block)-4)
 		}
+		if i := blockno/2; i < len(self.streams) {
+			self.streams[i].handleRtcpPacket(block[4:])
+		}
 		return
 	}
 
@@ -1164,6 +1407,7 @@ func (self *Client) handleBlock(block []byte) (pkt av.Packet, ok bool, err error
 		A receiver can then synchronize presentation of the audio and video packets by relating 
 		their RTP timestamps using the timestamp pairs in RTCP SR packets.
 		*/
+		rtptimestamp := stream.timestamp
 		if stream.firsttimestamp == 0 {
 			stream.firsttimestamp = stream.timestamp
 		}
@@ -1171,6 +1415,11 @@ func (self *Client) handleBlock(block []byte) (pkt av.Packet, ok bool, err error
 
 		ok = true
 		pkt = stream.pkt
+		pkt.SetSequence(uint64(stream.seq))
+		if stream.gotsr {
+			delta := time.Duration(int32(rtptimestamp-stream.srRTP)) * time.Second / time.Duration(stream.timeScale())
+			pkt.SetWallclock(stream.srNTP.Add(delta))
+		}
 		pkt.Time = time.Duration(stream.timestamp)*time.Second / time.Duration(stream.timeScale())
 		pkt.Idx = int8(self.setupMap[i])
 
@@ -1219,6 +1468,14 @@ func (self *Client) readPacket() (pkt av.Packet, err error) {
 	return
 }
 
+func (self *Client) ReadPacketContext(ctx context.Context) (pkt av.Packet, err error) {
+	err = avutil.DoContext(ctx, self.conn.interrupt, self.conn.resume, func() (err error) {
+		pkt, err = self.ReadPacket()
+		return
+	})
+	return
+}
+
 func (self *Client) ReadPacket() (pkt av.Packet, err error) {
 	if err = self.prepare(stageCodecDataDone); err != nil {
 		return
@@ -1235,5 +1492,14 @@ func Handler(h *avutil.RegisterHandler) {
 		demuxer, err = Dial(uri)
 		return
 	}
+
+	h.UrlDemuxerContext = func(ctx context.Context, uri string) (ok bool, demuxer av.DemuxCloser, err error) {
+		if !strings.HasPrefix(uri, "rtsp://") {
+			return
+		}
+		ok = true
+		demuxer, err = DialContext(ctx, uri)
+		return
+	}
 }
 
@@ -0,0 +1,66 @@
+package rtsp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nareix/joy4/av"
+)
+
+func testNALU(i int) []byte {
+	nalu := bytes.Repeat([]byte{byte(i)}, 1000)
+	nalu[0] = 0x41
+	return nalu
+}
+
+func TestBufferPool(t *testing.T) {
+	stream := &Stream{client: &Client{BufferPool: av.NewBufferPool()}}
+	var held av.Packet
+	var heldData []byte
+	released := map[*av.Buffer]bool{}
+	reused := 0
+	for i := 0; i < 50; i++ {
+		if i == 10 {
+			// later nalu of same timestamp replaces data, first buffer released
+			if err := stream.handleH264Payload(uint32(i), testNALU(100)); err != nil {
+				t.Fatal(err)
+			}
+			released[stream.pkt.Buffer] = true
+		}
+		if err := stream.handleH264Payload(uint32(i), testNALU(i)); err != nil {
+			t.Fatal(err)
+		}
+		// as handleBlock takes packet
+		pkt := stream.pkt
+		stream.pkt = av.Packet{}
+		stream.gotpkt = false
+
+		if pkt.Buffer == nil {
+			t.Fatalf("packet#%d data not pooled", i)
+		}
+		if pkt.Buffer == held.Buffer {
+			t.Fatalf("packet#%d got buffer still referenced", i)
+		}
+		if !bytes.Equal(pkt.Data, append([]byte{0, 0, 0x03, 0xe8}, testNALU(i)...)) {
+			t.Fatalf("packet#%d data wrong", i)
+		}
+		if released[pkt.Buffer] {
+			reused++
+		}
+		if i == 1 {
+			held = pkt
+			held.Ref()
+			heldData = append([]byte(nil), pkt.Data...)
+		}
+		released[pkt.Buffer] = true
+		pkt.Release()
+	}
+	if !bytes.Equal(held.Data, heldData) {
+		t.Fatalf("held packet data changed")
+	}
+	held.Release()
+	// sync.Pool may drop some
+	if reused == 0 {
+		t.Fatalf("released buffers not reused")
+	}
+}
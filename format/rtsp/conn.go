@@ -2,24 +2,52 @@ package rtsp
 
 import (
 	"net"
+	"sync"
 	"time"
 )
 
 type connWithTimeout struct {
 	Timeout time.Duration
 	net.Conn
+
+	// set by interrupt() so that Timeout does not extend the past deadline
+	lock        sync.Mutex
+	interrupted bool
 }
 
-func (self connWithTimeout) Read(p []byte) (n int, err error) {
+func (self *connWithTimeout) Read(p []byte) (n int, err error) {
 	if self.Timeout > 0 {
-		self.Conn.SetReadDeadline(time.Now().Add(self.Timeout))
+		self.lock.Lock()
+		if !self.interrupted {
+			self.Conn.SetReadDeadline(time.Now().Add(self.Timeout))
+		}
+		self.lock.Unlock()
 	}
 	return self.Conn.Read(p)
 }
 
-func (self connWithTimeout) Write(p []byte) (n int, err error) {
+func (self *connWithTimeout) Write(p []byte) (n int, err error) {
 	if self.Timeout > 0 {
-		self.Conn.SetWriteDeadline(time.Now().Add(self.Timeout))
+		self.lock.Lock()
+		if !self.interrupted {
+			self.Conn.SetWriteDeadline(time.Now().Add(self.Timeout))
+		}
+		self.lock.Unlock()
 	}
 	return self.Conn.Write(p)
 }
+
+// Make blocking Read and Write return, used when context is done.
+func (self *connWithTimeout) interrupt() {
+	self.lock.Lock()
+	self.interrupted = true
+	self.Conn.SetDeadline(time.Now())
+	self.lock.Unlock()
+}
+
+func (self *connWithTimeout) resume() {
+	self.lock.Lock()
+	self.interrupted = false
+	self.Conn.SetDeadline(time.Time{})
+	self.lock.Unlock()
+}
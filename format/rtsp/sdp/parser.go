@@ -17,10 +17,14 @@ type Media struct {
 	AVType             string
 	Type               av.CodecType
 	TimeScale          int
+	ChannelCount       int
 	Control            string
 	Rtpmap             int
 	Config             []byte
 	SpropParameterSets [][]byte
+	SpropVPS           []byte
+	SpropSPS           []byte
+	SpropPPS           []byte
 	PayloadType        int
 	SizeLength         int
 	IndexLength        int
@@ -74,10 +78,19 @@ func Parse(content string) (sess Session, medias []Media) {
 								media.Type = av.AAC
 							case "H264":
 								media.Type = av.H264
+							case "H265", "HEVC":
+								media.Type = av.H265
+							case "OPUS":
+								media.Type = av.OPUS
 							}
 							if i, err := strconv.Atoi(keyval[1]); err == nil {
 								media.TimeScale = i
 							}
+							if len(keyval) >= 3 {
+								if i, err := strconv.Atoi(keyval[2]); err == nil {
+									media.ChannelCount = i
+								}
+							}
 							if false {
 								fmt.Println("sdp:", keyval[1], media.TimeScale)
 							}
@@ -102,6 +115,12 @@ func Parse(content string) (sess Session, medias []Media) {
 											val, _ := base64.StdEncoding.DecodeString(field)
 											media.SpropParameterSets = append(media.SpropParameterSets, val)
 										}
+									case "sprop-vps":
+										media.SpropVPS, _ = base64.StdEncoding.DecodeString(val)
+									case "sprop-sps":
+										media.SpropSPS, _ = base64.StdEncoding.DecodeString(val)
+									case "sprop-pps":
+										media.SpropPPS, _ = base64.StdEncoding.DecodeString(val)
 									}
 								}
 							}
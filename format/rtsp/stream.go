@@ -11,9 +11,10 @@ type Stream struct {
 	Sdp    sdp.Media
 	client *Client
 
-	// h264
+	// h264/h265
 	fuStarted  bool
 	fuBuffer   []byte
+	vps        []byte
 	sps        []byte
 	pps        []byte
 	spsChanged bool
@@ -25,5 +26,14 @@ type Stream struct {
 	firsttimestamp uint32
 
 	lasttime time.Duration
+
+	// rtp sequence number of last packet
+	seq    uint16
+	gotseq bool
+
+	// ntp and rtp timestamp pair from last rtcp sender report
+	srNTP time.Time
+	srRTP uint32
+	gotsr bool
 }
 
@@ -2,17 +2,25 @@ package ts
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"time"
 	"github.com/nareix/joy4/utils/bits/pio"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/format/ts/tsio"
+	"github.com/nareix/joy4/codec"
 	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/ac3parser"
 	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/codec/h265parser"
+	"github.com/nareix/joy4/codec/mp3parser"
+	"github.com/nareix/joy4/codec/opusparser"
 	"io"
 )
 
 type Demuxer struct {
+	BufferPool *av.BufferPool // packet data from pool if set, see av.Buffer
+
 	r *bufio.Reader
 
 	pkts []av.Packet
@@ -115,13 +123,64 @@ func (self *Demuxer) initPMT(payload []byte) (err error) {
 		switch info.StreamType {
 		case tsio.ElementaryStreamTypeH264:
 			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypeH265:
+			self.streams = append(self.streams, stream)
 		case tsio.ElementaryStreamTypeAdtsAAC:
 			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypeMPEG1Audio, tsio.ElementaryStreamTypeMPEG2Audio:
+			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypeAC3, tsio.ElementaryStreamTypeEAC3:
+			self.streams = append(self.streams, stream)
+		case tsio.ElementaryStreamTypeMetadata:
+			if info.MetadataFormat() == "ID3 " {
+				stream.CodecData = codec.NewID3CodecData()
+				self.streams = append(self.streams, stream)
+			}
+		case tsio.ElementaryStreamTypePrivateData:
+			if info.RegistrationFormat() == "Opus" {
+				if stream.CodecData, err = opusparser.NewCodecDataFromChannelCount(opusChannelCount(info)); err != nil {
+					return
+				}
+				self.streams = append(self.streams, stream)
+			} else if streamType, ok := ac3StreamType(info); ok {
+				// DVB carries AC-3 as private data, handle it like the ATSC stream types
+				stream.streamType = streamType
+				self.streams = append(self.streams, stream)
+			}
 		}
 	}
 	return
 }
 
+// channel_config_code in opus_audio_descriptor, 0 is dual mono
+// and 1-8 are channel counts with vorbis mapping.
+func opusChannelCount(info tsio.ElementaryStreamInfo) int {
+	if desc, ok := info.FindDescriptor(tsio.DescriptorTagExtension); ok {
+		if len(desc.Data) >= 2 && desc.Data[0] == tsio.ExtensionDescriptorTagOpus {
+			if code := int(desc.Data[1]); code >= 1 && code <= 8 {
+				return code
+			}
+		}
+	}
+	return 2
+}
+
+func ac3StreamType(info tsio.ElementaryStreamInfo) (streamType uint8, ok bool) {
+	if _, found := info.FindDescriptor(tsio.DescriptorTagEAC3); found {
+		return tsio.ElementaryStreamTypeEAC3, true
+	}
+	if _, found := info.FindDescriptor(tsio.DescriptorTagAC3); found {
+		return tsio.ElementaryStreamTypeAC3, true
+	}
+	switch info.RegistrationFormat() {
+	case "EAC3":
+		return tsio.ElementaryStreamTypeEAC3, true
+	case "AC-3":
+		return tsio.ElementaryStreamTypeAC3, true
+	}
+	return
+}
+
 func (self *Demuxer) payloadEnd() (n int, err error) {
 	for _, stream := range self.streams {
 		var i int
@@ -172,7 +231,7 @@ func (self *Demuxer) readTSPacket() (err error) {
 	} else {
 		for _, stream := range self.streams {
 			if pid == stream.pid {
-				if err = stream.handleTSPacket(start, iskeyframe, payload); err != nil {
+				if err = stream.handleTSPacket(start, iskeyframe, tsio.TSDiscontinuity(self.tshdr), payload); err != nil {
 					return
 				}
 				break
@@ -183,7 +242,8 @@ func (self *Demuxer) readTSPacket() (err error) {
 	return
 }
 
-func (self *Stream) addPacket(payload []byte, timedelta time.Duration) {
+// Packet takes over reference of buf if not nil.
+func (self *Stream) addPacket(payload []byte, buf *av.Buffer, timedelta time.Duration) {
 	dts := self.dts
 	pts := self.pts
 	if dts == 0 {
@@ -196,13 +256,82 @@ func (self *Stream) addPacket(payload []byte, timedelta time.Duration) {
 		IsKeyFrame: self.iskeyframe,
 		Time: dts+timedelta,
 		Data: payload,
+		Buffer: buf,
 	}
 	if pts != dts {
 		pkt.CompositionTime = pts-dts
 	}
+	if self.discontinuity {
+		pkt.SetDiscontinuity()
+		self.discontinuity = false
+	}
+	for _, sei := range self.seis {
+		pkt.AddSideData(av.SIDE_DATA_SEI, sei)
+	}
+	self.seis = nil
+	if self.changedCodecData != nil {
+		pkt.CodecData = self.changedCodecData
+		self.changedCodecData = nil
+	}
 	demuxer.pkts = append(demuxer.pkts, pkt)
 }
 
+// Codec data found in stream differs from current one after probing.
+func (self *Stream) changeCodecData(codec av.CodecData) {
+	self.CodecData = codec
+	if self.demuxer.stage > 0 {
+		self.changedCodecData = codec
+	}
+}
+
+func sameAACConfig(a, b aacparser.MPEG4AudioConfig) bool {
+	return a.ObjectType == b.ObjectType && a.SampleRateIndex == b.SampleRateIndex && a.ChannelConfig == b.ChannelConfig
+}
+
+// Get n bytes from demuxer's BufferPool if set.
+func (self *Stream) allocData(n int) (b []byte, buf *av.Buffer) {
+	if pool := self.demuxer.BufferPool; pool != nil {
+		buf = pool.Get(n)
+		b = buf.Data
+	} else {
+		b = make([]byte, n)
+	}
+	return
+}
+
+func (self *Stream) appendData(payload []byte) {
+	if self.databuf != nil && len(self.data)+len(payload) > cap(self.data) {
+		b, buf := self.allocData(2*(len(self.data)+len(payload)))
+		b = append(b[:0], self.data...)
+		self.databuf.Release()
+		self.data, self.databuf = b, buf
+	}
+	self.data = append(self.data, payload...)
+}
+
+func (self *Stream) releaseData() {
+	if self.databuf != nil {
+		self.databuf.Release()
+		self.databuf = nil
+	}
+	self.data = nil
+}
+
+func refBuffer(buf *av.Buffer) *av.Buffer {
+	if buf != nil {
+		buf.Ref()
+	}
+	return buf
+}
+
+// Parts of pooled pes data kept beyond packets must be copied.
+func copyPooled(b []byte, buf *av.Buffer) []byte {
+	if buf == nil {
+		return b
+	}
+	return append([]byte(nil), b...)
+}
+
 func (self *Stream) payloadEnd() (n int, err error) {
 	payload := self.data
 	if payload == nil {
@@ -212,7 +341,14 @@ func (self *Stream) payloadEnd() (n int, err error) {
 		err = fmt.Errorf("ts: packet size mismatch size=%d correct=%d", len(payload), self.datalen)
 		return
 	}
+	databuf := self.databuf
+	self.databuf = nil
 	self.data = nil
+	defer func() {
+		if databuf != nil {
+			databuf.Release()
+		}
+	}()
 
 	switch self.streamType {
 	case tsio.ElementaryStreamTypeAdtsAAC:
@@ -224,42 +360,166 @@ func (self *Stream) payloadEnd() (n int, err error) {
 			if config, hdrlen, framelen, samples, err = aacparser.ParseADTSHeader(payload); err != nil {
 				return
 			}
-			if self.CodecData == nil {
-				if self.CodecData, err = aacparser.NewCodecDataFromMPEG4AudioConfig(config); err != nil {
+			if old, ok := self.CodecData.(aacparser.CodecData); !ok || !sameAACConfig(old.Config, config) {
+				var codec aacparser.CodecData
+				if codec, err = aacparser.NewCodecDataFromMPEG4AudioConfig(config); err != nil {
 					return
 				}
+				self.changeCodecData(codec)
 			}
-			self.addPacket(payload[hdrlen:framelen], delta)
+			self.addPacket(payload[hdrlen:framelen], refBuffer(databuf), delta)
 			n++
 			delta += time.Duration(samples) * time.Second / time.Duration(config.SampleRate)
 			payload = payload[framelen:]
 		}
 
+	case tsio.ElementaryStreamTypeMPEG1Audio, tsio.ElementaryStreamTypeMPEG2Audio:
+		delta := time.Duration(0)
+		for len(payload) > 0 {
+			var hdr mp3parser.FrameHeader
+			var framelen, samples int
+			if hdr, framelen, samples, err = mp3parser.ParseFrameHeader(payload); err != nil {
+				return
+			}
+			if framelen > len(payload) {
+				err = fmt.Errorf("ts: mp3 frame size=%d exceeds pes payload", framelen)
+				return
+			}
+			if self.CodecData == nil {
+				if self.CodecData, err = mp3parser.NewCodecDataFromFrameHeader(hdr); err != nil {
+					return
+				}
+			}
+			self.addPacket(payload[:framelen], refBuffer(databuf), delta)
+			n++
+			delta += time.Duration(samples) * time.Second / time.Duration(hdr.SampleRate)
+			payload = payload[framelen:]
+		}
+
+	case tsio.ElementaryStreamTypeMetadata:
+		// one ID3 tag per pes packet
+		self.addPacket(payload, refBuffer(databuf), time.Duration(0))
+		n++
+
+	case tsio.ElementaryStreamTypeAC3, tsio.ElementaryStreamTypeEAC3:
+		var frames [][]byte
+		var hdrs []ac3parser.SyncFrameHeader
+		if frames, hdrs, err = ac3parser.SplitSyncFrames(payload); err != nil {
+			return
+		}
+		delta := time.Duration(0)
+		for i, frame := range frames {
+			if self.CodecData == nil {
+				if self.CodecData, err = ac3parser.NewCodecDataFromSyncFrameHeader(hdrs[i]); err != nil {
+					return
+				}
+			}
+			self.addPacket(frame, refBuffer(databuf), delta)
+			n++
+			delta += hdrs[i].Duration()
+		}
+
+	case tsio.ElementaryStreamTypePrivateData:
+		delta := time.Duration(0)
+		for len(payload) > 0 {
+			var hdrlen, ausize int
+			if hdrlen, ausize, err = tsio.ParseOpusControlHeader(payload); err != nil {
+				return
+			}
+			frame := payload[hdrlen:hdrlen+ausize]
+			self.addPacket(frame, refBuffer(databuf), delta)
+			n++
+			var dur time.Duration
+			if dur, err = opusparser.PacketDuration(frame); err != nil {
+				return
+			}
+			delta += dur
+			payload = payload[hdrlen+ausize:]
+		}
+
 	case tsio.ElementaryStreamTypeH264:
 		nalus, _ := h264parser.SplitNALUs(payload)
 		var sps, pps []byte
 		for _, nalu := range nalus {
 			if len(nalu) > 0 {
-				naltype := nalu[0] & 0x1f
-				switch {
-				case naltype == 7:
+				switch nalu[0] & 0x1f {
+				case 7:
 					sps = nalu
-				case naltype == 8:
+				case 8:
 					pps = nalu
+				}
+			}
+		}
+
+		if len(sps) > 0 && len(pps) > 0 {
+			old, ok := self.CodecData.(h264parser.CodecData)
+			if !ok || !bytes.Equal(old.SPS(), sps) || !bytes.Equal(old.PPS(), pps) {
+				var codec h264parser.CodecData
+				if codec, err = h264parser.NewCodecDataFromSPSAndPPS(copyPooled(sps, databuf), copyPooled(pps, databuf)); err != nil {
+					return
+				}
+				self.changeCodecData(codec)
+			}
+		}
+
+		for _, nalu := range nalus {
+			if len(nalu) > 0 {
+				naltype := nalu[0] & 0x1f
+				switch {
+				case naltype == h264parser.NALU_SEI:
+					self.seis = append(self.seis, copyPooled(nalu, databuf))
 				case h264parser.IsDataNALU(nalu):
 					// raw nalu to avcc
-					b := make([]byte, 4+len(nalu))
+					b, buf := self.allocData(4+len(nalu))
 					pio.PutU32BE(b[0:4], uint32(len(nalu)))
 					copy(b[4:], nalu)
-					self.addPacket(b, time.Duration(0))
+					self.addPacket(b, buf, time.Duration(0))
 					n++
 				}
 			}
 		}
 
-		if self.CodecData == nil && len(sps) > 0 && len(pps) > 0 {
-			if self.CodecData, err = h264parser.NewCodecDataFromSPSAndPPS(sps, pps); err != nil {
-				return
+	case tsio.ElementaryStreamTypeH265:
+		nalus, _ := h265parser.SplitNALUs(payload)
+		var vps, sps, pps []byte
+		for _, nalu := range nalus {
+			if len(nalu) > 1 {
+				switch h265parser.NALUType(nalu) {
+				case h265parser.NALU_VPS:
+					vps = nalu
+				case h265parser.NALU_SPS:
+					sps = nalu
+				case h265parser.NALU_PPS:
+					pps = nalu
+				}
+			}
+		}
+
+		if len(vps) > 0 && len(sps) > 0 && len(pps) > 0 {
+			old, ok := self.CodecData.(h265parser.CodecData)
+			if !ok || !bytes.Equal(old.VPS(), vps) || !bytes.Equal(old.SPS(), sps) || !bytes.Equal(old.PPS(), pps) {
+				var codec h265parser.CodecData
+				if codec, err = h265parser.NewCodecDataFromVPSAndSPSAndPPS(copyPooled(vps, databuf), copyPooled(sps, databuf), copyPooled(pps, databuf)); err != nil {
+					return
+				}
+				self.changeCodecData(codec)
+			}
+		}
+
+		for _, nalu := range nalus {
+			if len(nalu) > 1 {
+				naltype := h265parser.NALUType(nalu)
+				switch {
+				case naltype == h265parser.NALU_SEI_PREFIX, naltype == h265parser.NALU_SEI_SUFFIX:
+					self.seis = append(self.seis, copyPooled(nalu, databuf))
+				case h265parser.IsDataNALU(nalu):
+					// raw nalu to avcc
+					b, buf := self.allocData(4+len(nalu))
+					pio.PutU32BE(b[0:4], uint32(len(nalu)))
+					copy(b[4:], nalu)
+					self.addPacket(b, buf, time.Duration(0))
+					n++
+				}
 			}
 		}
 	}
@@ -267,7 +527,7 @@ func (self *Stream) payloadEnd() (n int, err error) {
 	return
 }
 
-func (self *Stream) handleTSPacket(start bool, iskeyframe bool, payload []byte) (err error) {
+func (self *Stream) handleTSPacket(start bool, iskeyframe bool, discontinuity bool, payload []byte) (err error) {
 	if start {
 		if _, err = self.payloadEnd(); err != nil {
 			return
@@ -277,14 +537,19 @@ func (self *Stream) handleTSPacket(start bool, iskeyframe bool, payload []byte)
 			return
 		}
 		self.iskeyframe = iskeyframe
-		if self.datalen == 0 {
-			self.data = make([]byte, 0, 4096)
-		} else {
-			self.data = make([]byte, 0, self.datalen)
+		self.releaseData()
+		size := self.datalen
+		if size == 0 {
+			size = 4096
 		}
-		self.data = append(self.data, payload[hdrlen:]...)
+		self.data, self.databuf = self.allocData(size)
+		self.data = self.data[:0]
+		self.appendData(payload[hdrlen:])
 	} else {
-		self.data = append(self.data, payload...)
+		self.appendData(payload)
+	}
+	if discontinuity {
+		self.discontinuity = true
 	}
 	return
 }
@@ -1,18 +1,45 @@
 package ts
 
 import (
+	"fmt"
 	"io"
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/av/avutil"
 )
 
+// Sync byte should repeat every packet, more packets checked gives more confidence.
+func probeScore(b []byte) (score int, err error) {
+	n := 0
+	for i := 0; i < len(b); i += 188 {
+		if b[i] != 0x47 {
+			err = fmt.Errorf("ts: sync byte not found at offset=%d", i)
+			return
+		}
+		n++
+	}
+	switch {
+	case n >= 3:
+		score = avutil.ProbeScoreMax
+	case n == 2:
+		score = avutil.ProbeScoreDefault
+	case n == 1:
+		score = avutil.ProbeScoreMin
+	default:
+		err = fmt.Errorf("ts: input empty")
+	}
+	return
+}
+
 func Handler(h *avutil.RegisterHandler) {
 	h.Ext = ".ts"
 
 	h.Probe = func(b []byte) bool {
-		return b[0] == 0x47 && b[188] == 0x47
+		score, _ := probeScore(b)
+		return score > 0
 	}
 
+	h.ProbeScore = probeScore
+
 	h.ReaderDemuxer = func(r io.Reader) av.Demuxer {
 		return NewDemuxer(r)
 	}
@@ -5,26 +5,32 @@ import (
 	"github.com/nareix/joy4/av"
 	"github.com/nareix/joy4/codec/aacparser"
 	"github.com/nareix/joy4/codec/h264parser"
+	"github.com/nareix/joy4/codec/h265parser"
+	"github.com/nareix/joy4/codec/mp3parser"
+	"github.com/nareix/joy4/codec/opusparser"
 	"github.com/nareix/joy4/format/ts/tsio"
 	"io"
 	"time"
 )
 
-var CodecTypes = []av.CodecType{av.H264, av.AAC}
+var CodecTypes = []av.CodecType{av.H264, av.H265, av.AAC, av.OPUS, av.MP3, av.AC3, av.EAC3, av.ID3}
 
 type Muxer struct {
 	w                        io.Writer
 	streams                  []*Stream
+	pktstreams               []*Stream // by packet Idx, nil for streams not carried
 	PaddingToMakeCounterCont bool
 
 	psidata []byte
 	peshdr  []byte
 	tshdr   []byte
 	adtshdr []byte
+	opushdr []byte
 	datav   [][]byte
 	nalus   [][]byte
 
 	tswpat, tswpmt *tsio.TSWriter
+	pmtversion     uint8
 }
 
 func NewMuxer(w io.Writer) *Muxer {
@@ -34,6 +40,7 @@ func NewMuxer(w io.Writer) *Muxer {
 		peshdr:  make([]byte, tsio.MaxPESHeaderLength),
 		tshdr:   make([]byte, tsio.MaxTSHeaderLength),
 		adtshdr: make([]byte, aacparser.ADTSHeaderLength),
+		opushdr: make([]byte, 16),
 		nalus:   make([][]byte, 16),
 		datav:   make([][]byte, 16),
 		tswpmt:  tsio.NewTSWriter(tsio.PMT_PID),
@@ -41,7 +48,7 @@ func NewMuxer(w io.Writer) *Muxer {
 	}
 }
 
-func (self *Muxer) newStream(codec av.CodecData) (err error) {
+func checkCodecData(codec av.CodecData) (err error) {
 	ok := false
 	for _, c := range CodecTypes {
 		if codec.Type() == c {
@@ -54,6 +61,21 @@ func (self *Muxer) newStream(codec av.CodecData) (err error) {
 		return
 	}
 
+	if codec.Type() == av.OPUS {
+		// only channel_config_code 1-8 is supported in opus_audio_descriptor
+		if channels := codec.(opusparser.CodecData).Header.ChannelCount; channels > 8 {
+			err = fmt.Errorf("ts: opus channel count=%d is not supported", channels)
+			return
+		}
+	}
+	return
+}
+
+func (self *Muxer) newStream(codec av.CodecData) (err error) {
+	if err = checkCodecData(codec); err != nil {
+		return
+	}
+
 	pid := uint16(len(self.streams) + 0x100)
 	stream := &Stream{
 		muxer:     self,
@@ -111,11 +133,60 @@ func (self *Muxer) WritePATPMT() (err error) {
 				StreamType:    tsio.ElementaryStreamTypeAdtsAAC,
 				ElementaryPID: stream.pid,
 			})
+		case av.MP3:
+			streamType := uint8(tsio.ElementaryStreamTypeMPEG1Audio)
+			if stream.CodecData.(mp3parser.CodecData).Header.Version != mp3parser.MPEG1 {
+				streamType = tsio.ElementaryStreamTypeMPEG2Audio
+			}
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    streamType,
+				ElementaryPID: stream.pid,
+			})
+		case av.OPUS:
+			codec := stream.CodecData.(opusparser.CodecData)
+			channelConfig := uint8(codec.Header.ChannelCount)
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypePrivateData,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagRegistration, Data: []byte("Opus")},
+					{Tag: tsio.DescriptorTagExtension, Data: []byte{tsio.ExtensionDescriptorTagOpus, channelConfig}},
+				},
+			})
+		case av.AC3:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeAC3,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagRegistration, Data: []byte("AC-3")},
+				},
+			})
+		case av.EAC3:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeEAC3,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagRegistration, Data: []byte("EAC3")},
+				},
+			})
+		case av.ID3:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeMetadata,
+				ElementaryPID: stream.pid,
+				Descriptors: []tsio.Descriptor{
+					{Tag: tsio.DescriptorTagMetadata, Data: tsio.MetadataDescriptorData("ID3 ")},
+				},
+			})
 		case av.H264:
 			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
 				StreamType:    tsio.ElementaryStreamTypeH264,
 				ElementaryPID: stream.pid,
 			})
+		case av.H265:
+			elemStreams = append(elemStreams, tsio.ElementaryStreamInfo{
+				StreamType:    tsio.ElementaryStreamTypeH265,
+				ElementaryPID: stream.pid,
+			})
 		}
 	}
 
@@ -129,7 +200,7 @@ func (self *Muxer) WritePATPMT() (err error) {
 		return
 	}
 	pmt.Marshal(self.psidata[tsio.PSIHeaderLength:])
-	n = tsio.FillPSI(self.psidata, tsio.TableIdPMT, tsio.TableExtPMT, pmtlen)
+	n = tsio.FillPSIWithVersion(self.psidata, tsio.TableIdPMT, tsio.TableExtPMT, self.pmtversion, pmtlen)
 	self.datav[0] = self.psidata[:n]
 	if err = self.tswpmt.WritePackets(self.w, self.datav[:1], 0, false, true); err != nil {
 		return
@@ -140,10 +211,16 @@ func (self *Muxer) WritePATPMT() (err error) {
 
 func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	self.streams = []*Stream{}
-	for _, stream := range streams {
+	self.pktstreams = make([]*Stream, len(streams))
+	for i, stream := range streams {
+		if stream.Type().IsData() && checkCodecData(stream) != nil {
+			// data stream not carried by ts, e.g: flv script data, its packets are dropped
+			continue
+		}
 		if err = self.newStream(stream); err != nil {
 			return
 		}
+		self.pktstreams[i] = self.streams[len(self.streams)-1]
 	}
 
 	if err = self.WritePATPMT(); err != nil {
@@ -152,9 +229,35 @@ func (self *Muxer) WriteHeader(streams []av.CodecData) (err error) {
 	return
 }
 
+// Stream type may change with codec data, so PMT is written again with a new version.
+// H264/H265 parameter sets are sent with keyframes so new ones take effect right away.
+func (self *Muxer) writeCodecDataChange(pkt av.Packet) (err error) {
+	if err = checkCodecData(pkt.CodecData); err != nil {
+		return
+	}
+	self.pktstreams[pkt.Idx].CodecData = pkt.CodecData
+	self.pmtversion++
+	if err = self.WritePATPMT(); err != nil {
+		return
+	}
+	return
+}
+
 func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
-	stream := self.streams[pkt.Idx]
+	stream := self.pktstreams[pkt.Idx]
+	if stream == nil {
+		return
+	}
+	if pkt.CodecData != nil {
+		if err = self.writeCodecDataChange(pkt); err != nil {
+			return
+		}
+	}
+
 	pkt.Time += time.Second
+	if pkt.IsDiscontinuity() {
+		stream.tsw.Discontinuity = true
+	}
 
 	switch stream.Type() {
 	case av.AAC:
@@ -170,6 +273,48 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 			return
 		}
 
+	case av.MP3:
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdMP3, len(pkt.Data), pkt.Time, 0)
+		self.datav[0] = self.peshdr[:n]
+		self.datav[1] = pkt.Data
+
+		if err = stream.tsw.WritePackets(self.w, self.datav[:2], pkt.Time, true, false); err != nil {
+			return
+		}
+
+	case av.AC3, av.EAC3:
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdAC3, len(pkt.Data), pkt.Time, 0)
+		self.datav[0] = self.peshdr[:n]
+		self.datav[1] = pkt.Data
+
+		if err = stream.tsw.WritePackets(self.w, self.datav[:2], pkt.Time, true, false); err != nil {
+			return
+		}
+
+	case av.ID3:
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdPrivate1, len(pkt.Data), pkt.Time, 0)
+		self.datav[0] = self.peshdr[:n]
+		self.datav[1] = pkt.Data
+
+		if err = stream.tsw.WritePackets(self.w, self.datav[:2], 0, false, false); err != nil {
+			return
+		}
+
+	case av.OPUS:
+		if tsio.OpusControlHeaderLength(len(pkt.Data)) > len(self.opushdr) {
+			self.opushdr = make([]byte, tsio.OpusControlHeaderLength(len(pkt.Data)))
+		}
+		hdrlen := tsio.FillOpusControlHeader(self.opushdr, len(pkt.Data))
+
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdPrivate1, hdrlen+len(pkt.Data), pkt.Time, 0)
+		self.datav[0] = self.peshdr[:n]
+		self.datav[1] = self.opushdr[:hdrlen]
+		self.datav[2] = pkt.Data
+
+		if err = stream.tsw.WritePackets(self.w, self.datav[:3], pkt.Time, true, false); err != nil {
+			return
+		}
+
 	case av.H264:
 		codec := stream.CodecData.(h264parser.CodecData)
 
@@ -178,6 +323,7 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 			nalus = append(nalus, codec.SPS())
 			nalus = append(nalus, codec.PPS())
 		}
+		nalus = append(nalus, pkt.SideDataList(av.SIDE_DATA_SEI)...)
 		pktnalus, _ := h264parser.SplitNALUs(pkt.Data)
 		for _, nalu := range pktnalus {
 			nalus = append(nalus, nalu)
@@ -196,6 +342,38 @@ func (self *Muxer) WritePacket(pkt av.Packet) (err error) {
 		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdH264, -1, pkt.Time+pkt.CompositionTime, pkt.Time)
 		datav[0] = self.peshdr[:n]
 
+		if err = stream.tsw.WritePackets(self.w, datav, pkt.Time, pkt.IsKeyFrame, false); err != nil {
+			return
+		}
+
+	case av.H265:
+		codec := stream.CodecData.(h265parser.CodecData)
+
+		nalus := self.nalus[:0]
+		if pkt.IsKeyFrame {
+			nalus = append(nalus, codec.VPS())
+			nalus = append(nalus, codec.SPS())
+			nalus = append(nalus, codec.PPS())
+		}
+		nalus = append(nalus, pkt.SideDataList(av.SIDE_DATA_SEI)...)
+		pktnalus, _ := h265parser.SplitNALUs(pkt.Data)
+		for _, nalu := range pktnalus {
+			nalus = append(nalus, nalu)
+		}
+
+		datav := self.datav[:1]
+		for i, nalu := range nalus {
+			if i == 0 {
+				datav = append(datav, h265parser.AUDBytes)
+			} else {
+				datav = append(datav, h265parser.StartCodeBytes)
+			}
+			datav = append(datav, nalu)
+		}
+
+		n := tsio.FillPESHeader(self.peshdr, tsio.StreamIdH265, -1, pkt.Time+pkt.CompositionTime, pkt.Time)
+		datav[0] = self.peshdr[:n]
+
 		if err = stream.tsw.WritePackets(self.w, datav, pkt.Time, pkt.IsKeyFrame, false); err != nil {
 			return
 		}
@@ -22,6 +22,12 @@ type Stream struct {
 	iskeyframe bool
 	pts, dts time.Duration
 	data []byte
+	databuf *av.Buffer // pooled data
 	datalen int
+
+	// side data for next packet
+	discontinuity bool
+	seis [][]byte
+	changedCodecData av.CodecData
 }
 
@@ -0,0 +1,193 @@
+package ts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy4/av"
+	"github.com/nareix/joy4/codec/aacparser"
+	"github.com/nareix/joy4/codec/h264parser"
+)
+
+func testStreams(t *testing.T) []av.CodecData {
+	sps, _ := hex.DecodeString("67640028acd940780227e5c05a808080a0000003002000000781e3062cb0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	video, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := aacparser.NewCodecDataFromMPEG4AudioConfig(aacparser.MPEG4AudioConfig{
+		ObjectType:      aacparser.AOT_AAC_LC,
+		SampleRateIndex: 4,
+		ChannelConfig:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []av.CodecData{video, audio}
+}
+
+// Mux packets of 25fps video with 1s gop and audio, modified by fn before
+// written, then demux them back.
+func testRoundTrip(t *testing.T, n int, fn func(i int, pkt *av.Packet)) (out []av.Packet) {
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err := muxer.WriteHeader(testStreams(t)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		tm := time.Duration(i) * time.Second / 25
+		video := av.Packet{Idx: 0, Time: tm, Data: []byte{0, 0, 0, 2, 0x41, 0x9a}}
+		if i%25 == 0 {
+			video.IsKeyFrame = true
+			video.Data = []byte{0, 0, 0, 2, 0x65, 0x88}
+		}
+		fn(i, &video)
+		if err := muxer.WritePacket(video); err != nil {
+			t.Fatal(err)
+		}
+		if err := muxer.WritePacket(av.Packet{Idx: 1, Time: tm, Data: []byte{0x21, 0x10, 0x04}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := NewDemuxer(buf)
+	for {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Idx == 0 {
+			out = append(out, pkt)
+		}
+	}
+	if len(out) != n {
+		t.Fatalf("got %d video packets", len(out))
+	}
+	return
+}
+
+func TestSEISideData(t *testing.T) {
+	sei := []byte{0x06, 0x05, 0x02, 0xaa, 0xbb, 0x80}
+	out := testRoundTrip(t, 50, func(i int, pkt *av.Packet) {
+		if i%10 == 0 {
+			pkt.AddSideData(av.SIDE_DATA_SEI, sei)
+		}
+	})
+	for i, pkt := range out {
+		list := pkt.SideDataList(av.SIDE_DATA_SEI)
+		if i%10 != 0 {
+			if len(list) != 0 {
+				t.Fatalf("packet#%d got %d sei", i, len(list))
+			}
+			continue
+		}
+		if len(list) != 1 || !bytes.Equal(list[0], sei) {
+			t.Fatalf("packet#%d got sei %x", i, list)
+		}
+		// not in avcc data
+		if len(pkt.Data) != 6 {
+			t.Fatalf("packet#%d data %x", i, pkt.Data)
+		}
+	}
+}
+
+func TestCodecDataChange(t *testing.T) {
+	sps, _ := hex.DecodeString("6764001facd9405005bb011000000300100000030320f18319a0")
+	pps, _ := hex.DecodeString("68ebecb22c")
+	changed, err := h264parser.NewCodecDataFromSPSAndPPS(sps, pps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := testRoundTrip(t, 50, func(i int, pkt *av.Packet) {
+		if i == 25 {
+			pkt.CodecData = changed
+		}
+	})
+	for i, pkt := range out {
+		if i != 25 {
+			if pkt.CodecData != nil {
+				t.Fatalf("packet#%d codec data changed", i)
+			}
+			continue
+		}
+		codec, ok := pkt.CodecData.(h264parser.CodecData)
+		if !ok || codec.Width() != 1280 || codec.Height() != 720 {
+			t.Fatalf("packet#%d codec data %v", i, pkt.CodecData)
+		}
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	buf := &bytes.Buffer{}
+	muxer := NewMuxer(buf)
+	if err := muxer.WriteHeader(testStreams(t)[:1]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		nalu := bytes.Repeat([]byte{byte(i)}, 1000)
+		nalu[0] = 0x41
+		pkt := av.Packet{Time: time.Duration(i) * time.Second / 25}
+		if i%25 == 0 {
+			pkt.IsKeyFrame = true
+			nalu[0] = 0x65
+		}
+		pkt.Data = append([]byte{0, 0, 0x03, 0xe8}, nalu...)
+		if err := muxer.WritePacket(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := NewDemuxer(buf)
+	demuxer.BufferPool = av.NewBufferPool()
+	var held av.Packet
+	var heldData []byte
+	released := map[*av.Buffer]bool{}
+	reused := 0
+	for i := 0; ; i++ {
+		pkt, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			if i != 50 {
+				t.Fatalf("got %d packets", i)
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if pkt.Buffer == nil {
+			t.Fatalf("packet#%d data not pooled", i)
+		}
+		if pkt.Buffer == held.Buffer {
+			t.Fatalf("packet#%d got buffer still referenced", i)
+		}
+		if released[pkt.Buffer] {
+			reused++
+		}
+		if i == 1 {
+			held = pkt
+			held.Ref()
+			heldData = append([]byte(nil), pkt.Data...)
+		}
+		released[pkt.Buffer] = true
+		pkt.Release()
+	}
+	if !bytes.Equal(held.Data, heldData) || held.Data[len(held.Data)-1] != 1 {
+		t.Fatalf("held packet data changed")
+	}
+	held.Release()
+	// sync.Pool may drop some
+	if reused == 0 {
+		t.Fatalf("released buffers not reused")
+	}
+}
@@ -10,7 +10,11 @@ import (
 
 const (
 	StreamIdH264 = 0xe0
+	StreamIdH265 = 0xe0
 	StreamIdAAC  = 0xc0
+	StreamIdMP3  = 0xc0
+	StreamIdPrivate1 = 0xbd
+	StreamIdAC3      = 0xbd
 )
 
 const (
@@ -34,9 +38,28 @@ var ErrParsePAT = fmt.Errorf("invalid PAT")
 
 const (
 	ElementaryStreamTypeH264    = 0x1B
+	ElementaryStreamTypeH265    = 0x24
 	ElementaryStreamTypeAdtsAAC = 0x0F
+	ElementaryStreamTypePrivateData = 0x06
+	ElementaryStreamTypeMPEG1Audio  = 0x03
+	ElementaryStreamTypeMPEG2Audio  = 0x04
+	ElementaryStreamTypeAC3         = 0x81
+	ElementaryStreamTypeEAC3        = 0x87
+	ElementaryStreamTypeMetadata    = 0x15 // metadata carried in PES packets
 )
 
+const (
+	DescriptorTagRegistration = 0x05
+	DescriptorTagExtension    = 0x7f
+	DescriptorTagAC3          = 0x6a // DVB AC-3_descriptor
+	DescriptorTagEAC3         = 0x7a // DVB enhanced_AC-3_descriptor
+	DescriptorTagMetadata     = 0x26
+)
+
+// extension descriptor tag of opus_audio_descriptor
+const ExtensionDescriptorTagOpus = 0x80
+
+
 type PATEntry struct {
 	ProgramNumber uint16
 	NetworkPID    uint16
@@ -185,6 +208,66 @@ func (self PMT) Marshal(b []byte) (n int) {
 	return
 }
 
+func (self ElementaryStreamInfo) FindDescriptor(tag uint8) (desc Descriptor, ok bool) {
+	for _, desc = range self.Descriptors {
+		if desc.Tag == tag {
+			ok = true
+			return
+		}
+	}
+	return
+}
+
+// Format identifier in registration descriptor, eg. "Opus"
+func (self ElementaryStreamInfo) RegistrationFormat() string {
+	if desc, ok := self.FindDescriptor(DescriptorTagRegistration); ok && len(desc.Data) >= 4 {
+		return string(desc.Data[0:4])
+	}
+	return ""
+}
+
+/*
+metadata_descriptor (ISO/IEC 13818-1 section 2.6.60)
+
+	metadata_application_format(16)
+	if metadata_application_format == 0xffff {
+		metadata_application_format_identifier(32)
+	}
+	metadata_format(8)
+	if metadata_format == 0xff {
+		metadata_format_identifier(32)
+	}
+	metadata_service_id(8)
+	decoder_config_flags(3)
+	DSM-CC_flag(1)
+	reserved(4)
+*/
+func (self ElementaryStreamInfo) MetadataFormat() string {
+	if desc, ok := self.FindDescriptor(DescriptorTagMetadata); ok {
+		b := desc.Data
+		n := 2
+		if len(b) >= 2 && pio.U16BE(b) == 0xffff {
+			n += 4
+		}
+		if len(b) >= n+5 && b[n] == 0xff {
+			return string(b[n+1 : n+5])
+		}
+	}
+	return self.RegistrationFormat()
+}
+
+// Data of metadata_descriptor with format identifier, e.g: "ID3 "
+func MetadataDescriptorData(format string) []byte {
+	b := make([]byte, 13)
+	pio.PutU16BE(b[0:], 0xffff)
+	copy(b[2:6], format)
+	b[6] = 0xff
+	copy(b[7:11], format)
+	b[11] = 0    // metadata_service_id
+	b[12] = 0x0f // no decoder config, no DSM-CC
+	return b
+}
+
 func (self PMT) parseDescs(b []byte) (descs []Descriptor, err error) {
 	n := 0
 	for n < len(b) {
@@ -193,7 +276,7 @@ func (self PMT) parseDescs(b []byte) (descs []Descriptor, err error) {
 			desc.Tag = b[n]
 			desc.Data = make([]byte, b[n+1])
 			n += 2
-			if n+len(desc.Data) < len(b) {
+			if n+len(desc.Data) <= len(b) {
 				copy(desc.Data, b[n:])
 				descs = append(descs, desc)
 				n += len(desc.Data)
@@ -336,6 +419,11 @@ func ParsePSI(h []byte) (tableid uint8, tableext uint16, hdrlen int, datalen int
 const PSIHeaderLength = 9
 
 func FillPSI(h []byte, tableid uint8, tableext uint16, datalen int) (n int) {
+	return FillPSIWithVersion(h, tableid, tableext, 0, datalen)
+}
+
+// Version should be increased each time table content changes, e.g: new PMT.
+func FillPSIWithVersion(h []byte, tableid uint8, tableext uint16, version uint8, datalen int) (n int) {
 	// pointer(8)
 	h[n] = 0
 	n++
@@ -352,8 +440,8 @@ func FillPSI(h []byte, tableid uint8, tableext uint16, datalen int) (n int) {
 	pio.PutU16BE(h[n:], tableext)
 	n += 2
 
-	// resverd(2)=3,version(5)=0,Current_next_indicator(1)=1
-	h[n] = 0x3<<6 | 1
+	// resverd(2)=3,version(5),Current_next_indicator(1)=1
+	h[n] = 0x3<<6 | (version&0x1f)<<1 | 1
 	n++
 
 	// section_number(8)
@@ -501,6 +589,7 @@ func FillPESHeader(h []byte, streamid uint8, datalen int, pts, dts time.Duration
 type TSWriter struct {
 	w   io.Writer
 	ContinuityCounter uint
+	Discontinuity bool // set discontinuity_indicator in next written packet
 	tshdr []byte
 }
 
@@ -537,6 +626,10 @@ func (self *TSWriter) WritePackets(w io.Writer, datav [][]byte, pcr time.Duratio
 			if sync {
 				self.tshdr[5] = 0x40|self.tshdr[5] // Random Access indicator
 			}
+			if self.Discontinuity {
+				self.tshdr[5] = 0x80|self.tshdr[5]
+				self.Discontinuity = false
+			}
 		}
 
 		padtail := 0
@@ -588,3 +681,77 @@ func ParseTSHeader(tshdr []byte) (pid uint16, start bool, iskeyframe bool, hdrle
 	return
 }
 
+// discontinuity_indicator in adaptation field
+func TSDiscontinuity(tshdr []byte) bool {
+	return tshdr[3]&0x20 != 0 && tshdr[4] > 0 && tshdr[5]&0x80 != 0
+}
+
+var ErrOpusControlHeader = fmt.Errorf("invalid opus control header")
+
+/*
+opus_control_header
+
+control_header_prefix(11)=0x3ff
+start_trim_flag(1)
+end_trim_flag(1)
+control_extension_flag(1)
+reserved(2)
+au_size: sum of bytes until one byte != 0xff
+start_trim(16)?
+end_trim(16)?
+control_extension_length(8)? control_extension_data?
+*/
+func ParseOpusControlHeader(h []byte) (hdrlen int, ausize int, err error) {
+	if len(h) < 2 || pio.U16BE(h)&0xffe0 != 0x7fe0 {
+		err = ErrOpusControlHeader
+		return
+	}
+	flags := h[1]
+	hdrlen = 2
+	for {
+		if hdrlen >= len(h) {
+			err = ErrOpusControlHeader
+			return
+		}
+		b := h[hdrlen]
+		hdrlen++
+		ausize += int(b)
+		if b != 0xff {
+			break
+		}
+	}
+	if flags&0x10 != 0 {
+		hdrlen += 2
+	}
+	if flags&0x08 != 0 {
+		hdrlen += 2
+	}
+	if flags&0x04 != 0 {
+		if hdrlen >= len(h) {
+			err = ErrOpusControlHeader
+			return
+		}
+		hdrlen += int(h[hdrlen])+1
+	}
+	if hdrlen+ausize > len(h) {
+		err = ErrOpusControlHeader
+		return
+	}
+	return
+}
+
+func OpusControlHeaderLength(ausize int) int {
+	return 2 + ausize/0xff + 1
+}
+
+func FillOpusControlHeader(h []byte, ausize int) (n int) {
+	pio.PutU16BE(h, 0x7fe0)
+	n = 2
+	for ; ausize >= 0xff; ausize -= 0xff {
+		h[n] = 0xff
+		n++
+	}
+	h[n] = uint8(ausize)
+	n++
+	return
+}
@@ -39,6 +39,12 @@ func I32BE(b []byte) (i int32) {
 	return
 }
 
+func U16LE(b []byte) (i uint16) {
+	i = uint16(b[1])
+	i <<= 8; i |= uint16(b[0])
+	return
+}
+
 func U32LE(b []byte) (i uint32) {
 	i = uint32(b[3])
 	i <<= 8; i |= uint32(b[2])
@@ -64,6 +70,16 @@ func U40BE(b []byte) (i uint64) {
 	return
 }
 
+func U48BE(b []byte) (i uint64) {
+	i = uint64(b[0])
+	i <<= 8; i |= uint64(b[1])
+	i <<= 8; i |= uint64(b[2])
+	i <<= 8; i |= uint64(b[3])
+	i <<= 8; i |= uint64(b[4])
+	i <<= 8; i |= uint64(b[5])
+	return
+}
+
 func U64BE(b []byte) (i uint64) {
 	i = uint64(b[0])
 	i <<= 8; i |= uint64(b[1])
@@ -88,4 +104,14 @@ func I64BE(b []byte) (i int64) {
 	return
 }
 
-
+func U64LE(b []byte) (i uint64) {
+	i = uint64(b[7])
+	i <<= 8; i |= uint64(b[6])
+	i <<= 8; i |= uint64(b[5])
+	i <<= 8; i |= uint64(b[4])
+	i <<= 8; i |= uint64(b[3])
+	i <<= 8; i |= uint64(b[2])
+	i <<= 8; i |= uint64(b[1])
+	i <<= 8; i |= uint64(b[0])
+	return
+}
@@ -41,6 +41,11 @@ func PutU32BE(b []byte, v uint32) {
 	b[3] = byte(v)
 }
 
+func PutU16LE(b []byte, v uint16) {
+	b[1] = byte(v>>8)
+	b[0] = byte(v)
+}
+
 func PutU32LE(b []byte, v uint32) {
 	b[3] = byte(v>>24)
 	b[2] = byte(v>>16)
@@ -87,3 +92,13 @@ func PutI64BE(b []byte, v int64) {
 	b[7] = byte(v)
 }
 
+func PutU64LE(b []byte, v uint64) {
+	b[7] = byte(v>>56)
+	b[6] = byte(v>>48)
+	b[5] = byte(v>>40)
+	b[4] = byte(v>>32)
+	b[3] = byte(v>>24)
+	b[2] = byte(v>>16)
+	b[1] = byte(v>>8)
+	b[0] = byte(v)
+}